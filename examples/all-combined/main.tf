@@ -270,8 +270,16 @@ module "vpes" {
 module "external_secrets_operator" {
   source        = "../../"
   eso_namespace = var.eso_namespace
+  # ESO installation processing only the stores of the tenant namespace, running with its own service account
+  eso_scoped_installations = {
+    tenant = {
+      controller_class = "tenant"
+      namespace        = var.es_namespace_tp_tenant
+      scoped_namespace = var.es_namespace_tp_tenant
+    }
+  }
   depends_on = [
-    kubernetes_namespace_v1.apikey_namespaces, kubernetes_namespace_v1.tp_namespaces
+    kubernetes_namespace_v1.apikey_namespaces, kubernetes_namespace_v1.tp_namespaces, kubernetes_namespace_v1.tp_namespace_tenant
   ]
 }
 
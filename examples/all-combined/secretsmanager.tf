@@ -82,6 +82,19 @@ resource "ibm_iam_service_policy" "secret_puller_policy" {
   }
 }
 
+# Create policy to allow new service id to read its own API key, synced by ESO for the secrets store with the API key rotation
+resource "ibm_iam_service_policy" "secret_puller_apikey_policy" {
+  iam_id = ibm_iam_service_id.secret_puller.iam_id
+  roles  = ["SecretsReader"]
+
+  resources {
+    service              = "secrets-manager"
+    resource_instance_id = local.sm_guid
+    resource_type        = "secret-group"
+    resource             = module.secrets_manager_group_acct.secret_group_id
+  }
+}
+
 # create dynamic Service ID API key and add to secret manager
 module "dynamic_serviceid_apikey1" {
   source  = "terraform-ibm-modules/iam-serviceid-apikey-secrets-manager/ibm"
@@ -11,7 +11,7 @@
 
 # creation of namespace scoped secretstore with apikey authentication
 module "eso_apikey_namespace_secretstore_1" {
-  depends_on                  = [module.external_secrets_operator]
+  depends_on                  = [module.external_secrets_operator, ibm_iam_service_policy.secret_puller_apikey_policy]
   source                      = "../../modules/eso-secretstore"
   eso_authentication          = "api_key"
   region                      = local.sm_region
@@ -22,6 +22,8 @@ module "eso_apikey_namespace_secretstore_1" {
   service_endpoints           = var.service_endpoints
   sstore_helm_rls_name        = "es-store"
   sstore_secret_name          = "generic-cluster-api-key" #checkov:skip=CKV_SECRET_6
+  # the API key secret is synced by ESO from the iam_credentials secret, to pick up its rotations
+  sstore_secret_apikey_secret_id = module.dynamic_serviceid_apikey1.secret_id
 }
 
 module "eso_apikey_namespace_secretstore_2" {
@@ -342,3 +342,107 @@ module "external_secret_tp_nosg" {
   es_container_registry_email   = "user@company.com"
   es_helm_rls_name              = "es-tp-nosg"
 }
+
+######################################################################################################
+# namespaced secretstore with trusted profile authentication through the service account of an
+# ESO installation scoped to the namespace, so that the trusted profile isn't usable by the stores
+# of the other namespaces
+######################################################################################################
+
+# Create namespace for the tenant served by its own ESO installation
+resource "kubernetes_namespace_v1" "tp_namespace_tenant" {
+  metadata {
+    name = var.es_namespace_tp_tenant
+  }
+  lifecycle {
+    ignore_changes = [
+      metadata[0].annotations,
+      metadata[0].labels
+    ]
+  }
+  depends_on = [
+    time_sleep.wait_45_seconds
+  ]
+}
+
+# SecretStore with trusted profile authentication processed only by the tenant ESO installation
+module "eso_tp_namespace_secretstore_tenant" {
+  depends_on                  = [module.external_secrets_operator]
+  source                      = "../../modules/eso-secretstore"
+  eso_authentication          = "trusted_profile"
+  region                      = local.sm_region
+  sstore_namespace            = kubernetes_namespace_v1.tp_namespace_tenant.metadata[0].name
+  sstore_secrets_manager_guid = local.sm_guid
+  sstore_store_name           = "${var.es_namespace_tp_tenant}-store" # each store created with the name of the namespace with "-store" as suffix
+  sstore_trusted_profile_name = module.external_secrets_trusted_profile_tenant.trusted_profile_name
+  sstore_controller_class     = module.external_secrets_operator.eso_scoped_installations["tenant"].controller_class
+  service_endpoints           = var.service_endpoints
+  sstore_helm_rls_name        = "es-store-tp-tenant"
+  sstore_secret_name          = "secretstore-tp-tenant" #checkov:skip=CKV_SECRET_6
+}
+
+# creating secrets group for the tenant namespace
+module "tp_secrets_manager_group_tenant" {
+  source                   = "terraform-ibm-modules/secrets-manager-secret-group/ibm"
+  version                  = "1.5.4"
+  region                   = local.sm_region
+  secrets_manager_guid     = local.sm_guid
+  secret_group_name        = "${var.prefix}-tp-secret-group-tenant"                                                       #checkov:skip=CKV_SECRET_6: does not require high entropy string as is static value
+  secret_group_description = "Secret-Group for storing account credentials for tp authentication of the tenant namespace" #tfsec:ignore:general-secrets-no-plaintext-exposure
+  providers = {
+    ibm = ibm.ibm-sm
+  }
+}
+
+# arbitrary secret in the secrets group of the tenant namespace
+module "sm_arbitrary_secret_tp_tenant" {
+  source               = "terraform-ibm-modules/secrets-manager-secret/ibm"
+  version              = "1.10.1"
+  region               = local.sm_region
+  secrets_manager_guid = local.sm_guid
+  secret_group_id      = module.tp_secrets_manager_group_tenant.secret_group_id
+  secret_type          = "arbitrary"
+  #tfsec:ignore:general-secrets-no-plaintext-exposure
+  secret_name             = "${var.prefix}-eso-test-dummy-secret-tp-tenant"                                                               #checkov:skip=CKV_SECRET_6
+  secret_description      = "eso_test_dummy_secret_tp_tenant example secret in existing secret manager instance for the tenant namespace" #tfsec:ignore:general-secrets-no-plaintext-exposure
+  secret_payload_password = "dummy_secret_value_eso_test_dummy_secret_tp"                                                                 # pragma: allowlist secret
+  providers = {
+    ibm = ibm.ibm-sm
+  }
+}
+
+# creating trusted profile with the claim rule bound to the service account of the tenant ESO installation
+module "external_secrets_trusted_profile_tenant" {
+  source               = "../../modules/eso-trusted-profile"
+  trusted_profile_name = "${var.prefix}-eso-tp-tenant"
+  secrets_manager_guid = local.sm_guid
+  secret_groups_id     = [module.tp_secrets_manager_group_tenant.secret_group_id]
+  tp_clusters = [
+    {
+      cluster_crn          = module.ocp_base.cluster_crn
+      namespace            = module.external_secrets_operator.eso_scoped_installations["tenant"].namespace
+      service_account_name = module.external_secrets_operator.eso_scoped_installations["tenant"].service_account_name
+      cr_type              = "ROKS_SA"
+    }
+  ]
+}
+
+# eso externalsecret object synched by the tenant ESO installation
+module "external_secret_tp_tenant" {
+  depends_on = [
+    module.eso_tp_namespace_secretstore_tenant
+  ]
+  source                        = "../../modules/eso-external-secret"
+  eso_store_scope               = "namespace"
+  es_kubernetes_namespace       = kubernetes_namespace_v1.tp_namespace_tenant.metadata[0].name
+  es_kubernetes_secret_name     = "${var.prefix}-arbitrary-arb-tp-tenant"        #checkov:skip=CKV_SECRET_6
+  sm_secret_type                = "arbitrary"                                    #checkov:skip=CKV_SECRET_6
+  sm_secret_id                  = module.sm_arbitrary_secret_tp_tenant.secret_id #checkov:skip=CKV_SECRET_6
+  es_kubernetes_secret_type     = "opaque"
+  es_kubernetes_secret_data_key = "apikey"
+  es_refresh_interval           = "5m"
+  eso_store_name                = "${var.es_namespace_tp_tenant}-store" # each store created with the name of the namespace with "-store" as suffix
+  es_container_registry         = "us.icr.io"
+  es_container_registry_email   = "user@company.com"
+  es_helm_rls_name              = "es-tp-tenant"
+}
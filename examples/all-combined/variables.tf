@@ -186,6 +186,12 @@ variable "es_namespace_tp_no_sg" {
   default     = "tpns-nosg"
 }
 
+variable "es_namespace_tp_tenant" {
+  type        = string
+  description = "Namespace for the secret synched through trusted profile authentication by an ESO installation scoped to the namespace, with a claim rule bound to the service account of that installation."
+  default     = "tpns-tenant"
+}
+
 variable "es_refresh_interval" {
   description = "Specify interval for es secret synchronization"
   default     = "1h"
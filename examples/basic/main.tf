@@ -307,8 +307,9 @@ resource "ibm_iam_service_policy" "secret_puller_policy" {
 ##################################################################
 
 module "external_secrets_operator" {
-  source        = "../../"
-  eso_namespace = local.eso_namespace
+  source                        = "../../"
+  eso_namespace                 = local.eso_namespace
+  reloader_namespaces_to_ignore = var.reloader_namespaces_to_ignore
   depends_on = [
     kubernetes_namespace_v1.apikey_namespace
   ]
@@ -408,3 +409,44 @@ module "external_secret_usr_pass" {
   es_helm_rls_name          = "es-docker-uc"
   reloader_watching         = true
 }
+
+##################################################################
+# arbitrary secret rotated by the tests, synced to an opaque secret
+# consumed by a workload reloaded on its update
+##################################################################
+
+locals {
+  # initial secret value for sm_rotated_arbitrary_secret, rotated by the tests
+  rotated_arbitrary_payload = sensitive("arbitrary-payload-example")
+}
+
+module "sm_rotated_arbitrary_secret" {
+  source               = "terraform-ibm-modules/secrets-manager-secret/ibm"
+  version              = "1.10.1"
+  region               = local.sm_region
+  secrets_manager_guid = local.sm_guid
+  secret_group_id      = module.secrets_manager_group_acct.secret_group_id
+  secret_type          = "arbitrary"
+  #tfsec:ignore:general-secrets-no-plaintext-exposure
+  secret_name             = "${var.prefix}-rotated-arbitrary-secret"      #checkov:skip=CKV_SECRET_6
+  secret_description      = "example secret rotated by the rotation test" #tfsec:ignore:general-secrets-no-plaintext-exposure
+  secret_payload_password = local.rotated_arbitrary_payload
+  providers = {
+    ibm = ibm.ibm-sm
+  }
+}
+
+# ESO externalsecret with cluster scope creating an opaque secret annotated to be watched by the Reloader
+module "external_secret_rotated_arbitrary" {
+  depends_on                    = [module.external_secrets_operator]
+  source                        = "../../modules/eso-external-secret"
+  es_kubernetes_secret_type     = "opaque"    #checkov:skip=CKV_SECRET_6
+  sm_secret_type                = "arbitrary" #checkov:skip=CKV_SECRET_6
+  sm_secret_id                  = module.sm_rotated_arbitrary_secret.secret_id
+  es_kubernetes_namespace       = kubernetes_namespace_v1.apikey_namespace.metadata[0].name
+  eso_store_name                = "cluster-store"
+  es_kubernetes_secret_name     = "rotated-arbitrary" #checkov:skip=CKV_SECRET_6
+  es_kubernetes_secret_data_key = "value"
+  es_helm_rls_name              = "es-rotated-arbitrary"
+  reloader_watching             = true
+}
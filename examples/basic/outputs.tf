@@ -5,3 +5,28 @@ output "cluster_id" {
   description = "ID of the cluster deployed"
   value       = module.ocp_base.cluster_id
 }
+
+output "secrets_manager_guid" {
+  description = "GUID of the Secrets Manager instance storing the secrets"
+  value       = local.sm_guid
+}
+
+output "secrets_manager_region" {
+  description = "Region of the Secrets Manager instance storing the secrets"
+  value       = local.sm_region
+}
+
+output "rotated_secret_id" {
+  description = "ID of the Secrets Manager arbitrary secret rotated by the tests"
+  value       = module.sm_rotated_arbitrary_secret.secret_id
+}
+
+output "rotated_external_secret" {
+  description = "Namespace, name and data key of the ExternalSecret syncing the rotated secret, and the annotations of the workloads consuming it"
+  value = {
+    namespace            = kubernetes_namespace_v1.apikey_namespace.metadata[0].name
+    name                 = "rotated-arbitrary"
+    data_key             = "value"
+    workload_annotations = module.external_secret_rotated_arbitrary.reloader_workload_annotations
+  }
+}
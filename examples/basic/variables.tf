@@ -63,6 +63,12 @@ variable "existing_sm_instance_region" {
   default     = null
 }
 
+variable "reloader_namespaces_to_ignore" {
+  type        = string
+  description = "Comma separated namespaces whose secrets updates are ignored by the Reloader."
+  default     = null
+}
+
 variable "zones" {
   description = "List of zones"
   type        = list(string)
@@ -36,11 +36,19 @@ data "kubernetes_namespace_v1" "existing_eso_namespace" {
 locals {
   # namespace to use for eso. If both eso_namespace and existing_eso_namespace are not null, eso_namespace takes the precedence
   eso_namespace = var.eso_namespace != null ? var.eso_namespace : data.kubernetes_namespace_v1.existing_eso_namespace[0].metadata[0].name
+
+  # images with the registry (the first component of the path if it is a host) replaced by image_registry_mirror
+  eso_image      = var.image_registry_mirror == null ? var.eso_image : "${var.image_registry_mirror}/${regex("^(?:[^/]*[.:][^/]*/|localhost/)?(.+)$", var.eso_image)[0]}"
+  reloader_image = var.image_registry_mirror == null ? var.reloader_image : "${var.image_registry_mirror}/${regex("^(?:[^/]*[.:][^/]*/|localhost/)?(.+)$", var.reloader_image)[0]}"
+
+  # helm behaviour of the releases, see helm_release_settings
+  helm_timeout = var.helm_release_settings.timeout != null ? var.helm_release_settings.timeout : 300
+  helm_atomic  = var.helm_release_settings.atomic != null ? var.helm_release_settings.atomic : var.rollback_on_failure
 }
 
 locals {
   eso_helm_release_values_cri = <<-EOF
-installCRDs: true
+installCRDs: ${!var.eso_crds_separate_release}
 securityContext:
   allowPrivilegeEscalation: false
   capabilities:
@@ -168,21 +176,175 @@ certController:
 EOF
 }
 
+##############################################################################
+# ESO CRDs
+##############################################################################
+
+locals {
+  # the helm release installing the CRDs, the ESO release itself unless they are managed by their dedicated release
+  eso_crds_release_name = var.eso_crds_separate_release ? "external-secrets-crds" : "external-secrets"
+  eso_crds_annotations  = var.eso_crds_keep_on_destroy ? { "helm.sh/resource-policy" = "keep" } : {}
+  # CRDs of the kinds of eso_features, created only if the kind is enabled
+  eso_crds_create = {
+    createClusterSecretStore    = var.eso_features.cluster_secret_store
+    createClusterExternalSecret = var.eso_features.cluster_external_secret
+    createPushSecret            = var.eso_features.push_secret
+    createClusterPushSecret     = var.eso_features.cluster_push_secret
+    createClusterGenerator      = var.eso_features.cluster_generator
+  }
+  eso_helm_release_values_crds = yamlencode({
+    crds = merge(local.eso_crds_create, {
+      annotations = local.eso_crds_annotations
+    })
+  })
+  # values of the ESO chart installing only the CRDs
+  eso_crds_helm_release_values = yamlencode({
+    installCRDs    = true
+    createOperator = false
+    serviceAccount = { create = false }
+    rbac           = { create = false }
+    webhook        = { create = false }
+    certController = { create = false }
+    crds = merge(local.eso_crds_create, {
+      annotations = local.eso_crds_annotations
+    })
+  })
+
+  # CRDs of the chart to install and their served versions, in the format expected by the pre-upgrade check script
+  eso_crds = [
+    for document in split("\n---", try(data.helm_template.eso_crds[0].manifest, "")) : yamldecode(document)
+    if try(yamldecode(document).kind, "") == "CustomResourceDefinition"
+  ]
+  eso_crds_served_versions = join("\n", [for crd in local.eso_crds : "${crd.metadata.name}=${join(",", [for version in crd.spec.versions : version.name if version.served])}"])
+}
+
+# rendering the CRDs of the chart to install to check them against the ones of the cluster
+data "helm_template" "eso_crds" {
+  count               = var.eso_crds_pre_upgrade_check ? 1 : 0
+  name                = local.eso_crds_release_name
+  namespace           = local.eso_namespace
+  chart               = "external-secrets"
+  version             = var.eso_chart_version
+  repository          = var.eso_chart_location
+  repository_username = try(var.eso_chart_repository_credentials.username, null)
+  repository_password = try(var.eso_chart_repository_credentials.password, null)
+  values              = [local.eso_crds_helm_release_values]
+}
+
+# checking that the versions stored in the cluster are served by the CRDs to install and moving the existing CRDs to the release managing them
+resource "terraform_data" "eso_crds_pre_upgrade_check" {
+  depends_on       = [module.eso_namespace, data.kubernetes_namespace_v1.existing_eso_namespace]
+  count            = var.eso_crds_pre_upgrade_check ? 1 : 0
+  triggers_replace = [var.eso_chart_version, local.eso_crds_release_name, local.eso_crds_served_versions]
+
+  provisioner "local-exec" {
+    command     = "${path.module}/scripts/eso-crds-pre-upgrade.sh"
+    interpreter = ["/bin/bash", "-c"]
+    environment = {
+      KUBECONFIG          = var.kubeconfig_path
+      CRD_SERVED_VERSIONS = local.eso_crds_served_versions
+      RELEASE_NAME        = local.eso_crds_release_name
+      RELEASE_NAMESPACE   = local.eso_namespace
+    }
+  }
+}
+
+# CRDs managed separately from the ESO release, not to be upgraded, rolled back or deleted with it
+# the release is never atomic: purging a failed install would delete the CRDs adopted from the ESO release, with all the
+# ESO resources of the cluster, and rolling back a failed upgrade would restore CRDs that may no longer serve the stored versions
+resource "helm_release" "external_secrets_operator_crds" {
+  depends_on          = [module.eso_namespace, data.kubernetes_namespace_v1.existing_eso_namespace, terraform_data.eso_crds_pre_upgrade_check]
+  count               = var.eso_crds_separate_release ? 1 : 0
+  name                = "external-secrets-crds"
+  namespace           = local.eso_namespace
+  chart               = "external-secrets"
+  version             = var.eso_chart_version
+  timeout             = local.helm_timeout
+  atomic              = false
+  wait                = var.helm_release_settings.wait
+  wait_for_jobs       = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail     = var.helm_release_settings.cleanup_on_fail
+  max_history         = var.helm_release_settings.max_history
+  repository          = var.eso_chart_location
+  repository_username = try(var.eso_chart_repository_credentials.username, null)
+  repository_password = try(var.eso_chart_repository_credentials.password, null)
+  values              = [local.eso_crds_helm_release_values]
+}
+
+locals {
+  # on OpenShift the user ID of the pods is assigned by the restricted-v2 SCC from the namespace UID range
+  eso_is_openshift = var.eso_is_openshift ? [
+    for component in ["", "webhook.", "certController."] : {
+      name  = "${component}securityContext.runAsUser"
+      value = "null"
+    }
+  ] : []
+
+  # log level and time encoding of each ESO component, only the ones differing from the chart defaults being set
+  eso_log_components = {
+    ""                = { level = var.eso_log.level, time_encoding = var.eso_log.time_encoding }
+    "webhook."        = { level = coalesce(var.eso_log.webhook.level, var.eso_log.level), time_encoding = coalesce(var.eso_log.webhook.time_encoding, var.eso_log.time_encoding) }
+    "certController." = { level = coalesce(var.eso_log.cert_controller.level, var.eso_log.level), time_encoding = coalesce(var.eso_log.cert_controller.time_encoding, var.eso_log.time_encoding) }
+  }
+  eso_log = {
+    for component, log in local.eso_log_components : component => concat(
+      log.level != "info" ? [{
+        name  = "${component}log.level"
+        value = log.level
+      }] : [],
+      log.time_encoding != "epoch" ? [{
+        name  = "${component}log.timeEncoding"
+        value = log.time_encoding
+    }] : [])
+  }
+
+  # controllers of the kinds of eso_features, only the disabled ones being set to keep the chart defaults
+  eso_process_flags = {
+    processClusterStore          = var.eso_features.cluster_secret_store
+    processClusterExternalSecret = var.eso_features.cluster_external_secret
+    processPushSecret            = var.eso_features.push_secret
+    processClusterPushSecret     = var.eso_features.cluster_push_secret
+  }
+  eso_features = [
+    for flag, enabled in local.eso_process_flags : {
+      name  = flag
+      value = false
+    } if !enabled
+  ]
+
+  # keys of eso_custom_values, flattened in the dot notation of the helm set up to the depth of the keys set by the module
+  eso_custom_values_level_1 = try(merge(yamldecode(var.eso_custom_values)), {})
+  eso_custom_values_level_2 = merge([for key, value in local.eso_custom_values_level_1 : try({ for child, child_value in value : "${key}.${child}" => child_value }, { (key) = value })]...)
+  eso_custom_values_level_3 = merge([for key, value in local.eso_custom_values_level_2 : try({ for child, child_value in value : "${key}.${child}" => child_value }, { (key) = value })]...)
+  eso_custom_values_keys    = keys(local.eso_custom_values_level_3)
+  # keys of eso_custom_values overridden by the module, through the helm set or the imagePullSecrets values
+  eso_custom_values_overrides = sort(distinct([
+    for key in concat([for entry in helm_release.external_secrets_operator.set : entry.name], length(var.eso_image_pull_secrets) > 0 ? ["global.imagePullSecrets"] : []) : key
+    if anytrue([for custom_key in local.eso_custom_values_keys : custom_key == key || startswith(custom_key, "${key}.") || startswith(key, "${custom_key}.")])
+  ]))
+}
+
 resource "helm_release" "external_secrets_operator" {
-  depends_on = [module.eso_namespace, data.kubernetes_namespace_v1.existing_eso_namespace]
+  depends_on = [module.eso_namespace, data.kubernetes_namespace_v1.existing_eso_namespace, terraform_data.eso_crds_pre_upgrade_check, helm_release.external_secrets_operator_crds]
 
-  name       = "external-secrets"
-  namespace  = local.eso_namespace
-  chart      = "external-secrets"
-  version    = var.eso_chart_version
-  wait       = true
-  atomic     = var.rollback_on_failure
-  repository = var.eso_chart_location
+  name                = "external-secrets"
+  namespace           = local.eso_namespace
+  chart               = "external-secrets"
+  version             = var.eso_chart_version
+  timeout             = local.helm_timeout
+  atomic              = local.helm_atomic
+  wait                = var.helm_release_settings.wait
+  wait_for_jobs       = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail     = var.helm_release_settings.cleanup_on_fail
+  max_history         = var.helm_release_settings.max_history
+  repository          = var.eso_chart_location
+  repository_username = try(var.eso_chart_repository_credentials.username, null)
+  repository_password = try(var.eso_chart_repository_credentials.password, null)
 
-  set = [{
+  set = concat([{
     name  = "image.repository"
     type  = "string"
-    value = var.eso_image
+    value = local.eso_image
     },
     {
       name  = "image.tag"
@@ -192,7 +354,7 @@ resource "helm_release" "external_secrets_operator" {
     {
       name  = "webhook.image.repository"
       type  = "string"
-      value = var.eso_image
+      value = local.eso_image
     },
     {
       name  = "webhook.image.tag"
@@ -202,7 +364,7 @@ resource "helm_release" "external_secrets_operator" {
     {
       name  = "certController.image.repository"
       type  = "string"
-      value = var.eso_image
+      value = local.eso_image
     },
     {
       name  = "certController.image.tag"
@@ -212,10 +374,18 @@ resource "helm_release" "external_secrets_operator" {
     {
       name  = "concurrent"
       value = var.concurrent_reconciles
-  }]
+    }
+    ],
+    # Set the log level and time encoding of the components
+    flatten(values(local.eso_log)),
+    # Disable the controllers of the kinds not enabled in eso_features
+    local.eso_features,
+    # Set runAsUser to null if isOpenShift is true
+    local.eso_is_openshift
+  )
 
   # The following mounts are needed for the CRI based authentication with Trusted Profiles
-  values = [local.eso_helm_release_values_cri, local.eso_helm_release_values_workerselector, length(var.eso_image_pull_secrets) > 0 ? yamlencode({
+  values = [local.eso_helm_release_values_cri, local.eso_helm_release_values_crds, local.eso_helm_release_values_workerselector, var.eso_custom_values != null ? var.eso_custom_values : "", length(var.eso_image_pull_secrets) > 0 ? yamlencode({
     global = {
       imagePullSecrets = [
         for secret in var.eso_image_pull_secrets :
@@ -243,24 +413,78 @@ locals {
     name  = "reloader.logFormat"
     value = var.reloader_log_format
   }] : []
+  reloader_custom_annotations = [
+    for name, key in var.reloader_custom_annotations : {
+      name  = "reloader.custom_annotations.${name}"
+      type  = "string"
+      value = key
+    } if key != null
+  ]
+
+  # reloader watching all the namespaces with cluster scoped RBAC, unless restricted by label selectors
+  reloader_watch_globally = try(var.reloader_values.rbac.scope, "cluster") == "cluster" && var.reloader_namespaces_selector == null && var.reloader_resource_label_selector == null
+
+  # values of the reloader helm chart from reloader_values, without the keys not set to keep the chart defaults
+  reloader_values = { for key, value in {
+    enableHA = var.reloader_values.high_availability
+    rbac     = var.reloader_values.rbac == null ? null : { enabled = var.reloader_values.rbac.enabled }
+    serviceMonitor = var.reloader_values.service_monitor == null ? null : { for key, value in {
+      enabled  = var.reloader_values.service_monitor.enabled
+      interval = var.reloader_values.service_monitor.interval
+      timeout  = var.reloader_values.service_monitor.timeout
+      labels   = length(var.reloader_values.service_monitor.labels) > 0 ? var.reloader_values.service_monitor.labels : null
+    } : key => value if value != null }
+    deployment = var.reloader_values.replicas == null && var.reloader_values.resources == null ? null : { for key, value in {
+      replicas = var.reloader_values.replicas
+      resources = var.reloader_values.resources == null ? null : { for kind, quantities in var.reloader_values.resources : kind => {
+        for name, quantity in quantities : name => quantity if quantity != null
+      } if quantities != null }
+    } : key => value if value != null }
+  } : key => value if value != null }
+  # chart keys set by reloader_values
+  reloader_values_keys = compact([
+    var.reloader_values.replicas != null ? "reloader.deployment.replicas" : "",
+    var.reloader_values.resources != null ? "reloader.deployment.resources" : "",
+    var.reloader_values.high_availability != null ? "reloader.enableHA" : "",
+    var.reloader_values.service_monitor != null ? "reloader.serviceMonitor" : "",
+    var.reloader_values.rbac != null ? "reloader.rbac.enabled" : "",
+  ])
+
+  # keys of reloader_custom_values, flattened in the dot notation of the helm set up to the depth of the keys set by the module
+  reloader_custom_values_level_1 = try(merge(yamldecode(var.reloader_custom_values)), {})
+  reloader_custom_values_level_2 = merge([for key, value in local.reloader_custom_values_level_1 : try({ for child, child_value in value : "${key}.${child}" => child_value }, { (key) = value })]...)
+  reloader_custom_values_level_3 = merge([for key, value in local.reloader_custom_values_level_2 : try({ for child, child_value in value : "${key}.${child}" => child_value }, { (key) = value })]...)
+  reloader_custom_values_level_4 = merge([for key, value in local.reloader_custom_values_level_3 : try({ for child, child_value in value : "${key}.${child}" => child_value }, { (key) = value })]...)
+  reloader_custom_values_keys    = keys(local.reloader_custom_values_level_4)
+  # keys of reloader_custom_values overridden by the module, through the helm set or reloader_values
+  reloader_custom_values_overrides = sort(distinct([
+    for key in concat([for entry in flatten(helm_release.pod_reloader[*].set) : entry.name], local.reloader_values_keys) : key
+    if anytrue([for custom_key in local.reloader_custom_values_keys : custom_key == key || startswith(custom_key, "${key}.") || startswith(key, "${custom_key}.")])
+  ]))
 }
 
 resource "helm_release" "pod_reloader" {
-  depends_on = [module.eso_namespace, data.kubernetes_namespace_v1.existing_eso_namespace]
-  count      = var.reloader_deployed == true ? 1 : 0
-  name       = "reloader"
-  chart      = "reloader"
-  namespace  = local.eso_namespace
-  repository = var.reloader_chart_location
-  version    = var.reloader_chart_version
-  wait       = true
-  atomic     = var.rollback_on_failure
+  depends_on          = [module.eso_namespace, data.kubernetes_namespace_v1.existing_eso_namespace]
+  count               = var.reloader_deployed == true ? 1 : 0
+  name                = "reloader"
+  chart               = "reloader"
+  namespace           = local.eso_namespace
+  repository          = var.reloader_chart_location
+  repository_username = try(var.reloader_chart_repository_credentials.username, null)
+  repository_password = try(var.reloader_chart_repository_credentials.password, null)
+  version             = var.reloader_chart_version
+  timeout             = local.helm_timeout
+  atomic              = local.helm_atomic
+  wait                = var.helm_release_settings.wait
+  wait_for_jobs       = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail     = var.helm_release_settings.cleanup_on_fail
+  max_history         = var.helm_release_settings.max_history
 
   set = concat([
     {
       name  = "image.repository"
       type  = "string"
-      value = var.reloader_image
+      value = local.reloader_image
     },
     {
       name  = "image.tag"
@@ -276,7 +500,7 @@ resource "helm_release" "pod_reloader" {
     # Set watchGlobally based on conditions
     {
       name  = "reloader.watchGlobally"
-      value = var.reloader_namespaces_selector == null && var.reloader_resource_label_selector == null ? true : false
+      value = local.reloader_watch_globally
     },
     # Set ignoreSecrets and ignoreConfigMaps
     {
@@ -308,6 +532,11 @@ resource "helm_release" "pod_reloader" {
     {
       name  = "reloader.syncAfterRestart"
       value = var.reloader_sync_after_restart
+    },
+    # Set the reload of the workloads without annotation
+    {
+      name  = "reloader.autoReloadAll"
+      value = var.reloader_auto_reload_all
     }
     ],
     # Set namespaces to ignore
@@ -316,11 +545,13 @@ resource "helm_release" "pod_reloader" {
     local.reloader_resources_to_ignore,
     # Set runAsUser to null if isOpenShift is true
     local.reloader_is_openshift,
-    local.reloader_log_format
+    local.reloader_log_format,
+    # Set the custom annotation keys
+    local.reloader_custom_annotations
   )
 
   # Set the values attribute conditionally
-  values = [var.reloader_custom_values != null ? var.reloader_custom_values : "", length(var.reloader_image_pull_secrets) > 0 ? yamlencode({
+  values = [var.reloader_custom_values != null ? var.reloader_custom_values : "", length(local.reloader_values) > 0 ? yamlencode({ reloader = local.reloader_values }) : "", length(var.reloader_image_pull_secrets) > 0 ? yamlencode({
     global = {
       imagePullSecrets = [
         for secret in var.reloader_image_pull_secrets :
@@ -330,3 +561,110 @@ resource "helm_release" "pod_reloader" {
       ]
   } }) : ""]
 }
+
+##############################################################################
+# ESO scoped installations
+##############################################################################
+
+# additional controllers, each one processing only the stores of its controller class, sharing the CRDs and the webhook of the main installation
+resource "helm_release" "external_secrets_operator_scoped" {
+  depends_on          = [helm_release.external_secrets_operator]
+  for_each            = var.eso_scoped_installations
+  name                = "external-secrets-${each.key}"
+  namespace           = coalesce(each.value.namespace, local.eso_namespace)
+  chart               = "external-secrets"
+  version             = var.eso_chart_version
+  timeout             = local.helm_timeout
+  atomic              = local.helm_atomic
+  wait                = var.helm_release_settings.wait
+  wait_for_jobs       = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail     = var.helm_release_settings.cleanup_on_fail
+  max_history         = var.helm_release_settings.max_history
+  repository          = var.eso_chart_location
+  repository_username = try(var.eso_chart_repository_credentials.username, null)
+  repository_password = try(var.eso_chart_repository_credentials.password, null)
+
+  set = concat([{
+    name  = "image.repository"
+    type  = "string"
+    value = local.eso_image
+    },
+    {
+      name  = "image.tag"
+      type  = "string"
+      value = var.eso_image_version
+    },
+    {
+      name  = "concurrent"
+      value = var.concurrent_reconciles
+    },
+    {
+      name  = "controllerClass"
+      type  = "string"
+      value = each.value.controller_class
+    },
+    # CRDs and webhook provided by the main installation
+    {
+      name  = "installCRDs"
+      value = false
+    },
+    {
+      name  = "webhook.create"
+      value = false
+    },
+    {
+      name  = "certController.create"
+      value = false
+    },
+    # Set the namespace processed by the installation and the scope of its RBAC
+    {
+      name  = "scopedNamespace"
+      type  = "string"
+      value = each.value.scoped_namespace
+    },
+    {
+      name  = "scopedRBAC"
+      value = each.value.scoped_rbac
+    }
+    ],
+    # Set the log level and time encoding of the controller
+    local.eso_log[""],
+    # Disable the controllers of the kinds not enabled in eso_features, and of the cluster kinds with scoped RBAC
+    [
+      for flag, enabled in local.eso_process_flags : {
+        name  = flag
+        value = false
+      } if !enabled || (each.value.scoped_rbac && contains(["processClusterStore", "processClusterExternalSecret", "processClusterPushSecret"], flag))
+    ],
+    # Set runAsUser to null if isOpenShift is true
+    local.eso_is_openshift
+  )
+
+  # The following mounts are needed for the CRI based authentication with Trusted Profiles, eso_custom_values apply to
+  # the scoped installations too, their keys set above for the scoped installation being overridden
+  values = [local.eso_helm_release_values_cri, local.eso_helm_release_values_workerselector, var.eso_custom_values != null ? var.eso_custom_values : "", length(var.eso_image_pull_secrets) > 0 ? yamlencode({
+    global = {
+      imagePullSecrets = [
+        for secret in var.eso_image_pull_secrets :
+        {
+          name = secret
+        }
+      ]
+  } }) : ""]
+}
+
+# the keys of eso_custom_values set by the module are silently overridden by the helm set or by the imagePullSecrets values
+check "eso_custom_values_overrides" {
+  assert {
+    condition     = length(local.eso_custom_values_overrides) == 0
+    error_message = "The following keys of eso_custom_values are managed by the module and overridden by the values it sets: ${join(", ", local.eso_custom_values_overrides)}. Set them through the related ESO input variables instead."
+  }
+}
+
+# the keys of reloader_custom_values set by the module are silently overridden by the helm set or by reloader_values
+check "reloader_custom_values_overrides" {
+  assert {
+    condition     = length(local.reloader_custom_values_overrides) == 0
+    error_message = "The following keys of reloader_custom_values are managed by the module and overridden by the values it sets: ${join(", ", local.reloader_custom_values_overrides)}. Set them through the related reloader input variables instead."
+  }
+}
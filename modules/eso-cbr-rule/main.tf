@@ -0,0 +1,75 @@
+### Context-based restrictions resources
+
+data "ibm_iam_account_settings" "iam_account_settings" {
+}
+
+locals {
+  # the zone is created only if at least one VPC or IP address is provided
+  create_zone = length(var.zone_vpc_crns) > 0 || length(var.zone_ip_addresses) > 0
+
+  zone_addresses = concat(
+    [for vpc_crn in var.zone_vpc_crns : { type = "vpc", value = vpc_crn }],
+    [for ip_address in var.zone_ip_addresses : { type = length(regexall("/", ip_address)) > 0 ? "subnet" : length(regexall("-", ip_address)) > 0 ? "ipRange" : "ipAddress", value = ip_address }]
+  )
+
+  # network zones allowed by the rule: the zone created by this module and the existing ones
+  rule_zone_ids = concat(ibm_cbr_zone.zone[*].id, var.existing_zone_ids)
+}
+
+# network zone with the VPCs of the cluster(s) where ESO is running
+resource "ibm_cbr_zone" "zone" {
+  count       = local.create_zone ? 1 : 0
+  name        = var.zone_name
+  account_id  = data.ibm_iam_account_settings.iam_account_settings.account_id
+  description = "Network zone allowed to access the secrets manager instance ${var.secrets_manager_guid} from External Secrets Operator"
+
+  dynamic "addresses" {
+    for_each = local.zone_addresses
+    content {
+      type  = addresses.value["type"]
+      value = addresses.value["value"]
+    }
+  }
+}
+
+# The following rule allows requests to the secrets manager instance only from the network zones
+# above, through the endpoint types listed in endpoint_types
+resource "ibm_cbr_rule" "rule" {
+  description      = var.rule_description != null ? var.rule_description : "Rule to restrict the access to the secrets manager instance ${var.secrets_manager_guid} to the External Secrets Operator network zones"
+  enforcement_mode = var.enforcement_mode
+
+  dynamic "contexts" {
+    for_each = local.rule_zone_ids
+    content {
+      attributes {
+        name  = "networkZoneId"
+        value = contexts.value
+      }
+      dynamic "attributes" {
+        for_each = length(var.endpoint_types) > 0 ? [join(",", var.endpoint_types)] : []
+        content {
+          name  = "endpointType"
+          value = attributes.value
+        }
+      }
+    }
+  }
+
+  resources {
+    attributes {
+      name     = "accountId"
+      value    = data.ibm_iam_account_settings.iam_account_settings.account_id
+      operator = "stringEquals"
+    }
+    attributes {
+      name     = "serviceName"
+      value    = "secrets-manager"
+      operator = "stringEquals"
+    }
+    attributes {
+      name     = "serviceInstance"
+      value    = var.secrets_manager_guid
+      operator = "stringEquals"
+    }
+  }
+}
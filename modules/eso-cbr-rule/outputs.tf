@@ -0,0 +1,18 @@
+##############################################################################
+# Outputs
+##############################################################################
+
+output "zone_id" {
+  value       = length(ibm_cbr_zone.zone) > 0 ? ibm_cbr_zone.zone[0].id : null
+  description = "ID of the network zone created for the External Secrets Operator, null if no zone is created"
+}
+
+output "rule_id" {
+  value       = ibm_cbr_rule.rule.id
+  description = "ID of the context-based restrictions rule on the secrets manager instance"
+}
+
+output "rule_zone_ids" {
+  value       = local.rule_zone_ids
+  description = "IDs of all the network zones allowed by the context-based restrictions rule"
+}
@@ -0,0 +1,79 @@
+variable "secrets_manager_guid" {
+  type        = string
+  description = "Secrets manager instance GUID to restrict the access to with the context-based restrictions rule."
+}
+
+variable "zone_name" {
+  type        = string
+  description = "Name of the network zone to create with the VPCs and IP addresses allowed to access the secrets manager instance. Ignored if both zone_vpc_crns and zone_ip_addresses are empty."
+  default     = "eso-cbr-zone"
+  nullable    = false
+
+  validation {
+    condition     = can(regex("^[a-zA-Z0-9 \\-_]{1,128}$", var.zone_name))
+    error_message = "The zone name can contain only alphanumeric characters, spaces, dashes and underscores, and must be at most 128 characters long."
+  }
+}
+
+variable "zone_vpc_crns" {
+  type        = list(string)
+  description = "The list of CRNs of the VPCs of the clusters where the External Secrets Operator is running, to add to the network zone."
+  default     = []
+  nullable    = false
+
+  validation {
+    condition = alltrue([
+      for vpc_crn in var.zone_vpc_crns : can(regex("^crn:v\\d:(.*:){2}is:(.*:)([aos]\\/[\\w_\\-]+)::vpc:[0-9a-z]{4}-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$", vpc_crn))
+    ])
+    error_message = "The elements of zone_vpc_crns must be valid VPC CRNs."
+  }
+}
+
+variable "zone_ip_addresses" {
+  type        = list(string)
+  description = "The list of IP addresses, IP ranges (`<first>-<last>`) or subnets (CIDR) to add to the network zone, for example the egress IPs of a classic cluster or of the Terraform runtime."
+  default     = []
+  nullable    = false
+}
+
+variable "existing_zone_ids" {
+  type        = list(string)
+  description = "The list of IDs of existing network zones to allow in the context-based restrictions rule, in addition to the zone created by the module."
+  default     = []
+  nullable    = false
+
+  # the zones of the rule are the existing ones and the zone created with the VPCs and IP addresses
+  validation {
+    condition     = length(var.existing_zone_ids) > 0 || length(var.zone_vpc_crns) > 0 || length(var.zone_ip_addresses) > 0
+    error_message = "At least one of existing_zone_ids, zone_vpc_crns or zone_ip_addresses must be set for the rule to allow any access."
+  }
+}
+
+variable "endpoint_types" {
+  type        = list(string)
+  description = "The list of endpoint types allowed by the rule. Possible values are `private`, `public` and `direct`. If empty all the endpoint types are allowed."
+  default     = ["private"]
+  nullable    = false
+
+  validation {
+    condition     = alltrue([for endpoint_type in var.endpoint_types : contains(["private", "public", "direct"], endpoint_type)])
+    error_message = "The elements of endpoint_types must be one of 'private', 'public' or 'direct'."
+  }
+}
+
+variable "enforcement_mode" {
+  type        = string
+  description = "The enforcement mode of the rule. Possible values are `enabled`, `disabled` and `report`. Use `report` to verify the impact of the rule before enabling it."
+  default     = "report"
+
+  validation {
+    condition     = contains(["enabled", "disabled", "report"], var.enforcement_mode)
+    error_message = "The enforcement_mode must be one of 'enabled', 'disabled' or 'report'."
+  }
+}
+
+variable "rule_description" {
+  type        = string
+  description = "Description of the context-based restrictions rule. If null a default description is used."
+  default     = null
+}
@@ -0,0 +1,9 @@
+# OpenShift clusters, both classic and VPC, are detected from the openshift-config namespace, which holds the
+# configuration of every OpenShift cluster, so that the detection doesn't depend on the infrastructure of the cluster
+data "kubernetes_all_namespaces" "cluster" {
+  count = var.is_openshift == null ? 1 : 0
+}
+
+locals {
+  is_openshift = var.is_openshift != null ? var.is_openshift : contains(data.kubernetes_all_namespaces.cluster[0].namespaces, "openshift-config")
+}
@@ -0,0 +1,8 @@
+##############################################################################
+# Outputs
+##############################################################################
+
+output "is_openshift" {
+  value       = local.is_openshift
+  description = "Whether the cluster is a Red Hat OpenShift cluster, detected from its namespaces if is_openshift is null"
+}
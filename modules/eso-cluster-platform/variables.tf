@@ -0,0 +1,5 @@
+variable "is_openshift" {
+  description = "Whether the cluster is a Red Hat OpenShift cluster. If null it is detected from the namespaces of the cluster, set it to skip the detection."
+  type        = bool
+  default     = null
+}
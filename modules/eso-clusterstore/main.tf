@@ -2,15 +2,21 @@ locals {
   helm_raw_chart_name    = "raw"
   helm_raw_chart_version = "0.2.5"
 
+  # helm behaviour of the releases, see helm_release_settings
+  helm_timeout = var.helm_release_settings.timeout != null ? var.helm_release_settings.timeout : 600
+  helm_atomic  = var.helm_release_settings.atomic != null ? var.helm_release_settings.atomic : var.rollback_on_failure
+
   # endpoints definition according to endpoints to use are private or public (var.service_endpoints)
   iam_endpoint                           = "${var.service_endpoints == "private" ? "private." : ""}iam.cloud.ibm.com"
   regional_endpoint                      = var.service_endpoints == "private" ? "private.${var.region}" : var.region
   cluster_store_secrets_manager_endpoint = "${var.clusterstore_secrets_manager_guid}.${local.regional_endpoint}.secrets-manager.appdomain.cloud"
+  # the apikey secret is synced by ESO from the Secrets Manager iam_credentials secret when its ID is provided
+  apikey_rotation = var.eso_authentication == "api_key" && var.clusterstore_secret_apikey_secret_id != null
 }
 
 ### creating secret to store apikey to authenticate on secretsmanager for apikey authentication
 resource "kubernetes_secret_v1" "eso_clusterstore_secret" {
-  count = var.eso_authentication == "api_key" ? 1 : 0
+  count = var.eso_authentication == "api_key" && !local.apikey_rotation ? 1 : 0
   metadata {
     name      = var.clusterstore_secret_name
     namespace = var.eso_namespace #checkov:skip=CKV_K8S_21
@@ -22,26 +28,40 @@ resource "kubernetes_secret_v1" "eso_clusterstore_secret" {
   type = "opaque"
 }
 
+### creating secret with the apikey to bootstrap the cluster secrets store when the apikey is synced by ESO
+# the secret content is owned by the ExternalSecret defined in the cluster secrets store helm release after the creation,
+# so the changes to its data are ignored to avoid restoring the bootstrap apikey after a rotation
+resource "kubernetes_secret_v1" "eso_clusterstore_bootstrap_secret" {
+  count = local.apikey_rotation ? 1 : 0
+  metadata {
+    name      = var.clusterstore_secret_name
+    namespace = var.eso_namespace #checkov:skip=CKV_K8S_21
+  }
 
-### ClusterSecretStore used to connect with SM instance for clusterstore and authentication is through apikey
+  data = {
+    apiKey = var.clusterstore_secret_apikey
+  }
+  type = "opaque"
 
-# define cluster secret store for cluster scope and apikey auth
-resource "helm_release" "cluster_secret_store_apikey" {
-  count     = var.eso_authentication == "api_key" ? 1 : 0
-  name      = "${var.clusterstore_helm_rls_name}-apikey"
-  namespace = var.eso_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
+  lifecycle {
+    ignore_changes = [data, metadata[0].labels, metadata[0].annotations]
+  }
+}
+
+
+### resources of the raw chart releases, rendered as manifests instead of being installed in render-only mode
+locals {
+  # ClusterSecretStore with apikey authentication, with the ExternalSecret syncing the apikey when it is rotated
+  cluster_secret_store_apikey_values = var.eso_authentication != "api_key" ? null : <<-EOF
     resources:
       - apiVersion: external-secrets.io/v1
         kind: ClusterSecretStore
         metadata:
           name: "${var.clusterstore_name}"
         spec:
+%{if var.clusterstore_controller_class != null~}
+          controller: "${var.clusterstore_controller_class}"
+%{endif~}
           provider:
             ibm:
               serviceUrl: "https://${local.cluster_store_secrets_manager_endpoint}"
@@ -52,32 +72,38 @@ resource "helm_release" "cluster_secret_store_apikey" {
                     name: "${var.clusterstore_secret_name}"
                     key: apiKey
                     namespace: "${var.eso_namespace}"
+%{if local.apikey_rotation~}
+      - apiVersion: external-secrets.io/v1
+        kind: ExternalSecret
+        metadata:
+          name: "${var.clusterstore_secret_name}"
+          namespace: "${var.eso_namespace}"
+        spec:
+          refreshInterval: "${var.clusterstore_secret_apikey_refresh_interval}"
+          secretStoreRef:
+            name: "${var.clusterstore_name}"
+            kind: ClusterSecretStore
+          target:
+            name: "${var.clusterstore_secret_name}"
+            creationPolicy: Merge
+          data:
+            - secretKey: apiKey
+              remoteRef:
+                key: "iam_credentials/${var.clusterstore_secret_apikey_secret_id}"
+%{endif~}
     EOF
-  ]
-
-  depends_on = [
-    kubernetes_secret_v1.eso_clusterstore_secret
-  ]
-}
 
-# define cluster secret store for cluster scope and trusted store auth
-# ContainerAuth with CRI based authentication
-resource "helm_release" "cluster_secret_store_tp" {
-  count     = var.eso_authentication == "trusted_profile" ? 1 : 0
-  name      = "${var.clusterstore_helm_rls_name}-tp"
-  namespace = var.eso_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
+  # ClusterSecretStore with trusted profile authentication
+  cluster_secret_store_tp_values = var.eso_authentication != "trusted_profile" ? null : <<-EOF
     resources:
       - apiVersion: external-secrets.io/v1
         kind: ClusterSecretStore
         metadata:
           name: "${var.clusterstore_name}"
         spec:
+%{if var.clusterstore_controller_class != null~}
+          controller: "${var.clusterstore_controller_class}"
+%{endif~}
           provider:
             ibm:
               serviceUrl: "https://${local.cluster_store_secrets_manager_endpoint}"
@@ -87,5 +113,102 @@ resource "helm_release" "cluster_secret_store_tp" {
                   iamEndpoint: "https://${local.iam_endpoint}"
                   tokenLocation: /var/run/secrets/tokens/sa-token
     EOF
+
+  # the resources of the helm releases, as objects
+  resources = flatten([for values in compact([local.cluster_secret_store_apikey_values, local.cluster_secret_store_tp_values]) : yamldecode(values).resources])
+
+  # the manifests of the resources, as YAML documents
+  manifests = join("", [for resource in local.resources : "---\n${yamlencode(resource)}"])
+
+  # values of the helm releases, with the resources annotated to be kept by helm when the release is uninstalled if helm_keep_resources is true
+  helm_keep_annotations = { "helm.sh/resource-policy" = "keep" }
+  helm_values = {
+    for name, values in {
+      cluster_secret_store_apikey = local.cluster_secret_store_apikey_values
+      cluster_secret_store_tp     = local.cluster_secret_store_tp_values
+    } : name => values == null || !var.helm_keep_resources ? values : yamlencode({
+      resources = [for resource in yamldecode(values).resources : merge(resource, { metadata = merge(resource.metadata, { annotations = merge(try(resource.metadata.annotations, null), local.helm_keep_annotations) }) })]
+    })
+  }
+
+  # the resources created by the kubernetes_manifest backend, by kind, namespace and name
+  manifest_resources = { for resource in local.resources : join("/", compact([resource.kind, try(resource.metadata.namespace, null), resource.metadata.name])) => resource }
+}
+
+### ClusterSecretStore used to connect with SM instance for clusterstore and authentication is through apikey
+
+# define cluster secret store for cluster scope and apikey auth
+resource "helm_release" "cluster_secret_store_apikey" {
+  count           = var.eso_authentication == "api_key" && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = "${var.clusterstore_helm_rls_name}-apikey"
+  namespace       = var.eso_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.cluster_secret_store_apikey]
+
+  depends_on = [
+    kubernetes_secret_v1.eso_clusterstore_secret,
+    kubernetes_secret_v1.eso_clusterstore_bootstrap_secret
+  ]
+}
+
+# define cluster secret store for cluster scope and trusted store auth
+# ContainerAuth with CRI based authentication
+resource "helm_release" "cluster_secret_store_tp" {
+  count           = var.eso_authentication == "trusted_profile" && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = "${var.clusterstore_helm_rls_name}-tp"
+  namespace       = var.eso_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.cluster_secret_store_tp]
+}
+
+### creating the resources with kubernetes_manifest instead of helm releases, to have field-level plan diffs
+# the ESO CRDs must be installed in the cluster to plan the resources
+resource "kubernetes_manifest" "resources" {
+  for_each = var.resources_backend == "kubernetes_manifest" && !var.render_only ? local.manifest_resources : {}
+  manifest = each.value
+
+  depends_on = [
+    kubernetes_secret_v1.eso_clusterstore_secret,
+    kubernetes_secret_v1.eso_clusterstore_bootstrap_secret
   ]
 }
+
+### writing the manifests in render-only mode, to be applied by a GitOps tool
+resource "local_file" "manifests" {
+  count           = var.render_only && var.render_output_dir != null ? 1 : 0
+  filename        = "${var.render_output_dir}/${var.clusterstore_helm_rls_name}.yaml"
+  content         = local.manifests
+  file_permission = "0644"
+}
+
+### waiting for the ClusterSecretStore to be ready, as helm returns as soon as the resource is accepted by the API server
+# the check is performed again at each change of the helm release or of the resources
+resource "terraform_data" "wait_for_cluster_store_ready" {
+  count            = var.wait_for_ready ? 1 : 0
+  triggers_replace = concat([for release in concat(helm_release.cluster_secret_store_apikey, helm_release.cluster_secret_store_tp) : release.metadata], [for resource in kubernetes_manifest.resources : resource.manifest])
+
+  provisioner "local-exec" {
+    command     = "${path.module}/../../scripts/wait-for-eso-ready.sh"
+    interpreter = ["/bin/bash", "-c"]
+    environment = {
+      KUBECONFIG    = var.kubeconfig_path
+      RESOURCE_TYPE = "clustersecretstores"
+      RESOURCE_NAME = var.clusterstore_name
+      TIMEOUT       = var.wait_for_ready_timeout
+    }
+  }
+}
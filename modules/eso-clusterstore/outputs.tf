@@ -6,3 +6,20 @@ output "helm_release_cluster_store" {
   value       = var.eso_authentication == "trusted_profile" ? helm_release.cluster_secret_store_tp : helm_release.cluster_secret_store_apikey
   description = "ClusterSecretStore helm release. Returning the helm release for trusted profile or apikey authentication according to the authentication type"
 }
+
+output "manifests" {
+  value       = local.manifests
+  description = "The ClusterSecretStore manifests installed by the helm release, as YAML documents, to be applied by a GitOps tool in render-only mode"
+}
+
+output "kubernetes_manifest_import_ids" {
+  value = {
+    for key, resource in local.manifest_resources : key => join(",", compact([
+      "apiVersion=${resource.apiVersion}",
+      "kind=${resource.kind}",
+      try("namespace=${resource.metadata.namespace}", null),
+      "name=${resource.metadata.name}"
+    ]))
+  }
+  description = "The kubernetes_manifest import IDs of the ClusterSecretStore resources, by resource key. Used to import the resources created by the helm release when switching resources_backend to kubernetes_manifest"
+}
@@ -30,6 +30,32 @@ variable "clusterstore_name" {
   }
 }
 
+variable "clusterstore_controller_class" {
+  description = "Controller class of the ClusterSecretStore, to have it processed only by the ESO installation with the same controller class (see the eso_scoped_installations input of the root module). If null the ClusterSecretStore is processed by all the ESO installations, in the namespaces they watch."
+  type        = string
+  default     = null
+  validation {
+    condition     = var.clusterstore_controller_class == null ? true : trimspace(var.clusterstore_controller_class) != ""
+    error_message = "The clusterstore_controller_class must not be empty, set it to null to have the ClusterSecretStore processed by all the ESO installations."
+  }
+}
+
+variable "eso_features" {
+  description = "The ESO resource kinds enabled in the cluster, from the eso_features output of the root module, to fail the plan if ClusterSecretStores are disabled. If null the check is skipped."
+  type = object({
+    cluster_secret_store    = optional(bool, true)
+    cluster_external_secret = optional(bool, true)
+    push_secret             = optional(bool, true)
+    cluster_push_secret     = optional(bool, true)
+    cluster_generator       = optional(bool, true)
+  })
+  default = null
+  validation {
+    condition     = var.eso_features == null ? true : var.eso_features.cluster_secret_store
+    error_message = "The ClusterSecretStore kind is disabled in the eso_features of the ESO installation: enable cluster_secret_store or create a SecretStore with the eso-secretstore module."
+  }
+}
+
 variable "clusterstore_helm_rls_name" {
   description = "Name of helm release for cluster secrets store"
   type        = string
@@ -42,6 +68,28 @@ variable "rollback_on_failure" {
   default     = true
 }
 
+variable "helm_release_settings" {
+  description = "Helm behaviour of the helm release of the ClusterSecretStore, from the helm_release_settings output of the root module. `timeout` is 600 seconds if null and `atomic` is rollback_on_failure if null. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#helm-release-settings)"
+  type = object({
+    timeout         = optional(number)
+    atomic          = optional(bool)
+    wait            = optional(bool, true)
+    wait_for_jobs   = optional(bool, false)
+    cleanup_on_fail = optional(bool, false)
+    max_history     = optional(number, 0)
+  })
+  default  = {}
+  nullable = false
+  validation {
+    condition     = var.helm_release_settings.timeout == null ? true : var.helm_release_settings.timeout > 0
+    error_message = "The helm_release_settings timeout must be greater than 0."
+  }
+  validation {
+    condition     = var.helm_release_settings.max_history >= 0
+    error_message = "The helm_release_settings max_history must be greater than or equal to 0."
+  }
+}
+
 ##############################################################################
 # Authentication configuration for cluster secrets store that can be one of api_key or trusted_profile
 ##############################################################################
@@ -80,6 +128,23 @@ variable "clusterstore_secret_apikey" {
   }
 }
 
+variable "clusterstore_secret_apikey_secret_id" {
+  type        = string
+  description = "ID of the Secrets Manager iam_credentials secret containing the API key set through clusterstore_secret_apikey. If set, clusterstore_secret_apikey is used only to bootstrap the clusterstore_secret_name secret, whose content is then synced by ESO through an ExternalSecret, so that the API key rotated by Secrets Manager is picked up by the cluster secrets store. The API key must be allowed to read this secret."
+  default     = null
+}
+
+variable "clusterstore_secret_apikey_refresh_interval" {
+  type        = string
+  description = "Refresh interval of the ExternalSecret syncing the API key when clusterstore_secret_apikey_secret_id is set. It must be shorter than the time the previous API key stays valid after a rotation."
+  default     = "1h"
+  nullable    = false
+  validation {
+    condition     = can(regex("^([0-9]+(\\.[0-9]+)?(ms|s|m|h))+$", var.clusterstore_secret_apikey_refresh_interval))
+    error_message = "The refresh interval must be a duration, for example 30m or 1h."
+  }
+}
+
 ####### trusted profile
 
 variable "clusterstore_trusted_profile_name" {
@@ -94,3 +159,76 @@ variable "clusterstore_secrets_manager_guid" {
   type        = string
   description = "Secrets manager instance GUID for cluster secrets store where secrets will be stored or fetched from"
 }
+
+####### readiness gating
+
+variable "wait_for_ready" {
+  type        = bool
+  description = "Set to true to wait, after the helm release is applied, for the ClusterSecretStore to report the Ready condition, failing the apply with the ESO condition reason and message if it is not ready within wait_for_ready_timeout. It requires kubectl to be available where terraform runs and kubeconfig_path to be set."
+  default     = false
+  nullable    = false
+}
+
+variable "wait_for_ready_timeout" {
+  type        = number
+  description = "Number of seconds to wait for the ClusterSecretStore to be ready when wait_for_ready is true."
+  default     = 300
+  nullable    = false
+  validation {
+    condition     = var.wait_for_ready_timeout > 0
+    error_message = "The wait_for_ready_timeout must be greater than 0."
+  }
+}
+
+variable "kubeconfig_path" {
+  type        = string
+  description = "Path of the kubeconfig file used by kubectl to check the ClusterSecretStore readiness. Mandatory if wait_for_ready is true."
+  default     = null
+  validation {
+    condition     = var.wait_for_ready ? var.kubeconfig_path != null : true
+    error_message = "The readiness gating is enabled, therefore kubeconfig_path must be provided."
+  }
+}
+
+####### render-only mode
+
+variable "render_only" {
+  type        = bool
+  description = "Set to true to render the ClusterSecretStore manifests in the `manifests` output instead of installing them with a helm release, for example to have them applied by a GitOps tool such as Argo CD. The Kubernetes secrets holding the apikey are still created by Terraform, not to store the apikey with the manifests."
+  default     = false
+  nullable    = false
+  validation {
+    condition     = var.render_only ? !var.wait_for_ready : true
+    error_message = "The readiness gating can't be enabled in render-only mode, as the manifests are not applied by Terraform."
+  }
+}
+
+variable "render_output_dir" {
+  type        = string
+  description = "Directory where the manifests are written in render-only mode, in the `<clusterstore_helm_rls_name>.yaml` file. If null the manifests are only returned by the `manifests` output."
+  default     = null
+  validation {
+    condition     = var.render_output_dir == null || var.render_only
+    error_message = "The render_output_dir can only be set in render-only mode, with render_only set to true."
+  }
+}
+
+####### resources backend
+
+variable "resources_backend" {
+  type        = string
+  description = "How the ClusterSecretStore resources are created: `helm` to install them with a helm release of the raw chart, `kubernetes_manifest` to create them with kubernetes_manifest resources, showing the changes of each field in the plan. The kubernetes_manifest resources need the ESO CRDs to be installed in the cluster to plan. Ignored in render-only mode."
+  default     = "helm"
+  nullable    = false
+  validation {
+    condition     = contains(["helm", "kubernetes_manifest"], var.resources_backend)
+    error_message = "The value for var.resources_backend must be either helm or kubernetes_manifest."
+  }
+}
+
+variable "helm_keep_resources" {
+  type        = bool
+  description = "Set to true to annotate the resources of the helm release with `helm.sh/resource-policy: keep`, so that they are not deleted when the helm release is uninstalled. Apply it before switching `resources_backend` to `kubernetes_manifest` or `render_only` to true, to move the existing resources without deleting them."
+  default     = false
+  nullable    = false
+}
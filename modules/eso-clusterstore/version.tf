@@ -10,5 +10,9 @@ terraform {
       source  = "hashicorp/helm"
       version = ">= 3.0.0, <4.0.0"
     }
+    local = {
+      source  = "hashicorp/local"
+      version = ">= 2.5.0, <3.0.0"
+    }
   }
 }
@@ -0,0 +1,149 @@
+locals {
+  # reloader annotations of the secret and of the workloads consuming it, according to the reloader mode
+  reloader_secret_annotation_key = var.reloader_watching ? lookup({ auto = var.reloader_annotations.auto, search = var.reloader_annotations.match }, var.reloader_mode, null) : null
+  reloader_secret_annotations    = local.reloader_secret_annotation_key != null ? tomap({ (local.reloader_secret_annotation_key) = "true" }) : tomap({})
+  reloader_workload_annotations = var.reloader_watching ? tomap({
+    auto     = { (var.reloader_annotations.auto) = "true" }
+    search   = { (var.reloader_annotations.search) = "true" }
+    targeted = { (var.reloader_annotations.secret) = var.es_kubernetes_secret_name }
+  })[var.reloader_mode] : tomap({})
+}
+
+# secrets formatting
+locals {
+  is_certificate = contains(["imported_cert", "public_cert", "private_cert"], var.sm_secret_type)
+  is_chain       = length(var.es_container_registry_secrets_chain) > 0
+
+  # public and imported certificates contain the intermediate only if sm_certificate_has_intermediate is true and the certificate is not bundled
+  has_intermediate = var.sm_secret_type != "private_cert" && var.sm_certificate_has_intermediate && !var.sm_certificate_bundle
+
+  # remoteref property for kv, empty to pull all the keys structure
+  kv_property     = var.sm_kv_keyid != null ? var.sm_kv_keyid : var.sm_kv_keypath
+  has_kv_property = local.kv_property != null && local.kv_property != ""
+
+  # kube secret type according to es_kubernetes_secret_type
+  secret_type = lookup({ dockerconfigjson = "kubernetes.io/dockerconfigjson", tls = "kubernetes.io/tls" }, var.es_kubernetes_secret_type, "Opaque")
+
+  # if the scope is namespace the secret store kind is SecretStore while is ClusterSecretStore in all the other cases
+  store_kind = var.eso_store_scope == "namespace" ? "SecretStore" : "ClusterSecretStore"
+
+  # dockerconfigjson auth of es_container_registry
+  docker_auth = merge(
+    {
+      username = var.sm_secret_type == "username_password" ? "{{ .username }}" : "iamapikey"
+      password = var.sm_secret_type == "username_password" ? "{{ .password }}" : "{{ .secretid }}"
+    },
+    var.es_container_registry_email != null ? { email = var.es_container_registry_email } : {}
+  )
+
+  # template data of the secret according to the kube secret and the SM secret types
+  template_data = (
+    local.is_chain ? tomap({
+      ".dockerconfigjson" = jsonencode({
+        auths = {
+          for index, element in var.es_container_registry_secrets_chain : element.es_container_registry => merge(
+            {
+              username = (element.es_container_registry_email == null || element.es_container_registry_email == "") && element.trusted_profile != null && element.trusted_profile != "" && var.sm_secret_type == "trusted_profile" ? element.trusted_profile : "iamapikey"
+              password = "{{ .secretid_${index} }}"
+            },
+            element.es_container_registry_email != null && element.es_container_registry_email != "" ? { email = element.es_container_registry_email } : {}
+          )
+        }
+      })
+    }) :
+    local.is_certificate ? tomap({
+      # the certificate template without intermediate is the one of the ExternalSecrets already deployed, kept to not update them
+      "tls.crt" = local.has_intermediate ? "{{ .certificate }}\n{{ .intermediate }}" : "{{ .certificate}}"
+      "tls.key" = "{{ .private_key }}"
+    }) :
+    var.sm_secret_type == "kv" ? tomap({
+      secret = local.has_kv_property ? "{{ .${local.kv_property} }}" : "{{ .keys }}"
+    }) :
+    var.sm_secret_type == "service_credentials" ? (
+      length(var.sm_service_credentials_mappings) > 0 ? tomap({ for k, v in var.sm_service_credentials_mappings : k => "{{ ${v} }}" }) : tomap({ (var.es_kubernetes_secret_data_key) = "{{ .credentials }}" })
+    ) :
+    var.es_kubernetes_secret_type == "dockerconfigjson" ? tomap({
+      ".dockerconfigjson" = jsonencode({ auths = { (var.es_container_registry) = local.docker_auth } })
+    }) :
+    var.sm_secret_type == "username_password" ? tomap({
+      username = "{{ .username }}"
+      password = "{{ .password }}"
+    }) :
+    tomap({ (var.es_kubernetes_secret_data_key) = "{{ .secretid }}" })
+  )
+
+  # secrets manager data of the ExternalSecret, with a null property to pull the whole secret
+  remote_data = (
+    local.is_chain ? [
+      for index, element in var.es_container_registry_secrets_chain : {
+        secretKey = "secretid_${index}"
+        key       = var.sm_secret_type == "trusted_profile" ? "iam_credentials/${element.sm_secret_id}" : "${var.sm_secret_type}/${element.sm_secret_id}"
+        property  = null
+      }
+    ] :
+    local.is_certificate ? [
+      for property in (local.has_intermediate ? ["certificate", "intermediate", "private_key"] : ["certificate", "private_key"]) : {
+        secretKey = property
+        key       = "${var.sm_secret_type}/${var.sm_secret_id}"
+        property  = property
+      }
+    ] :
+    var.sm_secret_type == "username_password" ? [
+      for property in ["username", "password"] : {
+        secretKey = property
+        key       = "username_password/${var.sm_secret_id}"
+        property  = property
+      }
+    ] :
+    var.sm_secret_type == "kv" ? [{
+      secretKey = local.has_kv_property ? local.kv_property : "keys"
+      key       = "kv/${var.sm_secret_id}"
+      property  = local.has_kv_property ? local.kv_property : null
+    }] :
+    var.sm_secret_type == "service_credentials" ? [{
+      secretKey = "credentials"
+      key       = "service_credentials/${var.sm_secret_id}"
+      property  = null
+    }] :
+    # for the iam_credentials secrets the remoteref is iam_credentials/sm_secret_id, for arbitrary and trusted_profile only sm_secret_id
+    [{
+      secretKey = "secretid"
+      key       = var.sm_secret_type == "iam_credentials" ? "iam_credentials/${var.sm_secret_id}" : var.sm_secret_id
+      property  = null
+    }]
+  )
+
+  # ExternalSecret resource
+  resource = {
+    apiVersion = "external-secrets.io/v1"
+    kind       = "ExternalSecret"
+    metadata = {
+      name      = var.es_kubernetes_secret_name
+      namespace = var.es_kubernetes_namespace
+    }
+    spec = {
+      refreshInterval = var.es_refresh_interval
+      secretStoreRef = {
+        name = var.eso_store_name
+        kind = local.store_kind
+      }
+      target = {
+        name = var.es_kubernetes_secret_name
+        template = {
+          engineVersion = "v2"
+          type          = local.secret_type
+          metadata = {
+            annotations = local.reloader_secret_annotations
+          }
+          data = local.template_data
+        }
+      }
+      data = [
+        for item in local.remote_data : {
+          secretKey = item.secretKey
+          remoteRef = { for name, value in { key = item.key, property = item.property } : name => value if value != null }
+        }
+      ]
+    }
+  }
+}
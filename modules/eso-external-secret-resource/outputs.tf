@@ -0,0 +1,13 @@
+##############################################################################
+# Outputs
+##############################################################################
+
+output "resource" {
+  description = "The ExternalSecret, as an object of the raw chart resources or of a kubernetes_manifest"
+  value       = local.resource
+}
+
+output "reloader_workload_annotations" {
+  description = "The annotations to set on the workloads consuming the secret to have them reloaded on its update, according to `reloader_mode`. Empty if `reloader_watching` is false"
+  value       = local.reloader_workload_annotations
+}
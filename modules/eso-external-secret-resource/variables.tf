@@ -0,0 +1,143 @@
+variable "es_kubernetes_namespace" {
+  description = "Namespace of the ExternalSecret and of the secret it generates"
+  type        = string
+}
+
+variable "es_kubernetes_secret_name" {
+  description = "Name of the ExternalSecret and of the secret it generates"
+  type        = string
+}
+
+variable "es_refresh_interval" {
+  description = "Refresh interval of the ExternalSecret"
+  type        = string
+  default     = "1h"
+  nullable    = false
+}
+
+variable "eso_store_name" {
+  description = "Name of the store referenced by the ExternalSecret"
+  type        = string
+}
+
+variable "eso_store_scope" {
+  description = "Scope of the store referenced by the ExternalSecret: 'cluster' for a ClusterSecretStore or 'namespace' for a SecretStore"
+  type        = string
+  default     = "cluster"
+  nullable    = false
+}
+
+variable "es_kubernetes_secret_type" {
+  description = "Type of the secret generated by the ExternalSecret: `opaque`, `dockerconfigjson` or `tls`. The secret is opaque if empty"
+  type        = string
+}
+
+variable "es_kubernetes_secret_data_key" {
+  description = "Data key of the value of the arbitrary, iam_credentials and trusted_profile secrets, and of the service_credentials secrets without mappings, in the generated secret if it isn't a dockerconfigjson secret"
+  type        = string
+  default     = null
+  validation {
+    condition = (
+      var.es_kubernetes_secret_data_key != null ||
+      length(var.es_container_registry_secrets_chain) > 0 ||
+      (contains(["arbitrary", "iam_credentials", "trusted_profile"], var.sm_secret_type) && var.es_kubernetes_secret_type == "dockerconfigjson") ||
+      (var.sm_secret_type == "service_credentials" && length(var.sm_service_credentials_mappings) > 0) ||
+      !contains(["arbitrary", "iam_credentials", "trusted_profile", "service_credentials"], var.sm_secret_type)
+    )
+    error_message = "A value for 'es_kubernetes_secret_data_key' must be set when 'sm_secret_type' is 'arbitrary', 'iam_credentials' or 'trusted_profile' and the secret is not a dockerconfigjson secret, or when 'sm_secret_type' is 'service_credentials' without mappings."
+  }
+}
+
+variable "sm_secret_type" {
+  description = "Type of the Secrets Manager secret synced by the ExternalSecret: 'iam_credentials', 'username_password', 'trusted_profile', 'arbitrary', 'service_credentials', 'imported_cert', 'public_cert', 'private_cert' or 'kv'"
+  type        = string
+}
+
+variable "sm_secret_id" {
+  description = "ID of the Secrets Manager secret synced by the ExternalSecret, null for a dockerconfigjson secrets chain"
+  type        = string
+  default     = null
+}
+
+variable "sm_kv_keyid" {
+  description = "Key ID of the kv secret to sync, the whole keys structure being synced if neither sm_kv_keyid nor sm_kv_keypath is set"
+  type        = string
+  default     = null
+}
+
+variable "sm_kv_keypath" {
+  description = "Key path of the kv secret to sync, used if sm_kv_keyid is not set"
+  type        = string
+  default     = null
+}
+
+variable "sm_certificate_has_intermediate" {
+  description = "Whether the public and imported certificates are provided with an intermediate certificate, added to the certificate of the generated secret if the certificate is not bundled"
+  type        = bool
+  default     = true
+  nullable    = false
+}
+
+variable "sm_certificate_bundle" {
+  description = "Whether the public and imported certificates are bundled with the intermediate certificate"
+  type        = bool
+  default     = true
+  nullable    = false
+}
+
+variable "sm_service_credentials_mappings" {
+  description = "Map of the keys of the generated secret to the ESO template expressions evaluated against the service credentials, the whole service credentials being synced in es_kubernetes_secret_data_key if empty"
+  type        = map(string)
+  default     = {}
+  nullable    = false
+}
+
+variable "es_container_registry" {
+  description = "Registry of the dockerconfigjson secret"
+  type        = string
+  default     = "us.icr.io"
+}
+
+variable "es_container_registry_email" {
+  description = "Email of the dockerconfigjson secret, not set if null"
+  type        = string
+  default     = null
+}
+
+variable "es_container_registry_secrets_chain" {
+  description = "Registries of a dockerconfigjson secrets chain, with the ID of the secret of each registry"
+  type = list(object({
+    es_container_registry       = string
+    sm_secret_id                = string
+    es_container_registry_email = optional(string, null)
+    trusted_profile             = optional(string, null)
+  }))
+  default  = []
+  nullable = false
+}
+
+variable "reloader_watching" {
+  description = "Whether the generated secret is annotated to be watched by the reloader, according to reloader_mode"
+  type        = bool
+  default     = false
+  nullable    = false
+}
+
+variable "reloader_mode" {
+  description = "How the secret is annotated for the reloader when reloader_watching is true: `auto`, `search` or `targeted`"
+  type        = string
+  default     = "auto"
+  nullable    = false
+}
+
+variable "reloader_annotations" {
+  description = "The annotation keys used by the reloader: `auto`, `search`, `match` and `secret`"
+  type = object({
+    auto   = optional(string, "reloader.stakater.com/auto")
+    search = optional(string, "reloader.stakater.com/search")
+    match  = optional(string, "reloader.stakater.com/match")
+    secret = optional(string, "secret.reloader.stakater.com/reload")
+  })
+  default  = {}
+  nullable = false
+}
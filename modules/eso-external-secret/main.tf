@@ -1,92 +1,18 @@
-locals {
-  # reloader annotation
-  reloader_annotation = var.reloader_watching ? "'reloader.stakater.com/auto': 'true'" : "{}"
-}
-
 # secrets formatting
 locals {
-  # certificate secret templates and management
+  # certificate secret templates and management
   is_certificate = can(regex("^imported_cert$|^public_cert$|^private_cert$", var.sm_secret_type))
 
   # dockerjsonconfig secrets chain flag
   is_dockerjsonconfig_chain = length(var.es_container_registry_secrets_chain) > 0 ? true : false
 
-  # for certificate secrets public_cert and private_cert the id is the last part of the sm_secret_sm
-  cert_remoteref_key = local.is_certificate ? "${var.sm_secret_type}/${var.sm_secret_id}" : ""
-  # defining the template data structure according to the type of certificate
-  # public and imported certificate template will contain intermediate field only if sm_certificate_has_intermediate flag is true and the certificate bundle flag is disabled
-  public_cert_tls_template_data   = (var.sm_certificate_has_intermediate == true && var.sm_certificate_bundle == false) ? "tls.crt: \"{{ .certificate }}\\n{{ .intermediate }}\"\n            tls.key: '{{ .private_key }}'" : "tls.crt: '{{ .certificate}}'\n            tls.key: '{{ .private_key }}'"
-  imported_cert_tls_template_data = (var.sm_certificate_has_intermediate == true && var.sm_certificate_bundle == false) ? "tls.crt: \"{{ .certificate }}\\n{{ .intermediate }}\"\n            tls.key: '{{ .private_key }}'" : "tls.crt: '{{ .certificate}}'\n            tls.key: '{{ .private_key }}'"
-  private_cert_tls_template_data  = "tls.crt: '{{ .certificate}}'\n            tls.key: '{{ .private_key }}'"
-  # defining the spec data structure according to the type of certificate
-  # public and imported certificate template will contain intermediate field only if sm_certificate_has_intermediate flag is true
-  public_certificate_spec_data   = (var.sm_certificate_has_intermediate == true && var.sm_certificate_bundle == false) ? "- secretKey: certificate\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: certificate\n      - secretKey: intermediate\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: intermediate\n      - secretKey: private_key\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: private_key" : "- secretKey: certificate\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: certificate\n      - secretKey: private_key\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: private_key"
-  imported_certificate_spec_data = (var.sm_certificate_has_intermediate == true && var.sm_certificate_bundle == false) ? "- secretKey: certificate\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: certificate\n      - secretKey: intermediate\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: intermediate\n      - secretKey: private_key\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: private_key" : "- secretKey: certificate\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: certificate\n      - secretKey: private_key\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: private_key"
-  private_certificate_spec_data  = "- secretKey: certificate\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: certificate\n      - secretKey: private_key\n        remoteRef:\n          key: ${local.cert_remoteref_key}\n          property: private_key"
-  # defining the right structure to use according to the certificate type
-  certificate_template  = local.is_certificate ? (var.sm_secret_type == "public_cert" ? local.public_cert_tls_template_data : (var.sm_secret_type == "imported_cert" ? local.imported_cert_tls_template_data : (var.sm_secret_type == "private_cert" ? local.private_cert_tls_template_data : ""))) : "" # checkov:skip=CKV_SECRET_6: does not require high entropy string as is static value
-  certificate_spec_data = local.is_certificate ? (var.sm_secret_type == "public_cert" ? local.public_certificate_spec_data : (var.sm_secret_type == "imported_cert" ? local.imported_certificate_spec_data : (var.sm_secret_type == "private_cert" ? local.private_certificate_spec_data : ""))) : ""    # checkov:skip=CKV_SECRET_6: does not require high entropy string as is static value
-
-  # dockerjson format
-  docker_user     = var.sm_secret_type == "username_password" ? "{{ .username }}" : "iamapikey" # checkov:skip=CKV_SECRET_6: does not require high entropy string as is static value
-  docker_password = var.sm_secret_type == "username_password" ? "{{ .password }}" : "{{ .secretid }}"
-
-  # setting data_type according to the kube secret and the SM secret types
-  # if kube secret type is opaque && SM secret type arbitrary or iam_credentials -> var.es_kubernetes_secret_data_key
-  # if kube secret type is opaque && SM secret type username_password -> data_type = .dockerconfigjson
-  # if kube secret type is opaque && SM secret type != username_password arbitrary and iam_credentials (so kv or the certificate types) -> not setting anything here but handled in related sections
-  # if kube secret type is not opaque && kube secret type is dockerconfigjson -> data_type =  .dockerconfigjson
-  # if kube secret type is not opaque && if kube secret type is not dockerconfigjson -> not setting here
-  data_type = var.es_kubernetes_secret_type == "opaque" ? ((var.sm_secret_type == "arbitrary" || var.sm_secret_type == "iam_credentials") ? var.es_kubernetes_secret_data_key : (var.sm_secret_type == "username_password") ? ".dockerconfigjson" : "") : (var.es_kubernetes_secret_type == "dockerconfigjson" ? ".dockerconfigjson" : "")
-
-  # setting data_payload for dockerconfigjson according to the value of var.es_container_registry_email
-  # if es_kubernetes_secret_type = dockerconfigjson -> setting payload according to the fields available
-  # if es_kubernetes_secret_type != dockerconfigjson -> data_payload = {{ .secretid }}
-  data_payload = var.es_kubernetes_secret_type == "dockerconfigjson" && var.es_container_registry_email != null ? jsonencode({ "auths" : { (var.es_container_registry) : { "email" : (var.es_container_registry_email), "username" : (local.docker_user), "password" : (local.docker_password) } } }) : (var.es_kubernetes_secret_type == "dockerconfigjson" && var.es_container_registry_email == null ? jsonencode({ "auths" : { (var.es_container_registry) : { "username" : (local.docker_user), "password" : (local.docker_password) } } }) : "{{ .secretid }}") # checkov:skip=CKV_SECRET_6:does not require high entropy string as is static value
-
-  # final data field format according to the secret type
-  # only in the case sm_secret_type is username_password and kube secret type is opaque -> data = username : '{{ .username }}'\n            password : '{{ .password }}
-  # in all the other cases data is the resulting data_type : data_payload
-  username_password_opaque_data = "username : '{{ .username }}'\n            password : '{{ .password }}'"
-  data                          = var.sm_secret_type == "username_password" && var.es_kubernetes_secret_type == "opaque" ? local.username_password_opaque_data : "${local.data_type} : '${local.data_payload}'" # checkov:skip=CKV_SECRET_6: does not require high entropy string as is static value
-
-  # setting value for template type field according to the var.es_kubernetes_secret_type value
-  es_kubernetes_secret_type = var.es_kubernetes_secret_type == "dockerconfigjson" ? "kubernetes.io/dockerconfigjson" : (var.es_kubernetes_secret_type == "tls" ? "kubernetes.io/tls" : "Opaque")
-
-  # setting remote_ref field value according to the secret type
-  # for sm secrets types iam_credentials and kv the remoteref is sm_secret_type/sm_secret_id, for arbitrary is only sm_secret_id
-  # if is_dockerjsonconfig_chain is true it is set to empty as not used
-  es_remoteref_key = local.is_dockerjsonconfig_chain == false ? (var.sm_secret_type == "iam_credentials" || var.sm_secret_type == "kv" ? "${var.sm_secret_type}/${var.sm_secret_id}" : var.sm_secret_id) : "" # checkov:skip=CKV_SECRET_6: does not require high entropy string as is static value
-
-  # dockerconfigjson config for chain of secrets - building a map for all the registries
-  data_payload_chain_map = local.is_dockerjsonconfig_chain == true ? {
-    "auths" : {
-      for index, element in var.es_container_registry_secrets_chain :
-      element.es_container_registry => (element.es_container_registry_email != null && element.es_container_registry_email != "") ?
-      {
-        "username" : "iamapikey", "password" : "{{ .secretid_${index} }}", "email" : (element.es_container_registry_email)
-      }
-      :
-      (element.trusted_profile != null && element.trusted_profile != "" && var.sm_secret_type == "trusted_profile") ?
-      {
-        "username" : element.trusted_profile, "password" : "{{ .secretid_${index} }}"
-      } :
-      {
-        "username" : "iamapikey", "password" : "{{ .secretid_${index} }}"
-      }
-    }
-  } : {}
-
-  # in order to have the content correctly mapped it needs to apply jsonencode twice
-  encodedchain = jsonencode(jsonencode(local.data_payload_chain_map))
-  data_chain   = ".dockerconfigjson : ${local.encodedchain}"
-
   # helm chart details
   helm_raw_chart_name    = "raw"
   helm_raw_chart_version = "0.2.5"
 
-  # if the scope is namespace the secret store kind is SecretStore while is ClusterSecretStore in all the other cases
-  secret_store_ref_kind = var.eso_store_scope != "namespace" ? "ClusterSecretStore" : "SecretStore"
+  # helm behaviour of the releases, see helm_release_settings
+  helm_timeout = var.helm_release_settings.timeout != null ? var.helm_release_settings.timeout : 600
+  helm_atomic  = var.helm_release_settings.atomic != null ? var.helm_release_settings.atomic : var.rollback_on_failure
 
   # if var.es_helm_rls_namespace is not set the namespace is set to es_kubernetes_namespace (default logic)
   es_helm_rls_namespace = var.es_helm_rls_namespace != null ? var.es_helm_rls_namespace : var.es_kubernetes_namespace
@@ -101,297 +27,209 @@ locals {
   helm_secret_name = substr(join("-", [var.es_kubernetes_namespace, var.es_helm_rls_name]), 0, 52)
 }
 
+### the ExternalSecret, rendered as the eso-external-secrets-batch module does. No ExternalSecret is created if sm_secret_type is empty
+module "external_secret_resource" {
+  count                               = var.sm_secret_type != "" ? 1 : 0
+  source                              = "../eso-external-secret-resource"
+  es_kubernetes_namespace             = var.es_kubernetes_namespace
+  es_kubernetes_secret_name           = var.es_kubernetes_secret_name
+  es_refresh_interval                 = var.es_refresh_interval
+  eso_store_name                      = var.eso_store_name
+  eso_store_scope                     = var.eso_store_scope
+  es_kubernetes_secret_type           = var.es_kubernetes_secret_type
+  es_kubernetes_secret_data_key       = var.es_kubernetes_secret_data_key
+  sm_secret_type                      = var.sm_secret_type
+  sm_secret_id                        = var.sm_secret_id
+  sm_kv_keyid                         = var.sm_kv_keyid
+  sm_kv_keypath                       = var.sm_kv_keypath
+  sm_certificate_has_intermediate     = var.sm_certificate_has_intermediate
+  sm_certificate_bundle               = var.sm_certificate_bundle
+  sm_service_credentials_mappings     = var.sm_service_credentials_mappings
+  es_container_registry               = var.es_container_registry
+  es_container_registry_email         = var.es_container_registry_email
+  es_container_registry_secrets_chain = var.es_container_registry_secrets_chain
+  reloader_watching                   = var.reloader_watching
+  reloader_mode                       = var.reloader_mode
+  reloader_annotations                = var.reloader_annotations
+}
+
+### resources of the raw chart releases, rendered as manifests instead of being installed in render-only mode
+locals {
+  # annotations of the workloads consuming the secret
+  reloader_workload_annotations = try(module.external_secret_resource[0].reloader_workload_annotations, {})
+
+  # the helm release creating the ExternalSecret according to the secret type, each type having its own release
+  helm_releases = {
+    kubernetes_secret                     = (var.sm_secret_type == "iam_credentials" || var.sm_secret_type == "arbitrary" || var.sm_secret_type == "trusted_profile") && local.is_dockerjsonconfig_chain == false
+    kubernetes_secret_chain_list          = local.is_dockerjsonconfig_chain == true
+    kubernetes_secret_user_pw             = var.sm_secret_type == "username_password"
+    kubernetes_secret_certificate         = local.is_certificate
+    kubernetes_secret_kv_key              = local.is_kv && local.kv_remoteref_property != ""
+    kubernetes_secret_kv_all              = local.is_kv && local.kv_remoteref_property == ""
+    kubernetes_secret_service_credentials = var.sm_secret_type == "service_credentials"
+  }
+
+  # the resources of the helm releases, as objects
+  resources = module.external_secret_resource[*].resource
+
+  # the manifests of the resources, as YAML documents
+  manifests = join("", [for resource in local.resources : "---\n${yamlencode(resource)}"])
+
+  # values of the helm releases, with the resources annotated to be kept by helm when the release is uninstalled if helm_keep_resources is true
+  helm_keep_annotations = { "helm.sh/resource-policy" = "keep" }
+  helm_values = {
+    for name, enabled in local.helm_releases : name => !enabled ? null : yamlencode({
+      resources = [for resource in local.resources : !var.helm_keep_resources ? resource : merge(resource, { metadata = merge(resource.metadata, { annotations = local.helm_keep_annotations }) })]
+    })
+  }
+
+  # the resources created by the kubernetes_manifest backend, by kind, namespace and name
+  manifest_resources = { for resource in local.resources : join("/", compact([resource.kind, try(resource.metadata.namespace, null), resource.metadata.name])) => resource }
+}
+
 ### Define kubernetes secret to be installed in cluster for sm_secret_type iam_credentials or arbitrary
 resource "helm_release" "kubernetes_secret" {
-  count     = (var.sm_secret_type == "iam_credentials" || var.sm_secret_type == "arbitrary" || var.sm_secret_type == "trusted_profile") && local.is_dockerjsonconfig_chain == false ? 1 : 0
-  name      = local.helm_secret_name
-  namespace = local.es_helm_rls_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
-    resources:
-      - apiVersion: external-secrets.io/v1
-        kind: ExternalSecret
-        metadata:
-          name: "${var.es_kubernetes_secret_name}"
-          namespace: "${var.es_kubernetes_namespace}"
-        spec:
-          refreshInterval: ${var.es_refresh_interval}
-          secretStoreRef:
-            name: "${var.eso_store_name}"
-            kind: "${local.secret_store_ref_kind}"
-          target:
-            name: "${var.es_kubernetes_secret_name}"
-            template:
-              engineVersion: v2
-              type: "${local.es_kubernetes_secret_type}"
-              metadata:
-                annotations:
-                  ${local.reloader_annotation}
-              data:
-                ${local.data}
-          data:
-          - secretKey: secretid
-            remoteRef:
-              key: "${local.es_remoteref_key}"
-    EOF
-  ]
+  count           = local.helm_releases.kubernetes_secret && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = local.helm_secret_name
+  namespace       = local.es_helm_rls_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.kubernetes_secret]
 }
 
 ### Define kubernetes secret to be installed in cluster for sm_secret_type iam_credentials and kubernetes secret type dockerjsonconfig and configured with a chain of secrets
 resource "helm_release" "kubernetes_secret_chain_list" {
-  count     = local.is_dockerjsonconfig_chain == true ? 1 : 0
-  name      = local.helm_secret_name
-  namespace = local.es_helm_rls_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
-    resources:
-      - apiVersion: external-secrets.io/v1
-        kind: ExternalSecret
-        metadata:
-          name: "${var.es_kubernetes_secret_name}"
-          namespace: "${var.es_kubernetes_namespace}"
-        spec:
-          refreshInterval: ${var.es_refresh_interval}
-          secretStoreRef:
-            name: "${var.eso_store_name}"
-            kind: "${local.secret_store_ref_kind}"
-          target:
-            name: "${var.es_kubernetes_secret_name}"
-            template:
-              engineVersion: v2
-              type: "${local.es_kubernetes_secret_type}"
-              metadata:
-                annotations:
-                  ${local.reloader_annotation}
-              data:
-                ${local.data_chain}
-          data:
-%{for index, element in var.es_container_registry_secrets_chain~}
-          - secretKey: secretid_${index}
-            remoteRef:
-              key: "${var.sm_secret_type == "trusted_profile" ? "iam_credentials/${element.sm_secret_id}" : "${var.sm_secret_type}/${element.sm_secret_id}"}"
-%{endfor~}
-    EOF
-  ]
+  count           = local.helm_releases.kubernetes_secret_chain_list && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = local.helm_secret_name
+  namespace       = local.es_helm_rls_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.kubernetes_secret_chain_list]
 }
 
 
 ### Define kubernetes secret to be installed in cluster for opaque secret type based on SM user credential secret type
 resource "helm_release" "kubernetes_secret_user_pw" {
-  count     = var.sm_secret_type == "username_password" ? 1 : 0
-  name      = local.helm_secret_name
-  namespace = var.es_kubernetes_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
-    resources:
-      - apiVersion: external-secrets.io/v1
-        kind: ExternalSecret
-        metadata:
-          name: "${var.es_kubernetes_secret_name}"
-          namespace: "${var.es_kubernetes_namespace}"
-        spec:
-          refreshInterval: ${var.es_refresh_interval}
-          secretStoreRef:
-            name: "${var.eso_store_name}"
-            kind: "${local.secret_store_ref_kind}"
-          target:
-            name: "${var.es_kubernetes_secret_name}"
-            template:
-              engineVersion: v2
-              type: "${local.es_kubernetes_secret_type}"
-              metadata:
-                annotations:
-                  ${local.reloader_annotation}
-              data:
-                ${local.data}
-          data:
-          - secretKey: username
-            remoteRef:
-              key: "username_password/${var.sm_secret_id}"
-              property: username
-          - secretKey: password
-            remoteRef:
-              key: "username_password/${var.sm_secret_id}"
-              property: password
-    EOF
-  ]
+  count           = local.helm_releases.kubernetes_secret_user_pw && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = local.helm_secret_name
+  namespace       = var.es_kubernetes_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.kubernetes_secret_user_pw]
 }
 
 ### Define kubernetes secret to be installed in cluster for certificate secret based on SM certificate secret type
 resource "helm_release" "kubernetes_secret_certificate" {
-  count     = local.is_certificate ? 1 : 0 #checkov:skip=CKV_SECRET_6
-  name      = local.helm_secret_name
-  namespace = var.es_kubernetes_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
-    resources:
-      - apiVersion: external-secrets.io/v1
-        kind: ExternalSecret
-        metadata:
-          name: "${var.es_kubernetes_secret_name}"
-          namespace: "${var.es_kubernetes_namespace}"
-        spec:
-          refreshInterval: ${var.es_refresh_interval}
-          secretStoreRef:
-            name: "${var.eso_store_name}"
-            kind: "${local.secret_store_ref_kind}"
-          target:
-            name: "${var.es_kubernetes_secret_name}"
-            template:
-              engineVersion: v2
-              type: "${local.es_kubernetes_secret_type}"
-              metadata:
-                annotations:
-                  ${local.reloader_annotation}
-              data:
-                ${local.certificate_template}
-          data:
-          ${local.certificate_spec_data}
-    EOF
-  ]
+  count           = local.helm_releases.kubernetes_secret_certificate && !var.render_only && var.resources_backend == "helm" ? 1 : 0 #checkov:skip=CKV_SECRET_6
+  name            = local.helm_secret_name
+  namespace       = var.es_kubernetes_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.kubernetes_secret_certificate]
 }
 
 ### Define kubernetes secret to be installed in cluster for key-value secret based on SM kv secret type based on keyid or key path
 resource "helm_release" "kubernetes_secret_kv_key" {
-  count     = local.is_kv && local.kv_remoteref_property != "" ? 1 : 0
-  name      = local.helm_secret_name
-  namespace = var.es_kubernetes_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
-    resources:
-      - apiVersion: external-secrets.io/v1
-        kind: ExternalSecret
-        metadata:
-          name: "${var.es_kubernetes_secret_name}"
-          namespace: "${var.es_kubernetes_namespace}"
-        spec:
-          refreshInterval: ${var.es_refresh_interval}
-          secretStoreRef:
-            name: "${var.eso_store_name}"
-            kind: "${local.secret_store_ref_kind}"
-          target:
-            name: "${var.es_kubernetes_secret_name}"
-            template:
-              engineVersion: v2
-              type: "${local.es_kubernetes_secret_type}"
-              metadata:
-                annotations:
-                  ${local.reloader_annotation}
-              data:
-                secret: "{{ .${local.kv_remoteref_property} }}"
-          data:
-          - secretKey: "${local.kv_remoteref_property}"
-            remoteRef:
-              key: "${local.es_remoteref_key}"
-              property: "${local.kv_remoteref_property}"
-    EOF
-  ]
+  count           = local.helm_releases.kubernetes_secret_kv_key && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = local.helm_secret_name
+  namespace       = var.es_kubernetes_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.kubernetes_secret_kv_key]
 }
 
 ### Define kubernetes secret to be installed in cluster for key-value secret based on SM kv secret type pulling all the keys structure
 resource "helm_release" "kubernetes_secret_kv_all" {
-  count     = local.is_kv && local.kv_remoteref_property == "" ? 1 : 0
-  name      = local.helm_secret_name
-  namespace = var.es_kubernetes_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
-    resources:
-      - apiVersion: external-secrets.io/v1
-        kind: ExternalSecret
-        metadata:
-          name: "${var.es_kubernetes_secret_name}"
-          namespace: "${var.es_kubernetes_namespace}"
-        spec:
-          refreshInterval: ${var.es_refresh_interval}
-          secretStoreRef:
-            name: "${var.eso_store_name}"
-            kind: "${local.secret_store_ref_kind}"
-          target:
-            name: "${var.es_kubernetes_secret_name}"
-            template:
-              engineVersion: v2
-              type: "${local.es_kubernetes_secret_type}"
-              metadata:
-                annotations:
-                  ${local.reloader_annotation}
-              data:
-                secret: '{{ .keys }}'
-          data:
-          - secretKey: keys
-            remoteRef:
-              key: "${local.es_remoteref_key}"
-    EOF
-  ]
+  count           = local.helm_releases.kubernetes_secret_kv_all && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = local.helm_secret_name
+  namespace       = var.es_kubernetes_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.kubernetes_secret_kv_all]
 }
 
 resource "helm_release" "kubernetes_secret_service_credentials" {
-  count     = var.sm_secret_type == "service_credentials" ? 1 : 0
-  name      = local.helm_secret_name
-  namespace = local.es_helm_rls_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
+  count           = local.helm_releases.kubernetes_secret_service_credentials && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = local.helm_secret_name
+  namespace       = local.es_helm_rls_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+
+  values = [local.helm_values.kubernetes_secret_service_credentials]
+}
 
-  values = [
-    <<-EOF
-    resources:
-      - apiVersion: external-secrets.io/v1
-        kind: ExternalSecret
-        metadata:
-          name: "${var.es_kubernetes_secret_name}"
-          namespace: "${var.es_kubernetes_namespace}"
-        spec:
-          refreshInterval: ${var.es_refresh_interval}
-          secretStoreRef:
-            name: "${var.eso_store_name}"
-            kind: "${local.secret_store_ref_kind}"
+### creating the resources with kubernetes_manifest instead of helm releases, to have field-level plan diffs
+# the ESO CRDs must be installed in the cluster to plan the resources
+resource "kubernetes_manifest" "resources" {
+  for_each = var.resources_backend == "kubernetes_manifest" && !var.render_only ? local.manifest_resources : {}
+  manifest = each.value
+}
 
-          target:
-            name: "${var.es_kubernetes_secret_name}"
-            template:
-              engineVersion: v2
-              type: "${local.es_kubernetes_secret_type}"
-              metadata:
-                annotations:
-                  ${local.reloader_annotation}
-              data:
-%{if length(var.sm_service_credentials_mappings) == 0}
-                ${var.es_kubernetes_secret_data_key}: '{{ .credentials }}'
-%{else}
-%{for k, v in var.sm_service_credentials_mappings~}
-                ${k}: '{{ ${v} }}'
-%{endfor~}
-%{endif}
+### writing the manifests in render-only mode, to be applied by a GitOps tool
+resource "local_file" "manifests" {
+  count           = var.render_only && var.render_output_dir != null ? 1 : 0
+  filename        = "${var.render_output_dir}/${local.helm_secret_name}.yaml"
+  content         = local.manifests
+  file_permission = "0644"
+}
 
-          data:
-          - secretKey: credentials
-            remoteRef:
-              key: "service_credentials/${var.sm_secret_id}"
-    EOF
-  ]
+### waiting for the ExternalSecret to be ready, as helm returns as soon as the resource is accepted by the API server
+# the check is performed again at each change of the helm release or of the resources
+resource "terraform_data" "wait_for_external_secret_ready" {
+  count            = var.wait_for_ready ? 1 : 0
+  triggers_replace = concat([for release in concat(helm_release.kubernetes_secret, helm_release.kubernetes_secret_chain_list, helm_release.kubernetes_secret_user_pw, helm_release.kubernetes_secret_certificate, helm_release.kubernetes_secret_kv_key, helm_release.kubernetes_secret_kv_all, helm_release.kubernetes_secret_service_credentials) : release.metadata], [for resource in kubernetes_manifest.resources : resource.manifest])
+
+  provisioner "local-exec" {
+    command     = "${path.module}/../../scripts/wait-for-eso-ready.sh"
+    interpreter = ["/bin/bash", "-c"]
+    environment = {
+      KUBECONFIG         = var.kubeconfig_path
+      RESOURCE_TYPE      = "externalsecrets"
+      RESOURCE_NAME      = var.es_kubernetes_secret_name
+      RESOURCE_NAMESPACE = var.es_kubernetes_namespace
+      TIMEOUT            = var.wait_for_ready_timeout
+    }
+  }
 }
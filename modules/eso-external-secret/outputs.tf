@@ -1,3 +1,25 @@
 ##############################################################################
 # Outputs
 ##############################################################################
+
+output "reloader_workload_annotations" {
+  description = "The annotations to set on the workloads consuming the secret to have them reloaded on its update, according to `reloader_mode`. Empty if `reloader_watching` is false"
+  value       = local.reloader_workload_annotations
+}
+
+output "manifests" {
+  description = "The ExternalSecret manifests installed by the helm release, as YAML documents, to be applied by a GitOps tool in render-only mode"
+  value       = local.manifests
+}
+
+output "kubernetes_manifest_import_ids" {
+  description = "The kubernetes_manifest import IDs of the ExternalSecret resources, by resource key. Used to import the resources created by the helm release when switching resources_backend to kubernetes_manifest"
+  value = {
+    for key, resource in local.manifest_resources : key => join(",", compact([
+      "apiVersion=${resource.apiVersion}",
+      "kind=${resource.kind}",
+      try("namespace=${resource.metadata.namespace}", null),
+      "name=${resource.metadata.name}"
+    ]))
+  }
+}
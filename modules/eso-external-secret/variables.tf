@@ -9,6 +9,22 @@ variable "eso_store_scope" {
   }
 }
 
+variable "eso_features" {
+  description = "The ESO resource kinds enabled in the cluster, from the eso_features output of the root module, to fail the plan if the ExternalSecret references a ClusterSecretStore (eso_store_scope set to 'cluster') while ClusterSecretStores are disabled. If null the check is skipped."
+  type = object({
+    cluster_secret_store    = optional(bool, true)
+    cluster_external_secret = optional(bool, true)
+    push_secret             = optional(bool, true)
+    cluster_push_secret     = optional(bool, true)
+    cluster_generator       = optional(bool, true)
+  })
+  default = null
+  validation {
+    condition     = var.eso_features == null || var.eso_store_scope != "cluster" ? true : var.eso_features.cluster_secret_store
+    error_message = "The ClusterSecretStore kind is disabled in the eso_features of the ESO installation: set eso_store_scope to 'namespace' to reference a SecretStore or enable cluster_secret_store."
+  }
+}
+
 variable "es_kubernetes_namespace" {
   description = "Namespace to use to generate the externalsecret"
   type        = string
@@ -49,16 +65,20 @@ variable "es_kubernetes_secret_type" {
 
   validation {
     condition = (
-      var.es_kubernetes_secret_type != "opaque" ||
-      !contains(["arbitrary", "iam_credentials", "service_credentials"], var.sm_secret_type) ||
+      !contains(["arbitrary", "iam_credentials", "trusted_profile", "service_credentials"], var.sm_secret_type) ||
       var.es_kubernetes_secret_data_key != null ||
+      local.is_dockerjsonconfig_chain ||
+      (
+        var.es_kubernetes_secret_type == "dockerconfigjson" &&
+        var.sm_secret_type != "service_credentials"
+      ) ||
       (
         var.sm_secret_type == "service_credentials" &&
         length(var.sm_service_credentials_mappings) > 0
       )
     )
 
-    error_message = "A value for 'es_kubernetes_secret_data_key' must be passed when 'es_kubernetes_secret_type = opaque' and 'sm_secret_type' is 'arbitrary', 'iam_credentials' or 'service_credentials' without mappings."
+    error_message = "A value for 'es_kubernetes_secret_data_key' must be passed when 'sm_secret_type' is 'arbitrary', 'iam_credentials' or 'trusted_profile' and 'es_kubernetes_secret_type' is not dockerconfigjson, or when 'sm_secret_type' is 'service_credentials' without mappings."
   }
 
   validation {
@@ -68,7 +88,7 @@ variable "es_kubernetes_secret_type" {
 }
 
 variable "es_kubernetes_secret_data_key" {
-  description = "Data key to be used in Kubernetes Opaque secret. Only needed when 'es_kubernetes_secret_type' is configured as `opaque` and sm_secret_type is set to either 'arbitrary', 'iam_credentials' or 'service_credentials'"
+  description = "Data key to be used in the Kubernetes secret. Only needed when sm_secret_type is set to either 'arbitrary', 'iam_credentials' or 'trusted_profile' and 'es_kubernetes_secret_type' is not configured as `dockerconfigjson`, or to 'service_credentials' without mappings"
   type        = string
   default     = null
 }
@@ -163,6 +183,29 @@ variable "reloader_watching" {
   default     = false
 }
 
+variable "reloader_mode" {
+  description = "How the secret is annotated for the reloader when `reloader_watching` is true: `auto` adds the auto annotation (`reloader.stakater.com/auto`) to the secret, `search` adds the match annotation (`reloader.stakater.com/match`) to the secret for the workloads annotated with the search annotation (`reloader.stakater.com/search`), `targeted` doesn't annotate the secret as the workloads list it in the secret reload annotation (`secret.reloader.stakater.com/reload`). The annotations to set on the workloads are returned by the `reloader_workload_annotations` output"
+  type        = string
+  default     = "auto"
+  nullable    = false
+  validation {
+    condition     = contains(["auto", "search", "targeted"], var.reloader_mode)
+    error_message = "The specified reloader_mode is not a valid selection! Valid values are `auto`, `search` or `targeted`"
+  }
+}
+
+variable "reloader_annotations" {
+  description = "The annotation keys used by the reloader, to be set when the reloader is deployed with custom annotations (`reloader_custom_annotations` input of the root module): `auto`, `search`, `match` and `secret`. The keys not set default to the reloader ones"
+  type = object({
+    auto   = optional(string, "reloader.stakater.com/auto")
+    search = optional(string, "reloader.stakater.com/search")
+    match  = optional(string, "reloader.stakater.com/match")
+    secret = optional(string, "secret.reloader.stakater.com/reload")
+  })
+  default  = {}
+  nullable = false
+}
+
 # provider is affected by https://github.com/IBM-Cloud/terraform-provider-ibm/issues/4803
 # check for its status before switching to false
 variable "sm_certificate_bundle" {
@@ -201,3 +244,98 @@ variable "rollback_on_failure" {
   type        = bool
   default     = true
 }
+
+variable "helm_release_settings" {
+  description = "Helm behaviour of the helm release of the externalsecret, from the helm_release_settings output of the root module. `timeout` is 600 seconds if null and `atomic` is rollback_on_failure if null. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#helm-release-settings)"
+  type = object({
+    timeout         = optional(number)
+    atomic          = optional(bool)
+    wait            = optional(bool, true)
+    wait_for_jobs   = optional(bool, false)
+    cleanup_on_fail = optional(bool, false)
+    max_history     = optional(number, 0)
+  })
+  default  = {}
+  nullable = false
+  validation {
+    condition     = var.helm_release_settings.timeout == null ? true : var.helm_release_settings.timeout > 0
+    error_message = "The helm_release_settings timeout must be greater than 0."
+  }
+  validation {
+    condition     = var.helm_release_settings.max_history >= 0
+    error_message = "The helm_release_settings max_history must be greater than or equal to 0."
+  }
+}
+
+####### readiness gating
+
+variable "wait_for_ready" {
+  type        = bool
+  description = "Set to true to wait, after the helm release is applied, for the ExternalSecret to report the Ready condition, failing the apply with the ESO condition reason and message if it is not ready within wait_for_ready_timeout. It requires kubectl to be available where terraform runs and kubeconfig_path to be set."
+  default     = false
+  nullable    = false
+}
+
+variable "wait_for_ready_timeout" {
+  type        = number
+  description = "Number of seconds to wait for the ExternalSecret to be ready when wait_for_ready is true."
+  default     = 300
+  nullable    = false
+  validation {
+    condition     = var.wait_for_ready_timeout > 0
+    error_message = "The wait_for_ready_timeout must be greater than 0."
+  }
+}
+
+variable "kubeconfig_path" {
+  type        = string
+  description = "Path of the kubeconfig file used by kubectl to check the ExternalSecret readiness. Mandatory if wait_for_ready is true."
+  default     = null
+  validation {
+    condition     = var.wait_for_ready ? var.kubeconfig_path != null : true
+    error_message = "The readiness gating is enabled, therefore kubeconfig_path must be provided."
+  }
+}
+
+####### render-only mode
+
+variable "render_only" {
+  type        = bool
+  description = "Set to true to return the ExternalSecret manifest in the `manifests` output without creating the helm release, so that it is applied by a GitOps tool such as Argo CD."
+  default     = false
+  nullable    = false
+  validation {
+    condition     = var.render_only ? !var.wait_for_ready : true
+    error_message = "The readiness gating can't be enabled in render-only mode, as the manifests are not applied by Terraform."
+  }
+}
+
+variable "render_output_dir" {
+  type        = string
+  description = "Directory where the manifests are written in render-only mode, in the `<es_kubernetes_namespace>-<es_helm_rls_name>.yaml` file. If null the manifests are only returned by the `manifests` output."
+  default     = null
+  validation {
+    condition     = var.render_output_dir == null || var.render_only
+    error_message = "The render_output_dir can only be set in render-only mode, with render_only set to true."
+  }
+}
+
+####### resources backend
+
+variable "resources_backend" {
+  type        = string
+  description = "How the ExternalSecret is created: `helm` to install it with a helm release of the raw chart, `kubernetes_manifest` to create it with a kubernetes_manifest resource, showing the changes of each field in the plan. The kubernetes_manifest resources need the ESO CRDs to be installed in the cluster to plan. Ignored in render-only mode."
+  default     = "helm"
+  nullable    = false
+  validation {
+    condition     = contains(["helm", "kubernetes_manifest"], var.resources_backend)
+    error_message = "The value for var.resources_backend must be either helm or kubernetes_manifest."
+  }
+}
+
+variable "helm_keep_resources" {
+  type        = bool
+  description = "Set to true to annotate the resources of the helm release with `helm.sh/resource-policy: keep`, so that they are not deleted when the helm release is uninstalled. Apply it before switching `resources_backend` to `kubernetes_manifest` or `render_only` to true, to move the existing resources without deleting them."
+  default     = false
+  nullable    = false
+}
@@ -0,0 +1,131 @@
+locals {
+  # helm chart details
+  helm_raw_chart_name    = "raw"
+  helm_raw_chart_version = "0.2.5"
+
+  # helm behaviour of the releases, see helm_release_settings
+  helm_timeout = var.helm_release_settings.timeout != null ? var.helm_release_settings.timeout : 600
+  helm_atomic  = var.helm_release_settings.atomic != null ? var.helm_release_settings.atomic : var.rollback_on_failure
+
+  # ExternalSecrets with the module defaults for the settings not set
+  external_secrets = {
+    for key, es in var.external_secrets : key => merge(es, {
+      name             = es.es_kubernetes_secret_name != null ? es.es_kubernetes_secret_name : key
+      refresh_interval = es.es_refresh_interval != null ? es.es_refresh_interval : var.es_refresh_interval
+      store_name       = es.eso_store_name != null ? es.eso_store_name : var.eso_store_name
+      store_scope      = es.eso_store_scope != null ? es.eso_store_scope : var.eso_store_scope
+    })
+  }
+
+  # annotations of the workloads consuming the secrets, by key
+  reloader_workload_annotations = { for key, external_secret in module.external_secret_resource : key => external_secret.reloader_workload_annotations }
+
+  # ExternalSecret resources of the raw chart
+  external_secret_resources = { for key, external_secret in module.external_secret_resource : key => external_secret.resource }
+
+  # keys of the ExternalSecrets by namespace, in a stable order to limit the changes of the helm releases values
+  namespace_external_secrets = {
+    for namespace in distinct([for es in local.external_secrets : es.es_kubernetes_namespace]) : namespace => sort([
+      for key, es in local.external_secrets : key if es.es_kubernetes_namespace == namespace
+    ])
+  }
+
+  # manifests of the ExternalSecrets of each namespace as YAML documents, rendered instead of being installed in render-only mode
+  namespace_manifests = {
+    for namespace, keys in local.namespace_external_secrets : namespace => join("", [for key in keys : "---\n${yamlencode(local.external_secret_resources[key])}"])
+  }
+
+  # values of the helm release of each namespace
+  helm_values = {
+    for namespace, keys in local.namespace_external_secrets : namespace => yamlencode({
+      resources = [for key in keys : local.external_secret_resources[key]]
+    })
+  }
+
+  # values of the helm release of each namespace with the ExternalSecrets annotated to be kept by helm when the release is uninstalled, used if helm_keep_resources is true
+  helm_keep_annotations = { "helm.sh/resource-policy" = "keep" }
+  helm_keep_values = {
+    for namespace, keys in local.namespace_external_secrets : namespace => yamlencode({
+      resources = [for key in keys : merge(local.external_secret_resources[key], { metadata = merge(local.external_secret_resources[key].metadata, { annotations = local.helm_keep_annotations }) })]
+    })
+  }
+}
+
+### the ExternalSecrets, rendered as the eso-external-secret module does
+module "external_secret_resource" {
+  for_each                            = local.external_secrets
+  source                              = "../eso-external-secret-resource"
+  es_kubernetes_namespace             = each.value.es_kubernetes_namespace
+  es_kubernetes_secret_name           = each.value.name
+  es_refresh_interval                 = each.value.refresh_interval
+  eso_store_name                      = each.value.store_name
+  eso_store_scope                     = each.value.store_scope
+  es_kubernetes_secret_type           = each.value.es_kubernetes_secret_type
+  es_kubernetes_secret_data_key       = each.value.es_kubernetes_secret_data_key
+  sm_secret_type                      = each.value.sm_secret_type
+  sm_secret_id                        = each.value.sm_secret_id
+  sm_kv_keyid                         = each.value.sm_kv_keyid
+  sm_kv_keypath                       = each.value.sm_kv_keypath
+  sm_certificate_has_intermediate     = each.value.sm_certificate_has_intermediate
+  sm_certificate_bundle               = each.value.sm_certificate_bundle
+  sm_service_credentials_mappings     = each.value.sm_service_credentials_mappings
+  es_container_registry               = each.value.es_container_registry
+  es_container_registry_email         = each.value.es_container_registry_email
+  es_container_registry_secrets_chain = each.value.es_container_registry_secrets_chain
+  reloader_watching                   = each.value.reloader_watching
+  reloader_mode                       = var.reloader_mode
+  reloader_annotations                = var.reloader_annotations
+}
+
+### one helm release per namespace creating all the ExternalSecrets of the namespace
+resource "helm_release" "external_secrets" {
+  for_each        = var.render_only || var.resources_backend != "helm" ? {} : local.namespace_external_secrets
+  name            = substr(join("-", [each.key, var.es_helm_rls_name]), 0, 52)
+  namespace       = each.key
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [var.helm_keep_resources ? local.helm_keep_values[each.key] : local.helm_values[each.key]]
+}
+
+### creating the ExternalSecrets with kubernetes_manifest instead of helm releases, to have field-level plan diffs
+# the ESO CRDs must be installed in the cluster to plan the ExternalSecrets
+resource "kubernetes_manifest" "external_secrets" {
+  for_each = var.resources_backend == "kubernetes_manifest" && !var.render_only ? local.external_secret_resources : {}
+  manifest = each.value
+}
+
+### writing the manifests of each namespace in render-only mode, to be applied by a GitOps tool
+resource "local_file" "manifests" {
+  for_each        = var.render_only && var.render_output_dir != null ? local.namespace_manifests : {}
+  filename        = "${var.render_output_dir}/${substr(join("-", [each.key, var.es_helm_rls_name]), 0, 52)}.yaml"
+  content         = each.value
+  file_permission = "0644"
+}
+
+### waiting for each ExternalSecret to be ready, as helm returns as soon as the resources are accepted by the API server
+# the check is performed again at each change of the helm release of the ExternalSecret namespace or of the ExternalSecret
+resource "terraform_data" "wait_for_external_secret_ready" {
+  for_each         = var.wait_for_ready ? local.external_secrets : {}
+  triggers_replace = concat(
+    [for namespace, release in helm_release.external_secrets : release.metadata if namespace == each.value.es_kubernetes_namespace],
+    [for key, external_secret in kubernetes_manifest.external_secrets : external_secret.manifest if key == each.key]
+  )
+
+  provisioner "local-exec" {
+    command     = "${path.module}/../../scripts/wait-for-eso-ready.sh"
+    interpreter = ["/bin/bash", "-c"]
+    environment = {
+      KUBECONFIG         = var.kubeconfig_path
+      RESOURCE_TYPE      = "externalsecrets"
+      RESOURCE_NAME      = each.value.name
+      RESOURCE_NAMESPACE = each.value.es_kubernetes_namespace
+      TIMEOUT            = var.wait_for_ready_timeout
+    }
+  }
+}
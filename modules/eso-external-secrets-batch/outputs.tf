@@ -0,0 +1,40 @@
+##############################################################################
+# Outputs
+##############################################################################
+
+output "helm_releases" {
+  description = "The name of the helm release creating the ExternalSecrets of each namespace, by namespace"
+  value       = { for namespace, release in helm_release.external_secrets : namespace => release.name }
+}
+
+output "external_secrets" {
+  description = "The namespace and the name of each ExternalSecret and of the secret it generates, by key"
+  value = {
+    for key, es in local.external_secrets : key => {
+      namespace = es.es_kubernetes_namespace
+      name      = es.name
+    }
+  }
+}
+
+output "reloader_workload_annotations" {
+  description = "The annotations to set on the workloads consuming each secret to have them reloaded on its update, according to `reloader_mode`, by key. Empty for the ExternalSecrets without `reloader_watching`"
+  value       = local.reloader_workload_annotations
+}
+
+output "manifests" {
+  description = "The manifests of the ExternalSecrets of each namespace, as YAML documents, by namespace. To be applied by a GitOps tool in render-only mode"
+  value       = local.namespace_manifests
+}
+
+output "kubernetes_manifest_import_ids" {
+  description = "The kubernetes_manifest import IDs of the ExternalSecret resources, by resource key. Used to import the resources created by the helm releases when switching resources_backend to kubernetes_manifest"
+  value = {
+    for key, resource in local.external_secret_resources : key => join(",", compact([
+      "apiVersion=${resource.apiVersion}",
+      "kind=${resource.kind}",
+      try("namespace=${resource.metadata.namespace}", null),
+      "name=${resource.metadata.name}"
+    ]))
+  }
+}
@@ -0,0 +1,268 @@
+variable "external_secrets" {
+  description = "Map of the ExternalSecrets to create, by key. Each ExternalSecret is configured with the inputs of the eso-external-secret module of the same name: es_kubernetes_secret_name defaults to the key, and es_refresh_interval, eso_store_name and eso_store_scope to the module inputs of the same name. The ExternalSecrets of the same namespace are created by a single helm release. Learn more here: https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/blob/main/modules/eso-external-secrets-batch/README.md"
+  type = map(object({
+    es_kubernetes_namespace         = string
+    es_kubernetes_secret_name       = optional(string)
+    es_kubernetes_secret_type       = string
+    es_kubernetes_secret_data_key   = optional(string)
+    es_refresh_interval             = optional(string)
+    eso_store_name                  = optional(string)
+    eso_store_scope                 = optional(string)
+    sm_secret_type                  = string
+    sm_secret_id                    = optional(string)
+    sm_kv_keyid                     = optional(string)
+    sm_kv_keypath                   = optional(string)
+    sm_certificate_has_intermediate = optional(bool, true)
+    sm_certificate_bundle           = optional(bool, true)
+    sm_service_credentials_mappings = optional(map(string), {})
+    es_container_registry           = optional(string, "us.icr.io")
+    es_container_registry_email     = optional(string)
+    es_container_registry_secrets_chain = optional(list(object({
+      es_container_registry       = string
+      sm_secret_id                = string
+      es_container_registry_email = optional(string, null)
+      trusted_profile             = optional(string, null)
+    })), [])
+    reloader_watching = optional(bool, false)
+  }))
+  default  = {}
+  nullable = false
+
+  validation {
+    condition     = alltrue([for es in var.external_secrets : contains(["iam_credentials", "username_password", "trusted_profile", "arbitrary", "service_credentials", "imported_cert", "public_cert", "private_cert", "kv"], es.sm_secret_type)])
+    error_message = "The sm_secret_type of each ExternalSecret must be one of the following: iam_credentials, username_password, trusted_profile, arbitrary, service_credentials, imported_cert, public_cert, private_cert, kv."
+  }
+  validation {
+    condition     = alltrue([for es in var.external_secrets : contains(["opaque", "dockerconfigjson", "tls"], es.es_kubernetes_secret_type)])
+    error_message = "The es_kubernetes_secret_type of each ExternalSecret must be one of the following: opaque, dockerconfigjson, tls."
+  }
+  validation {
+    condition     = alltrue([for es in var.external_secrets : es.es_kubernetes_secret_type != "tls" || contains(["imported_cert", "public_cert", "private_cert"], es.sm_secret_type)])
+    error_message = "The es_kubernetes_secret_type tls is only supported for the imported_cert, public_cert and private_cert sm_secret_type."
+  }
+  validation {
+    condition     = alltrue([for es in var.external_secrets : es.sm_secret_type != "kv" || es.es_kubernetes_secret_type == "opaque"])
+    error_message = "For key-value secrets-manager secrets types es_kubernetes_secret_type cannot be different than opaque."
+  }
+  validation {
+    condition     = alltrue([for es in var.external_secrets : es.sm_secret_type != "kv" || es.sm_kv_keyid == null || es.sm_kv_keypath == null])
+    error_message = "For key-value secrets only one of 'sm_kv_keyid' or 'sm_kv_keypath' can be set."
+  }
+  validation {
+    condition = alltrue([for es in var.external_secrets : (
+      es.es_kubernetes_secret_data_key != null ||
+      length(es.es_container_registry_secrets_chain) > 0 ||
+      (contains(["arbitrary", "iam_credentials", "trusted_profile"], es.sm_secret_type) && es.es_kubernetes_secret_type == "dockerconfigjson") ||
+      (es.sm_secret_type == "service_credentials" && length(es.sm_service_credentials_mappings) > 0) ||
+      !contains(["arbitrary", "iam_credentials", "trusted_profile", "service_credentials"], es.sm_secret_type)
+    )])
+    error_message = "A value for 'es_kubernetes_secret_data_key' must be set when 'sm_secret_type' is 'arbitrary', 'iam_credentials' or 'trusted_profile' and the ExternalSecret is not a dockerconfigjson secret, or when 'sm_secret_type' is 'service_credentials' without mappings."
+  }
+  validation {
+    condition     = alltrue([for es in var.external_secrets : length(es.es_container_registry_secrets_chain) == 0 || (es.es_kubernetes_secret_type == "dockerconfigjson" && contains(["iam_credentials", "trusted_profile"], es.sm_secret_type))])
+    error_message = "If the ExternalSecret is expected to generate a dockerjsonconfig secrets chain the only supported value for es_kubernetes_secret_type is dockerconfigjson and for sm_secret_type is iam_credentials or trusted_profile."
+  }
+  validation {
+    condition     = alltrue([for es in var.external_secrets : es.sm_secret_id != null || length(es.es_container_registry_secrets_chain) > 0])
+    error_message = "The sm_secret_id of an ExternalSecret cannot be null unless the secret to create is a dockerjsonconfig secrets chain."
+  }
+  validation {
+    condition     = alltrue([for es in var.external_secrets : es.es_refresh_interval == null || can(regex("^[1-9][0-9]?[smh]$", es.es_refresh_interval))])
+    error_message = "The refresh interval of each ExternalSecret must be a value between 1 and 99s(seconds)/m(minutes)/h(hours)."
+  }
+  validation {
+    condition     = alltrue([for es in var.external_secrets : es.eso_store_scope == null || contains(["cluster", "namespace"], es.eso_store_scope)])
+    error_message = "The eso_store_scope of each ExternalSecret must be one of the following: cluster, namespace."
+  }
+  validation {
+    condition     = alltrue([for es in var.external_secrets : can(regex("^[0-9A-Za-z-]+$", es.es_kubernetes_namespace))])
+    error_message = "The es_kubernetes_namespace of each ExternalSecret must match ^[0-9A-Za-z-]+$ regexp."
+  }
+  validation {
+    condition     = length(distinct([for key, es in var.external_secrets : "${es.es_kubernetes_namespace}/${es.es_kubernetes_secret_name != null ? es.es_kubernetes_secret_name : key}"])) == length(var.external_secrets)
+    error_message = "The name of the ExternalSecrets (es_kubernetes_secret_name, or the key if not set) must be unique in each namespace."
+  }
+}
+
+variable "es_helm_rls_name" {
+  description = "Name of the helm releases creating the ExternalSecrets, prefixed by the namespace of each release. Must be unique in the namespaces"
+  type        = string
+  default     = "external-secrets"
+  nullable    = false
+  validation {
+    condition     = can(regex("^[0-9A-Za-z-]+$", var.es_helm_rls_name))
+    error_message = "The value of the helm release for the es resources must match ^[0-9A-Za-z-]+$ regexp"
+  }
+}
+
+variable "es_refresh_interval" {
+  description = "Default interval for es secret synchronization, for the ExternalSecrets without es_refresh_interval. See recommendations for specifying/customizing refresh interval in this IBM Cloud article > https://cloud.ibm.com/docs/secrets-manager?topic=secrets-manager-tutorial-kubernetes-secrets#kubernetes-secrets-best-practices"
+  type        = string
+  default     = "1h"
+  nullable    = false
+  validation {
+    condition     = can(regex("^[1-9][0-9]?[smh]$", var.es_refresh_interval))
+    error_message = "The refresh interval must be a value between 1 and 99s(seconds)/m(minutes)/h(hours)."
+  }
+}
+
+variable "eso_store_name" {
+  description = "Default ESO store name, for the ExternalSecrets without eso_store_name. Mandatory if an ExternalSecret doesn't set it"
+  type        = string
+  default     = null
+  validation {
+    condition     = var.eso_store_name != null || alltrue([for es in var.external_secrets : es.eso_store_name != null])
+    error_message = "The eso_store_name must be set, in the module or in each ExternalSecret."
+  }
+}
+
+variable "eso_store_scope" {
+  description = "Default scope of the ESO store, for the ExternalSecrets without eso_store_scope: 'cluster' to reference a ClusterSecretStore or 'namespace' to reference a SecretStore"
+  type        = string
+  default     = "cluster"
+  nullable    = false
+  validation {
+    condition     = var.eso_store_scope == "cluster" || var.eso_store_scope == "namespace"
+    error_message = "The eso_store_scope value must be one of the following: cluster, namespace"
+  }
+}
+
+variable "eso_features" {
+  description = "The ESO resource kinds enabled in the cluster, from the eso_features output of the root module, to fail the plan if an ExternalSecret references a ClusterSecretStore while ClusterSecretStores are disabled. If null the check is skipped."
+  type = object({
+    cluster_secret_store    = optional(bool, true)
+    cluster_external_secret = optional(bool, true)
+    push_secret             = optional(bool, true)
+    cluster_push_secret     = optional(bool, true)
+    cluster_generator       = optional(bool, true)
+  })
+  default = null
+  validation {
+    condition     = var.eso_features == null ? true : var.eso_features.cluster_secret_store || alltrue([for es in var.external_secrets : (es.eso_store_scope != null ? es.eso_store_scope : var.eso_store_scope) == "namespace"])
+    error_message = "The ClusterSecretStore kind is disabled in the eso_features of the ESO installation: set eso_store_scope to 'namespace' on all the ExternalSecrets to reference SecretStores or enable cluster_secret_store."
+  }
+}
+
+variable "reloader_mode" {
+  description = "How the secrets of the ExternalSecrets with reloader_watching are annotated for the reloader: `auto` adds the auto annotation (`reloader.stakater.com/auto`) to the secret, `search` adds the match annotation (`reloader.stakater.com/match`) to the secret for the workloads annotated with the search annotation (`reloader.stakater.com/search`), `targeted` doesn't annotate the secret as the workloads list it in the secret reload annotation (`secret.reloader.stakater.com/reload`). The annotations to set on the workloads are returned by the `reloader_workload_annotations` output"
+  type        = string
+  default     = "auto"
+  nullable    = false
+  validation {
+    condition     = contains(["auto", "search", "targeted"], var.reloader_mode)
+    error_message = "The specified reloader_mode is not a valid selection! Valid values are `auto`, `search` or `targeted`"
+  }
+}
+
+variable "reloader_annotations" {
+  description = "The annotation keys used by the reloader, to be set when the reloader is deployed with custom annotations (`reloader_custom_annotations` input of the root module): `auto`, `search`, `match` and `secret`. The keys not set default to the reloader ones"
+  type = object({
+    auto   = optional(string, "reloader.stakater.com/auto")
+    search = optional(string, "reloader.stakater.com/search")
+    match  = optional(string, "reloader.stakater.com/match")
+    secret = optional(string, "secret.reloader.stakater.com/reload")
+  })
+  default  = {}
+  nullable = false
+}
+
+variable "rollback_on_failure" {
+  description = "Flag to automatically rollback the helm charts on installation failure."
+  type        = bool
+  default     = true
+}
+
+variable "helm_release_settings" {
+  description = "Helm behaviour of the helm releases creating the ExternalSecrets, one for each namespace, from the helm_release_settings output of the root module. `timeout` is 600 seconds if null and `atomic` is rollback_on_failure if null. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#helm-release-settings)"
+  type = object({
+    timeout         = optional(number)
+    atomic          = optional(bool)
+    wait            = optional(bool, true)
+    wait_for_jobs   = optional(bool, false)
+    cleanup_on_fail = optional(bool, false)
+    max_history     = optional(number, 0)
+  })
+  default  = {}
+  nullable = false
+  validation {
+    condition     = var.helm_release_settings.timeout == null ? true : var.helm_release_settings.timeout > 0
+    error_message = "The helm_release_settings timeout must be greater than 0."
+  }
+  validation {
+    condition     = var.helm_release_settings.max_history >= 0
+    error_message = "The helm_release_settings max_history must be greater than or equal to 0."
+  }
+}
+
+####### readiness gating
+
+variable "wait_for_ready" {
+  type        = bool
+  description = "Set to true to wait, after the helm releases are applied, for each ExternalSecret to report the Ready condition, failing the apply with the ESO condition reason and message if it is not ready within wait_for_ready_timeout. It requires kubectl to be available where terraform runs and kubeconfig_path to be set."
+  default     = false
+  nullable    = false
+}
+
+variable "wait_for_ready_timeout" {
+  type        = number
+  description = "Number of seconds to wait for each ExternalSecret to be ready when wait_for_ready is true."
+  default     = 300
+  nullable    = false
+  validation {
+    condition     = var.wait_for_ready_timeout > 0
+    error_message = "The wait_for_ready_timeout must be greater than 0."
+  }
+}
+
+variable "kubeconfig_path" {
+  type        = string
+  description = "Path of the kubeconfig file used by kubectl to check the ExternalSecrets readiness. Mandatory if wait_for_ready is true."
+  default     = null
+  validation {
+    condition     = var.wait_for_ready ? var.kubeconfig_path != null : true
+    error_message = "The readiness gating is enabled, therefore kubeconfig_path must be provided."
+  }
+}
+
+####### render-only mode
+
+variable "render_only" {
+  type        = bool
+  description = "Set to true to return the ExternalSecrets manifests of each namespace in the `manifests` output without creating the helm releases, so that they are applied by a GitOps tool such as Argo CD."
+  default     = false
+  nullable    = false
+  validation {
+    condition     = var.render_only ? !var.wait_for_ready : true
+    error_message = "The readiness gating can't be enabled in render-only mode, as the manifests are not applied by Terraform."
+  }
+}
+
+variable "render_output_dir" {
+  type        = string
+  description = "Directory where the manifests are written in render-only mode, one `<namespace>-<es_helm_rls_name>.yaml` file per namespace. If null the manifests are only returned by the `manifests` output."
+  default     = null
+  validation {
+    condition     = var.render_output_dir == null || var.render_only
+    error_message = "The render_output_dir can only be set in render-only mode, with render_only set to true."
+  }
+}
+
+####### resources backend
+
+variable "resources_backend" {
+  type        = string
+  description = "How the ExternalSecrets are created: `helm` to install them with one helm release of the raw chart per namespace, `kubernetes_manifest` to create them with kubernetes_manifest resources, showing the changes of each field in the plan. The kubernetes_manifest resources need the ESO CRDs to be installed in the cluster to plan. Ignored in render-only mode."
+  default     = "helm"
+  nullable    = false
+  validation {
+    condition     = contains(["helm", "kubernetes_manifest"], var.resources_backend)
+    error_message = "The value for var.resources_backend must be either helm or kubernetes_manifest."
+  }
+}
+
+variable "helm_keep_resources" {
+  type        = bool
+  description = "Set to true to annotate the resources of the helm releases with `helm.sh/resource-policy: keep`, so that they are not deleted when the helm releases are uninstalled. Apply it before switching `resources_backend` to `kubernetes_manifest` or `render_only` to true, to move the existing resources without deleting them."
+  default     = false
+  nullable    = false
+}
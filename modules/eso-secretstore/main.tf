@@ -1,14 +1,21 @@
 locals {
   helm_raw_chart_name    = "raw"
   helm_raw_chart_version = "0.2.5"
+
+  # helm behaviour of the releases, see helm_release_settings
+  helm_timeout = var.helm_release_settings.timeout != null ? var.helm_release_settings.timeout : 600
+  helm_atomic  = var.helm_release_settings.atomic != null ? var.helm_release_settings.atomic : var.rollback_on_failure
+
   # endpoints definition according to endpoints to use are private or public (var.service_endpoints)
   iam_endpoint      = "${var.service_endpoints == "private" ? "private." : ""}iam.cloud.ibm.com"
   regional_endpoint = var.service_endpoints == "private" ? "private.${var.region}" : var.region
+  # the apikey secret is synced by ESO from the Secrets Manager iam_credentials secret when its ID is provided
+  apikey_rotation = var.eso_authentication == "api_key" && var.sstore_secret_apikey_secret_id != null
 }
 
 ### creating secret to store apikey to authenticate on secretsmanager for apikey authentication
 resource "kubernetes_secret_v1" "eso_secretsstore_secret" {
-  count = var.eso_authentication == "api_key" ? 1 : 0
+  count = var.eso_authentication == "api_key" && !local.apikey_rotation ? 1 : 0
   metadata {
     name      = var.sstore_secret_name
     namespace = var.sstore_namespace #checkov:skip=CKV_K8S_21
@@ -20,17 +27,30 @@ resource "kubernetes_secret_v1" "eso_secretsstore_secret" {
   type = "opaque"
 }
 
-### Define secret store used to connect with SM instance for apikey auth
-resource "helm_release" "external_secret_store_apikey" {
-  count     = var.eso_authentication == "api_key" ? 1 : 0
-  name      = substr(join("-", [var.sstore_namespace, var.sstore_helm_rls_name]), 0, 52)
-  namespace = var.sstore_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
+### creating secret with the apikey to bootstrap the secrets store when the apikey is synced by ESO
+# the secret content is owned by the ExternalSecret defined in the secrets store helm release after the creation,
+# so the changes to its data are ignored to avoid restoring the bootstrap apikey after a rotation
+resource "kubernetes_secret_v1" "eso_secretsstore_bootstrap_secret" {
+  count = local.apikey_rotation ? 1 : 0
+  metadata {
+    name      = var.sstore_secret_name
+    namespace = var.sstore_namespace #checkov:skip=CKV_K8S_21
+  }
+
+  data = {
+    apiKey = var.sstore_secret_apikey
+  }
+  type = "opaque"
+
+  lifecycle {
+    ignore_changes = [data, metadata[0].labels, metadata[0].annotations]
+  }
+}
+
+### resources of the raw chart releases, rendered as manifests instead of being installed in render-only mode
+locals {
+  # SecretStore with apikey authentication, with the ExternalSecret syncing the apikey when it is rotated
+  external_secret_store_apikey_values = var.eso_authentication != "api_key" ? null : <<-EOF
     resources:
       - apiVersion: external-secrets.io/v1
         kind: SecretStore
@@ -38,6 +58,9 @@ resource "helm_release" "external_secret_store_apikey" {
           name: "${var.sstore_store_name}"
           namespace: "${var.sstore_namespace}"
         spec:
+%{if var.sstore_controller_class != null~}
+          controller: "${var.sstore_controller_class}"
+%{endif~}
           provider:
             ibm:
               serviceUrl: "https://${var.sstore_secrets_manager_guid}.${local.regional_endpoint}.secrets-manager.appdomain.cloud"
@@ -47,21 +70,29 @@ resource "helm_release" "external_secret_store_apikey" {
                   secretApiKeySecretRef:
                     name: "${var.sstore_secret_name}"
                     key: apiKey
+%{if local.apikey_rotation~}
+      - apiVersion: external-secrets.io/v1
+        kind: ExternalSecret
+        metadata:
+          name: "${var.sstore_secret_name}"
+          namespace: "${var.sstore_namespace}"
+        spec:
+          refreshInterval: "${var.sstore_secret_apikey_refresh_interval}"
+          secretStoreRef:
+            name: "${var.sstore_store_name}"
+            kind: SecretStore
+          target:
+            name: "${var.sstore_secret_name}"
+            creationPolicy: Merge
+          data:
+            - secretKey: apiKey
+              remoteRef:
+                key: "iam_credentials/${var.sstore_secret_apikey_secret_id}"
+%{endif~}
     EOF
-  ]
-}
 
-# Trusted profile authentication Use ContainerAuth with CRI based authentication (trusted profile support)
-resource "helm_release" "external_secret_store_tp" {
-  count     = var.eso_authentication == "trusted_profile" ? 1 : 0
-  name      = substr(join("-", [var.sstore_namespace, var.sstore_helm_rls_name]), 0, 52)
-  namespace = var.sstore_namespace
-  chart     = "${path.module}/../../chart/${local.helm_raw_chart_name}"
-  version   = local.helm_raw_chart_version
-  timeout   = 600
-  atomic    = var.rollback_on_failure
-  values = [
-    <<-EOF
+  # SecretStore with trusted profile authentication
+  external_secret_store_tp_values = var.eso_authentication != "trusted_profile" ? null : <<-EOF
     resources:
       - apiVersion: external-secrets.io/v1
         kind: SecretStore
@@ -69,6 +100,9 @@ resource "helm_release" "external_secret_store_tp" {
           name: "${var.sstore_store_name}"
           namespace: "${var.sstore_namespace}"
         spec:
+%{if var.sstore_controller_class != null~}
+          controller: "${var.sstore_controller_class}"
+%{endif~}
           provider:
             ibm:
               serviceUrl: "https://${var.sstore_secrets_manager_guid}.${local.regional_endpoint}.secrets-manager.appdomain.cloud"
@@ -78,5 +112,100 @@ resource "helm_release" "external_secret_store_tp" {
                   iamEndpoint: "https://${local.iam_endpoint}"
                   tokenLocation: /var/run/secrets/tokens/sa-token
     EOF
+
+  # the resources of the helm releases, as objects
+  resources = flatten([for values in compact([local.external_secret_store_apikey_values, local.external_secret_store_tp_values]) : yamldecode(values).resources])
+
+  # the manifests of the resources, as YAML documents
+  manifests = join("", [for resource in local.resources : "---\n${yamlencode(resource)}"])
+
+  # values of the helm releases, with the resources annotated to be kept by helm when the release is uninstalled if helm_keep_resources is true
+  helm_keep_annotations = { "helm.sh/resource-policy" = "keep" }
+  helm_values = {
+    for name, values in {
+      external_secret_store_apikey = local.external_secret_store_apikey_values
+      external_secret_store_tp     = local.external_secret_store_tp_values
+    } : name => values == null || !var.helm_keep_resources ? values : yamlencode({
+      resources = [for resource in yamldecode(values).resources : merge(resource, { metadata = merge(resource.metadata, { annotations = merge(try(resource.metadata.annotations, null), local.helm_keep_annotations) }) })]
+    })
+  }
+
+  # the resources created by the kubernetes_manifest backend, by kind, namespace and name
+  manifest_resources = { for resource in local.resources : join("/", compact([resource.kind, try(resource.metadata.namespace, null), resource.metadata.name])) => resource }
+}
+
+### Define secret store used to connect with SM instance for apikey auth
+resource "helm_release" "external_secret_store_apikey" {
+  count           = var.eso_authentication == "api_key" && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = substr(join("-", [var.sstore_namespace, var.sstore_helm_rls_name]), 0, 52)
+  namespace       = var.sstore_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.external_secret_store_apikey]
+
+  depends_on = [
+    kubernetes_secret_v1.eso_secretsstore_secret,
+    kubernetes_secret_v1.eso_secretsstore_bootstrap_secret
   ]
 }
+
+# Trusted profile authentication Use ContainerAuth with CRI based authentication (trusted profile support)
+resource "helm_release" "external_secret_store_tp" {
+  count           = var.eso_authentication == "trusted_profile" && !var.render_only && var.resources_backend == "helm" ? 1 : 0
+  name            = substr(join("-", [var.sstore_namespace, var.sstore_helm_rls_name]), 0, 52)
+  namespace       = var.sstore_namespace
+  chart           = "${path.module}/../../chart/${local.helm_raw_chart_name}"
+  version         = local.helm_raw_chart_version
+  timeout         = local.helm_timeout
+  atomic          = local.helm_atomic
+  wait            = var.helm_release_settings.wait
+  wait_for_jobs   = var.helm_release_settings.wait_for_jobs
+  cleanup_on_fail = var.helm_release_settings.cleanup_on_fail
+  max_history     = var.helm_release_settings.max_history
+  values          = [local.helm_values.external_secret_store_tp]
+}
+
+### creating the resources with kubernetes_manifest instead of helm releases, to have field-level plan diffs
+# the ESO CRDs must be installed in the cluster to plan the resources
+resource "kubernetes_manifest" "resources" {
+  for_each = var.resources_backend == "kubernetes_manifest" && !var.render_only ? local.manifest_resources : {}
+  manifest = each.value
+
+  depends_on = [
+    kubernetes_secret_v1.eso_secretsstore_secret,
+    kubernetes_secret_v1.eso_secretsstore_bootstrap_secret
+  ]
+}
+
+### writing the manifests in render-only mode, to be applied by a GitOps tool
+resource "local_file" "manifests" {
+  count           = var.render_only && var.render_output_dir != null ? 1 : 0
+  filename        = "${var.render_output_dir}/${substr(join("-", [var.sstore_namespace, var.sstore_helm_rls_name]), 0, 52)}.yaml"
+  content         = local.manifests
+  file_permission = "0644"
+}
+
+### waiting for the SecretStore to be ready, as helm returns as soon as the resource is accepted by the API server
+# the check is performed again at each change of the helm release or of the resources
+resource "terraform_data" "wait_for_secret_store_ready" {
+  count            = var.wait_for_ready ? 1 : 0
+  triggers_replace = concat([for release in concat(helm_release.external_secret_store_apikey, helm_release.external_secret_store_tp) : release.metadata], [for resource in kubernetes_manifest.resources : resource.manifest])
+
+  provisioner "local-exec" {
+    command     = "${path.module}/../../scripts/wait-for-eso-ready.sh"
+    interpreter = ["/bin/bash", "-c"]
+    environment = {
+      KUBECONFIG         = var.kubeconfig_path
+      RESOURCE_TYPE      = "secretstores"
+      RESOURCE_NAME      = var.sstore_store_name
+      RESOURCE_NAMESPACE = var.sstore_namespace
+      TIMEOUT            = var.wait_for_ready_timeout
+    }
+  }
+}
@@ -6,31 +6,67 @@ resource "ibm_iam_trusted_profile" "trusted_profile" {
   description = "a trusted profile to access the secrets manager instance: ${var.secrets_manager_guid}."
 }
 
-# The following Rule allows incoming requests from
-# the external-secrets SA in external-secrets namespace in the
-# target cluster with the retrieved cluster's CRN.
+locals {
+  # claim rules to create on the trusted profile, one for each cluster CRN/namespace/service account tuple
+  # the cluster configured through tp_cluster_crn and tp_namespace is kept with the "default" key to preserve the existing claim rule
+  legacy_claim_rule = var.tp_cluster_crn != null ? {
+    "default" = {
+      name                 = "${var.trusted_profile_name}-rule"
+      cluster_crn          = var.tp_cluster_crn
+      namespace            = var.tp_namespace
+      service_account_name = var.tp_service_account_name
+      cr_type              = var.trusted_profile_claim_rule_type
+    }
+  } : {}
+
+  # the key of each cluster claim rule is the combination of cluster CRN, namespace and service account to keep it stable when the list order changes
+  clusters_claim_rules = {
+    for cluster in var.tp_clusters :
+    "${cluster.cluster_crn}/${cluster.namespace}/${cluster.service_account_name}" => {
+      # the cluster ID is the 8th field of the cluster CRN, the service account keeps the name unique when several service accounts of the same namespace are trusted
+      name                 = "${var.trusted_profile_name}-rule-${element(split(":", cluster.cluster_crn), 7)}-${cluster.namespace}-${cluster.service_account_name}"
+      cluster_crn          = cluster.cluster_crn
+      namespace            = cluster.namespace
+      service_account_name = cluster.service_account_name
+      cr_type              = cluster.cr_type != null ? cluster.cr_type : var.trusted_profile_claim_rule_type
+    }
+  }
+
+  claim_rules = merge(local.legacy_claim_rule, local.clusters_claim_rules)
+}
+
+# migration definition to avoid destruction of the claim rule with support of multiple clusters
+moved {
+  from = ibm_iam_trusted_profile_claim_rule.claim_rule
+  to   = ibm_iam_trusted_profile_claim_rule.claim_rule["default"]
+}
+
+# The following Rules allow incoming requests from
+# the ESO service account (external-secrets by default) in the ESO namespace in each of the
+# target clusters with the cluster's CRN.
 resource "ibm_iam_trusted_profile_claim_rule" "claim_rule" {
+  for_each   = local.claim_rules
   profile_id = ibm_iam_trusted_profile.trusted_profile.id
   type       = "Profile-CR"
-  name       = "${var.trusted_profile_name}-rule"
-  cr_type    = var.trusted_profile_claim_rule_type
+  name       = each.value.name
+  cr_type    = each.value.cr_type
 
   dynamic "conditions" {
     for_each = [
       {
         claim    = "name"
         operator = "EQUALS"
-        value    = "\"external-secrets\""
+        value    = "\"${each.value.service_account_name}\""
       },
       {
         claim    = "namespace",
         operator = "EQUALS",
-        value    = "\"${var.tp_namespace}\"",
+        value    = "\"${each.value.namespace}\"",
       },
       {
         claim    = "crn",
         operator = "EQUALS",
-        value    = "\"${var.tp_cluster_crn}\""
+        value    = "\"${each.value.cluster_crn}\""
       }
     ]
 
@@ -42,7 +78,7 @@ resource "ibm_iam_trusted_profile_claim_rule" "claim_rule" {
   }
 }
 
-# This Trusted Profile policy grants access to the provided secrets
+# The Trusted Profile policies grant access to the provided secrets
 # manager instance, if one of more secret group ids are provided, it will then
 # restrict access to these secret groups with SecretsReader role.
 
@@ -52,32 +88,89 @@ moved {
   to   = module.your_trusted_profile_module_name.ibm_iam_trusted_profile_policy.policy[0]
 }
 
-# This Trusted Profile policy grants access to the provided secrets
-# manager instance, if no secrets group id or one secrets group id is provided to restrict the access to the Secrets Manager instance
-resource "ibm_iam_trusted_profile_policy" "policy" {
-  count       = length(var.secret_groups_id) <= 1 ? 1 : 0
-  iam_id      = ibm_iam_trusted_profile.trusted_profile.iam_id
-  description = length(var.secret_groups_id) == 0 ? "IAM Trusted Profile Policy to access the secrets in the target secret groups and secrets manager instance and not restricted to any secrets group" : "IAM Trusted Profile Policy to access the secrets in the target secret group and secrets manager instance"
-  roles       = ["SecretsReader"]
-  resources {
-    service              = "secrets-manager"
-    resource_type        = length(var.secret_groups_id) == 1 ? "secret-group" : null
-    resource             = length(var.secret_groups_id) == 1 ? var.secret_groups_id[0] : null
-    resource_instance_id = var.secrets_manager_guid
-  }
+locals {
+  # the policy on the whole instance (or on the single secrets group) is not created when the access is restricted to single secrets only
+  create_instance_or_group_policy = length(var.secret_groups_id) == 1 || (length(var.secret_groups_id) == 0 && length(var.secret_ids) == 0)
+
+  # policies of the trusted profile, all sharing the access tags and time-based conditions
+  policies = merge(
+    # access to the Secrets Manager instance, restricted to the secrets group if only one is provided
+    local.create_instance_or_group_policy ? {
+      "default" = {
+        description   = length(var.secret_groups_id) == 0 ? "IAM Trusted Profile Policy to access the secrets in the target secret groups and secrets manager instance and not restricted to any secrets group" : "IAM Trusted Profile Policy to access the secrets in the target secret group and secrets manager instance"
+        roles         = ["SecretsReader"]
+        resource_type = length(var.secret_groups_id) == 1 ? "secret-group" : null
+        resource      = length(var.secret_groups_id) == 1 ? var.secret_groups_id[0] : null
+      }
+    } : {},
+    # access to each secrets group, if two or more secrets groups id are provided, keyed by the index of the secrets
+    # group as the secrets groups IDs may only be known after apply
+    length(var.secret_groups_id) > 1 ? {
+      for index, secret_group_id in var.secret_groups_id : "secret-group/${index}" => {
+        description   = "IAM Trusted Profile Policy to access the secrets in the target secrets group ${secret_group_id} and secrets manager instance"
+        roles         = ["SecretsReader"]
+        resource_type = "secret-group"
+        resource      = secret_group_id
+      }
+    } : {},
+    # access to each of the provided secrets IDs, to restrict the access to single secrets of the Secrets Manager instance
+    {
+      for secret_id in var.secret_ids : "secret/${secret_id}" => {
+        description   = "IAM Trusted Profile Policy to access the secret ${secret_id} in the target secrets manager instance"
+        roles         = ["SecretsReader"]
+        resource_type = "secret"
+        resource      = secret_id
+      }
+    },
+    # Reader role on the whole instance to allow listing the secrets (needed by ExternalSecrets using dataFrom find),
+    # while the access to the secrets values stays restricted by the SecretsReader policies
+    var.instance_reader_policy ? {
+      "instance-reader" = {
+        description   = "IAM Trusted Profile Policy to list the secrets in the target secrets manager instance"
+        roles         = ["Reader"]
+        resource_type = null
+        resource      = null
+      }
+    } : {}
+  )
 }
 
-# This Trusted Profile policy grants access to the provided secrets
-# manager instance, if two or more secrets groups id are provided to restrict the access to the Secrets Manager instance
-resource "ibm_iam_trusted_profile_policy" "policy_multiple_secrets_groups" {
-  count       = length(var.secret_groups_id) > 1 ? length(var.secret_groups_id) : 0
+# migration definition to keep the policy on the instance or on the single secrets group, the policies of multiple
+# secrets groups must be moved with terraform state mv (see the module README)
+moved {
+  from = ibm_iam_trusted_profile_policy.policy[0]
+  to   = ibm_iam_trusted_profile_policy.policies["default"]
+}
+
+resource "ibm_iam_trusted_profile_policy" "policies" {
+  for_each    = local.policies
   iam_id      = ibm_iam_trusted_profile.trusted_profile.iam_id
-  description = "IAM Trusted Profile Policy to access the secrets in the target secrets group ${var.secret_groups_id[count.index]} and secrets manager instance"
-  roles       = ["SecretsReader"]
+  description = each.value.description
+  roles       = each.value.roles
   resources {
     service              = "secrets-manager"
-    resource_type        = "secret-group"
-    resource             = var.secret_groups_id[count.index]
+    resource_type        = each.value.resource_type
+    resource             = each.value.resource
     resource_instance_id = var.secrets_manager_guid
   }
+
+  dynamic "resource_tags" {
+    for_each = var.policy_access_tags
+    content {
+      name     = resource_tags.value["name"]
+      value    = resource_tags.value["value"]
+      operator = resource_tags.value["operator"]
+    }
+  }
+
+  dynamic "rule_conditions" {
+    for_each = var.policy_time_conditions != null ? var.policy_time_conditions.conditions : []
+    content {
+      key      = rule_conditions.value["key"]
+      operator = rule_conditions.value["operator"]
+      value    = rule_conditions.value["value"]
+    }
+  }
+  rule_operator = var.policy_time_conditions != null ? var.policy_time_conditions.operator : null
+  pattern       = var.policy_time_conditions != null ? var.policy_time_conditions.pattern : null
 }
@@ -11,3 +11,8 @@ output "trusted_profile_name" {
   value       = ibm_iam_trusted_profile.trusted_profile.name
   description = "Name of the trusted profile"
 }
+
+output "trusted_profile_claim_rule_ids" {
+  value       = { for key, claim_rule in ibm_iam_trusted_profile_claim_rule.claim_rule : key => claim_rule.rule_id }
+  description = "IDs of the trusted profile claim rules, keyed by `default` for tp_cluster_crn and by `<cluster_crn>/<namespace>/<service_account_name>` for each element of tp_clusters"
+}
@@ -16,20 +16,125 @@ variable "secret_groups_id" {
 
 variable "tp_cluster_crn" {
   type        = string
-  description = "Target cluster CRN for the trusted profile. Used when creating trusted profile"
+  description = "Target cluster CRN for the trusted profile. Used when creating trusted profile. Can be null if the clusters are configured through tp_clusters"
+  default     = null
+  validation {
+    condition     = var.tp_cluster_crn != null || length(var.tp_clusters) > 0
+    error_message = "At least one cluster must be configured for the trusted profile, through tp_cluster_crn or tp_clusters."
+  }
 }
 
 variable "trusted_profile_claim_rule_type" {
-  description = "Trusted profile claim rule type, set the value to 'ROKS_SA' for ROKS clusters, set to ROKS for IKS clusters"
+  description = "Trusted profile claim rule type, set the value to 'ROKS_SA' for ROKS clusters, set to 'IKS_SA' for IKS clusters ('ROKS' is still accepted for the configurations of the previous versions of the module). It is used for tp_cluster_crn and for the tp_clusters elements not setting their own cr_type"
   type        = string
   default     = "ROKS_SA"
   validation {
-    condition     = var.trusted_profile_claim_rule_type == "ROKS_SA" || var.trusted_profile_claim_rule_type == "ROKS"
-    error_message = "The trusted_profile_claim_rule_type value must be one of the following: ROKS_SA, ROKS"
+    condition     = contains(["ROKS_SA", "IKS_SA", "ROKS"], var.trusted_profile_claim_rule_type)
+    error_message = "The trusted_profile_claim_rule_type value must be one of the following: ROKS_SA, IKS_SA, ROKS"
   }
 }
 
 variable "tp_namespace" {
-  description = "Namespace to configure in the Trusted Profile on IAM. Its value must be the namespace where the operator is deployed and running."
+  description = "Namespace to configure in the Trusted Profile on IAM. Its value must be the namespace where the operator is deployed and running. Mandatory if tp_cluster_crn is set"
   type        = string
+  default     = null
+  validation {
+    condition     = var.tp_cluster_crn == null || var.tp_namespace != null
+    error_message = "The tp_namespace value must be provided when tp_cluster_crn is set."
+  }
+}
+
+variable "tp_clusters" {
+  description = "List of clusters to configure in the Trusted Profile on IAM in addition to tp_cluster_crn, one claim rule is created for each element. For each cluster set the cluster CRN, the namespace where the operator is deployed, the operator service account name and optionally the claim rule type (`ROKS_SA` for ROKS clusters, `IKS_SA` for IKS clusters, or `ROKS` as for trusted_profile_claim_rule_type, default is trusted_profile_claim_rule_type)."
+  type = list(object({
+    cluster_crn          = string
+    namespace            = string
+    service_account_name = optional(string, "external-secrets")
+    cr_type              = optional(string, null)
+  }))
+  default  = []
+  nullable = false
+  validation {
+    condition     = alltrue([for cluster in var.tp_clusters : can(regex("^crn:v\\d:(.*:){2}containers-kubernetes:(.*:)([aos]\\/[\\w_\\-]+):[a-z0-9]{20}::$", cluster.cluster_crn))])
+    error_message = "Each cluster_crn value in tp_clusters must be a valid cluster CRN."
+  }
+  validation {
+    condition     = alltrue([for cluster in var.tp_clusters : cluster.cr_type == null || contains(["ROKS_SA", "IKS_SA", "ROKS"], cluster.cr_type)])
+    error_message = "The cr_type value of each element in tp_clusters must be one of the following: ROKS_SA, IKS_SA, ROKS"
+  }
+  validation {
+    condition     = length(distinct([for cluster in var.tp_clusters : "${cluster.cluster_crn}/${cluster.namespace}/${cluster.service_account_name}"])) == length(var.tp_clusters)
+    error_message = "The elements in tp_clusters must be unique in terms of cluster_crn, namespace and service_account_name."
+  }
+  # IAM supports at most 20 claim rules for each trusted profile
+  validation {
+    condition     = length(var.tp_clusters) + (var.tp_cluster_crn != null ? 1 : 0) <= 20
+    error_message = "A trusted profile supports at most 20 claim rules: the total number of clusters configured through tp_cluster_crn and tp_clusters cannot exceed 20."
+  }
+}
+
+variable "tp_service_account_name" {
+  description = "Name of the Kubernetes service account to configure in the Trusted Profile claim rule for tp_cluster_crn. Its value must be the service account the operator controller runs with, which is `external-secrets` for the default ESO helm release."
+  type        = string
+  default     = "external-secrets"
+  nullable    = false
+  validation {
+    condition     = can(regex("^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$", var.tp_service_account_name))
+    error_message = "The value of tp_service_account_name must be a valid Kubernetes service account name."
+  }
+}
+
+variable "secret_ids" {
+  type        = list(string)
+  description = "The list of secrets IDs to limit access to for the trusted profile to create. A policy is created for each secret. If set and secret_groups_id is empty, the trusted profile is not granted access to the whole secrets manager instance."
+  default     = []
+  nullable    = false
+}
+
+variable "instance_reader_policy" {
+  type        = bool
+  description = "Set to true to grant the trusted profile the Reader role on the whole secrets manager instance, in addition to the SecretsReader role on the secrets groups or secrets. The Reader role allows to list the secrets, as required by ExternalSecrets using dataFrom find, without allowing to read the secrets values."
+  default     = false
+  nullable    = false
+}
+
+variable "policy_access_tags" {
+  type = list(object({
+    name     = string
+    value    = string
+    operator = optional(string, "stringEquals")
+  }))
+  description = "The list of access tags to set as condition on the trusted profile policies. The policies will grant access only to the resources with the matching access tags."
+  default     = []
+  nullable    = false
+  validation {
+    condition     = alltrue([for tag in var.policy_access_tags : contains(["stringEquals", "stringMatch"], tag.operator)])
+    error_message = "The operator of each element in policy_access_tags must be one of the following: stringEquals, stringMatch"
+  }
+}
+
+variable "policy_time_conditions" {
+  type = object({
+    pattern  = string
+    operator = optional(string, "and")
+    conditions = list(object({
+      key      = string
+      operator = string
+      value    = list(string)
+    }))
+  })
+  description = "Time-based conditions to set on the trusted profile policies. The pattern must be one of `time-based-conditions:once`, `time-based-conditions:weekly:all-day` or `time-based-conditions:weekly:custom-hours` and the conditions use the `{{environment.attributes.current_date_time}}`, `{{environment.attributes.day_of_week}}` or `{{environment.attributes.current_time}}` keys. [Learn more](https://cloud.ibm.com/docs/account?topic=account-iam-time-based)."
+  default     = null
+  validation {
+    condition     = var.policy_time_conditions == null ? true : contains(["time-based-conditions:once", "time-based-conditions:weekly:all-day", "time-based-conditions:weekly:custom-hours"], var.policy_time_conditions.pattern)
+    error_message = "The pattern of policy_time_conditions must be one of the following: time-based-conditions:once, time-based-conditions:weekly:all-day, time-based-conditions:weekly:custom-hours"
+  }
+  validation {
+    condition     = var.policy_time_conditions == null ? true : contains(["and", "or"], var.policy_time_conditions.operator)
+    error_message = "The operator of policy_time_conditions must be one of the following: and, or"
+  }
+  validation {
+    condition     = var.policy_time_conditions == null ? true : length(var.policy_time_conditions.conditions) > 0
+    error_message = "At least one condition must be set in policy_time_conditions."
+  }
 }
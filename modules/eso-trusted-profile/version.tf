@@ -3,7 +3,7 @@ terraform {
   required_providers {
     ibm = {
       source  = "IBM-Cloud/ibm"
-      version = ">= 1.51.0"
+      version = ">= 1.65.0"
     }
   }
 }
@@ -1,3 +1,25 @@
 ##############################################################################
 # Outputs
 ##############################################################################
+
+output "eso_scoped_installations" {
+  description = "The additional ESO installations of eso_scoped_installations, with their helm release name, namespace, controller class and service account name (to configure in the trusted profile of their stores)"
+  value = {
+    for key, installation in var.eso_scoped_installations : key => {
+      release_name         = helm_release.external_secrets_operator_scoped[key].name
+      namespace            = helm_release.external_secrets_operator_scoped[key].namespace
+      controller_class     = installation.controller_class
+      service_account_name = "external-secrets-${key}"
+    }
+  }
+}
+
+output "eso_features" {
+  description = "The ESO resource kinds enabled by eso_features, to pass to the eso_features input of the eso-clusterstore and eso-external-secret modules"
+  value       = var.eso_features
+}
+
+output "helm_release_settings" {
+  description = "The helm behaviour of the helm releases of the module, to pass to the helm_release_settings input of the submodules"
+  value       = var.helm_release_settings
+}
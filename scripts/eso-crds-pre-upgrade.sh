@@ -0,0 +1,68 @@
+#!/bin/bash
+
+########################################################################################################################
+## This script runs before the install or the upgrade of the External Secrets Operator CRDs. For each CRD to install ##
+## already in the cluster it checks that the versions stored in etcd (status.storedVersions) are still served by the  ##
+## new CRD, as the API server rejects the upgrade of a CRD no longer serving a stored version (for example v1beta1    ##
+## once the storage version is v1). It then moves the ownership of the CRDs to the helm release which is going to     ##
+## manage them, failing if the CRDs are not protected by the helm keep resource policy, as they would otherwise be    ##
+## deleted, with all the ESO resources of the cluster, by the release giving them up.                                 ##
+########################################################################################################################
+
+set -euo pipefail
+
+# CRD_SERVED_VERSIONS lists, one per line, the CRDs to install with their served versions: <crd name>=<version>,<version>
+: "${CRD_SERVED_VERSIONS:?CRD_SERVED_VERSIONS must be set}"
+: "${RELEASE_NAME:?RELEASE_NAME must be set}"
+: "${RELEASE_NAMESPACE:?RELEASE_NAMESPACE must be set}"
+
+keep_policy="helm.sh/resource-policy"
+failures=()
+pending_ownership=()
+
+while IFS='=' read -r crd served_versions; do
+  [ -n "${crd}" ] || continue
+
+  # stored versions, owner release and resource policy of the CRD in the cluster, pipe separated
+  jsonpath='{.status.storedVersions}{"|"}{.metadata.annotations.meta\.helm\.sh/release-name}{"|"}{.metadata.annotations.helm\.sh/resource-policy}'
+  if ! output=$(kubectl get customresourcedefinition "${crd}" --ignore-not-found -o jsonpath="${jsonpath}"); then
+    failures+=("${crd}: unable to read the CRD from the cluster")
+    continue
+  fi
+  if [ -z "${output}" ]; then
+    echo "${crd} not in the cluster yet, it will be installed"
+    continue
+  fi
+  IFS="|" read -r stored_versions owner policy <<< "${output}" || true
+
+  # storage compatibility: every stored version must still be served
+  for version in $(echo "${stored_versions}" | tr -d '[]"' | tr ',' ' '); do
+    if [[ ",${served_versions}," != *",${version},"* ]]; then
+      failures+=("${crd}: the version ${version} stored in the cluster is not served by the new CRD (served versions: ${served_versions}). Migrate the stored ${crd%%.*} to a served version, for example with 'kubectl get ${crd} -A -o json | kubectl replace -f -' with the previous CRD, then remove ${version} from the CRD status.storedVersions")
+    fi
+  done
+
+  # ownership: the CRD is moved to the release managing it, only if kept by the release giving it up
+  if [ "${owner}" != "${RELEASE_NAME}" ]; then
+    if [ -n "${owner}" ] && [ "${policy}" != "keep" ]; then
+      failures+=("${crd}: owned by the helm release ${owner} without the ${keep_policy}: keep annotation, it would be deleted by ${owner}. Apply first with eso_crds_keep_on_destroy set to true and without changing eso_crds_separate_release")
+      continue
+    fi
+    pending_ownership+=("${crd}")
+  fi
+done <<< "${CRD_SERVED_VERSIONS}"
+
+if [ "${#failures[@]}" -gt 0 ]; then
+  echo "The External Secrets Operator CRDs can't be upgraded:" >&2
+  printf ' - %s\n' "${failures[@]}" >&2
+  exit 1
+fi
+
+# the expansion of the array is guarded as an empty array is unbound with set -u before bash 4.4
+for crd in ${pending_ownership[@]+"${pending_ownership[@]}"}; do
+  echo "Moving the ownership of ${crd} to the helm release ${RELEASE_NAMESPACE}/${RELEASE_NAME}"
+  kubectl annotate customresourcedefinition "${crd}" --overwrite "meta.helm.sh/release-name=${RELEASE_NAME}" "meta.helm.sh/release-namespace=${RELEASE_NAMESPACE}"
+  kubectl label customresourcedefinition "${crd}" --overwrite "app.kubernetes.io/managed-by=Helm"
+done
+
+echo "The External Secrets Operator CRDs can be upgraded"
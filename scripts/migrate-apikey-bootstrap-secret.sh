@@ -0,0 +1,45 @@
+#!/bin/bash
+
+########################################################################################################################
+## This script migrates, in the Terraform state, the API key secret of the eso-secretstore and eso-clusterstore       ##
+## modules to the bootstrap secret created when the API key rotation is enabled on an existing store, so that the    ##
+## Kubernetes secret isn't deleted and recreated. It must be run in the Terraform root directory before the apply    ##
+## enabling the rotation, with the address of each store module enabling it. Stores already migrated are skipped.   ##
+########################################################################################################################
+
+set -euo pipefail
+
+# TERRAFORM is the terraform binary to run, for example tofu
+TERRAFORM="${TERRAFORM:-terraform}"
+
+if [ "$#" -eq 0 ]; then
+  echo "Usage: $0 <store module address>..." >&2
+  echo "Example: $0 'module.eso_secretsstore[\"secrets-store-1\"]' 'module.eso_clustersecretsstore[\"cluster-secrets-store-1\"]'" >&2
+  exit 1
+fi
+
+state=$("${TERRAFORM}" state list)
+
+in_state() {
+  grep -qxF "$1" <<< "${state}"
+}
+
+for module_address in "$@"; do
+  migrated=false
+  # API key secret resource names of the eso-secretstore and eso-clusterstore modules
+  for store in eso_secretsstore eso_clusterstore; do
+    source_address="${module_address}.kubernetes_secret_v1.${store}_secret[0]"
+    destination_address="${module_address}.kubernetes_secret_v1.${store}_bootstrap_secret[0]"
+    if in_state "${destination_address}"; then
+      echo "${module_address} already migrated"
+      migrated=true
+    elif in_state "${source_address}"; then
+      "${TERRAFORM}" state mv "${source_address}" "${destination_address}"
+      migrated=true
+    fi
+  done
+  if [ "${migrated}" == "false" ]; then
+    echo "No API key secret of ${module_address} found in the state" >&2
+    exit 1
+  fi
+done
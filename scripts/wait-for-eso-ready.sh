@@ -0,0 +1,55 @@
+#!/bin/bash
+
+########################################################################################################################
+## This script waits for an External Secrets Operator resource (SecretStore, ClusterSecretStore or ExternalSecret) to ##
+## report the Ready=True condition. If the resource isn't ready within the timeout it fails with the reason and the   ##
+## message of the ESO Ready condition, so that the terraform apply fails instead of silently syncing nothing.         ##
+########################################################################################################################
+
+set -euo pipefail
+
+# RESOURCE_TYPE is the plural name of the ESO resource type, for example secretstores, clustersecretstores or externalsecrets
+: "${RESOURCE_TYPE:?RESOURCE_TYPE must be set}"
+: "${RESOURCE_NAME:?RESOURCE_NAME must be set}"
+RESOURCE_NAMESPACE="${RESOURCE_NAMESPACE:-}"
+TIMEOUT="${TIMEOUT:-300}"
+POLL_INTERVAL="${POLL_INTERVAL:-5}"
+
+resource="${RESOURCE_TYPE}.external-secrets.io/${RESOURCE_NAME}"
+# the expansion of the array is guarded as an empty array is unbound with set -u before bash 4.4
+namespace_flags=()
+if [ -n "${RESOURCE_NAMESPACE}" ]; then
+  namespace_flags=(--namespace "${RESOURCE_NAMESPACE}")
+fi
+
+# status, reason and message of the Ready condition, tab separated
+jsonpath='{range .status.conditions[?(@.type=="Ready")]}{.status}{"\t"}{.reason}{"\t"}{.message}{end}'
+
+echo "Waiting up to ${TIMEOUT} seconds for ${resource} ${RESOURCE_NAMESPACE:+in namespace ${RESOURCE_NAMESPACE} }to be ready"
+
+deadline=$((SECONDS + TIMEOUT))
+status=""
+reason=""
+message=""
+while true; do
+  if output=$(kubectl get "${resource}" ${namespace_flags[@]+"${namespace_flags[@]}"} -o jsonpath="${jsonpath}" 2>&1); then
+    IFS=$'\t' read -r status reason message <<< "${output}" || true
+    if [ "${status}" == "True" ]; then
+      echo "${resource} is ready"
+      exit 0
+    fi
+  else
+    # the resource may not be available yet, keeping the error to report it in case of timeout
+    status=""
+    reason="Error"
+    message="${output}"
+  fi
+
+  if [ "${SECONDS}" -ge "${deadline}" ]; then
+    break
+  fi
+  sleep "${POLL_INTERVAL}"
+done
+
+echo "Timed out waiting for ${resource} to be ready. Ready condition status: ${status:-Unknown}, reason: ${reason:-none}, message: ${message:-no Ready condition reported by External Secrets Operator}" >&2
+exit 1
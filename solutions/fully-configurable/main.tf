@@ -24,10 +24,65 @@ locals {
   sm_ibmcloud_api_key = var.secrets_manager_ibmcloud_api_key == null ? var.ibmcloud_api_key : var.secrets_manager_ibmcloud_api_key
 }
 
+# credentials of the chart repositories read from Secrets Manager
+data "ibm_sm_username_password_secret" "eso_chart_repository_credentials" {
+  count       = var.eso_chart_repository_credentials_secret_id != null ? 1 : 0
+  instance_id = local.sm_guid
+  secret_id   = var.eso_chart_repository_credentials_secret_id
+  provider    = ibm.ibm-sm
+}
+
+data "ibm_sm_username_password_secret" "reloader_chart_repository_credentials" {
+  count       = var.reloader_chart_repository_credentials_secret_id != null ? 1 : 0
+  instance_id = local.sm_guid
+  secret_id   = var.reloader_chart_repository_credentials_secret_id
+  provider    = ibm.ibm-sm
+}
+
+locals {
+  eso_chart_repository_credentials = var.eso_chart_repository_credentials_secret_id != null ? {
+    username = data.ibm_sm_username_password_secret.eso_chart_repository_credentials[0].username
+    password = data.ibm_sm_username_password_secret.eso_chart_repository_credentials[0].password
+  } : null
+  reloader_chart_repository_credentials = var.reloader_chart_repository_credentials_secret_id != null ? {
+    username = data.ibm_sm_username_password_secret.reloader_chart_repository_credentials[0].username
+    password = data.ibm_sm_username_password_secret.reloader_chart_repository_credentials[0].password
+  } : null
+}
+
 data "ibm_container_cluster_config" "cluster_config" {
   cluster_name_id = local.cluster_id
 }
 
+locals {
+  # the VPC of the cluster is added to the network zone of the stores with a cbr_rule including it
+  cbr_include_cluster_vpc = anytrue([
+    for store in concat(values(var.eso_secretsstores_configuration.cluster_secrets_stores), values(var.eso_secretsstores_configuration.secrets_stores)) :
+    store.cbr_rule != null && try(store.cbr_rule.include_cluster_vpc, false)
+  ])
+}
+
+# reading the VPC of the cluster for the context-based restrictions rules, only available for VPC clusters
+data "ibm_container_vpc_cluster" "cluster" {
+  count = local.cbr_include_cluster_vpc ? 1 : 0
+  name  = local.cluster_id
+}
+
+data "ibm_is_vpc" "cluster_vpc" {
+  count      = local.cbr_include_cluster_vpc ? 1 : 0
+  identifier = data.ibm_container_vpc_cluster.cluster[0].vpc_id
+}
+
+# detecting an OpenShift cluster from its namespaces when eso_is_openshift is null, for classic and VPC clusters
+module "eso_cluster_platform" {
+  source       = "../../modules/eso-cluster-platform"
+  is_openshift = var.eso_is_openshift
+}
+
+locals {
+  eso_is_openshift = module.eso_cluster_platform.is_openshift
+}
+
 ##################################################################
 # ESO deployment configuration
 # Configures ESO and reloader deployments
@@ -46,35 +101,51 @@ module "external_secrets_operator" {
   eso_namespace             = var.eso_namespace
   existing_eso_namespace    = var.existing_eso_namespace
   eso_enroll_in_servicemesh = var.eso_enroll_in_servicemesh
+  eso_is_openshift          = local.eso_is_openshift
+  eso_features              = var.eso_features
   # ESO configuration
-  eso_cluster_nodes_configuration = var.eso_cluster_nodes_configuration
-  eso_pod_configuration           = var.eso_pod_configuration
-  eso_image                       = var.eso_image
-  eso_image_version               = var.eso_image_version
-  eso_chart_location              = var.eso_chart_location
-  eso_chart_version               = var.eso_chart_version
-  eso_image_pull_secrets          = var.eso_image_pull_secrets
+  eso_cluster_nodes_configuration  = var.eso_cluster_nodes_configuration
+  eso_pod_configuration            = var.eso_pod_configuration
+  eso_image                        = var.eso_image
+  eso_image_version                = var.eso_image_version
+  eso_chart_location               = var.eso_chart_location
+  eso_chart_version                = var.eso_chart_version
+  eso_chart_repository_credentials = local.eso_chart_repository_credentials
+  image_registry_mirror            = var.image_registry_mirror
+  image_digest_required            = var.image_digest_required
+  eso_log                          = var.eso_log
+  helm_release_settings            = var.helm_release_settings
+  eso_image_pull_secrets           = var.eso_image_pull_secrets
+  eso_custom_values                = var.eso_custom_values
+  eso_crds_separate_release        = var.eso_crds_separate_release
+  eso_crds_keep_on_destroy         = var.eso_crds_keep_on_destroy
+  eso_crds_pre_upgrade_check       = var.eso_crds_pre_upgrade_check
+  kubeconfig_path                  = data.ibm_container_cluster_config.cluster_config.config_file_path
   # reloader configuration
-  reloader_deployed                = var.reloader_deployed
-  reloader_reload_strategy         = var.reloader_reload_strategy
-  reloader_namespaces_to_ignore    = local.reloader_namespaces_to_ignore
-  reloader_resources_to_ignore     = local.reloader_resources_to_ignore
-  reloader_namespaces_selector     = local.reloader_namespaces_selector
-  reloader_resource_label_selector = local.reloader_resource_label_selector
-  reloader_ignore_secrets          = var.reloader_ignore_secrets
-  reloader_ignore_configmaps       = var.reloader_ignore_configmaps
-  reloader_is_openshift            = var.reloader_is_openshift
-  reloader_is_argo_rollouts        = var.reloader_is_argo_rollouts
-  reloader_reload_on_create        = var.reloader_reload_on_create
-  reloader_sync_after_restart      = var.reloader_sync_after_restart
-  reloader_pod_monitor_metrics     = var.reloader_pod_monitor_metrics
-  reloader_log_format              = var.reloader_log_format
-  reloader_custom_values           = var.reloader_custom_values
-  reloader_image                   = var.reloader_image
-  reloader_image_version           = var.reloader_image_version
-  reloader_chart_location          = var.reloader_chart_location
-  reloader_chart_version           = var.reloader_chart_version
-  reloader_image_pull_secrets      = var.reloader_image_pull_secrets
+  reloader_deployed                     = var.reloader_deployed
+  reloader_reload_strategy              = var.reloader_reload_strategy
+  reloader_namespaces_to_ignore         = local.reloader_namespaces_to_ignore
+  reloader_resources_to_ignore          = local.reloader_resources_to_ignore
+  reloader_namespaces_selector          = local.reloader_namespaces_selector
+  reloader_resource_label_selector      = local.reloader_resource_label_selector
+  reloader_ignore_secrets               = var.reloader_ignore_secrets
+  reloader_ignore_configmaps            = var.reloader_ignore_configmaps
+  reloader_is_openshift                 = var.reloader_is_openshift
+  reloader_is_argo_rollouts             = var.reloader_is_argo_rollouts
+  reloader_reload_on_create             = var.reloader_reload_on_create
+  reloader_sync_after_restart           = var.reloader_sync_after_restart
+  reloader_pod_monitor_metrics          = var.reloader_pod_monitor_metrics
+  reloader_log_format                   = var.reloader_log_format
+  reloader_auto_reload_all              = var.reloader_auto_reload_all
+  reloader_custom_annotations           = var.reloader_custom_annotations
+  reloader_custom_values                = var.reloader_custom_values
+  reloader_values                       = var.reloader_values
+  reloader_image                        = var.reloader_image
+  reloader_image_version                = var.reloader_image_version
+  reloader_chart_location               = var.reloader_chart_location
+  reloader_chart_version                = var.reloader_chart_version
+  reloader_chart_repository_credentials = local.reloader_chart_repository_credentials
+  reloader_image_pull_secrets           = var.reloader_image_pull_secrets
 }
 
 ##################################################################
@@ -321,6 +392,7 @@ module "cluster_secrets_store_account_serviceid_apikey" {
     cluster_secrets_store_key => {
       "accountServiceID" : (cluster_secrets_store.existing_serviceid_id == null || cluster_secrets_store.existing_serviceid_id == "") ? ibm_iam_service_id.cluster_secrets_stores_secret_puller[cluster_secrets_store_key].id : cluster_secrets_store.existing_serviceid_id
       "secretGroupID" : cluster_secrets_store.existing_account_secrets_group_id != null && cluster_secrets_store.existing_account_secrets_group_id != "" ? cluster_secrets_store.existing_account_secrets_group_id : module.cluster_secrets_stores_account_secrets_groups[cluster_secrets_store_key].secret_group_id
+      "apikeyRotation" : cluster_secrets_store.apikey_rotation
     }
   })
   source  = "terraform-ibm-modules/iam-serviceid-apikey-secrets-manager/ibm"
@@ -332,11 +404,35 @@ module "cluster_secrets_store_account_serviceid_apikey" {
   serviceid_id              = each.value.accountServiceID
   secrets_manager_guid      = local.sm_guid
   secret_group_id           = each.value.secretGroupID
+  # with the rotation enabled the API key is kept between the reads of the secret, to let ESO sync the same API key until the next rotation
+  sm_iam_secret_api_key_persistence    = each.value.apikeyRotation != null
+  sm_iam_secret_auto_rotation          = each.value.apikeyRotation != null
+  sm_iam_secret_auto_rotation_interval = each.value.apikeyRotation != null ? each.value.apikeyRotation.interval : null
+  sm_iam_secret_auto_rotation_unit     = each.value.apikeyRotation != null ? each.value.apikeyRotation.unit : null
   providers = {
     ibm = ibm.ibm-sm
   }
 }
 
+# Create policy to allow the service id to read its own API key secret from the account secrets group, so that ESO can sync the rotated API key
+resource "ibm_iam_service_policy" "cluster_secrets_store_apikey_reader_policy" {
+  for_each = tomap({
+    for cluster_secrets_store_key, cluster_secrets_store in var.eso_secretsstores_configuration.cluster_secrets_stores :
+    cluster_secrets_store_key => {
+      "accountServiceID" : local.cluster_secrets_stores_policies_to_create[cluster_secrets_store_key].accountServiceID
+      "secretGroupID" : local.cluster_secrets_store_account_serviceid_apikey_secrets[cluster_secrets_store_key].secrets_group_id
+    } if cluster_secrets_store.apikey_rotation != null
+  })
+  iam_id = each.value.accountServiceID
+  roles  = ["SecretsReader"]
+  resources {
+    service              = "secrets-manager"
+    resource_instance_id = local.sm_guid
+    resource_type        = "secret-group"
+    resource             = each.value.secretGroupID
+  }
+}
+
 # data source to get the API key to pull secrets from secrets manager
 data "ibm_sm_iam_credentials_secret" "cluster_secrets_store_account_serviceid_apikey" {
   # for_each = local.cluster_secrets_stores_policies_to_create_map
@@ -580,6 +676,7 @@ module "secrets_store_account_serviceid_apikey" {
     secrets_store_key => {
       "accountServiceID" : (secrets_store.existing_serviceid_id == null || secrets_store.existing_serviceid_id == "") ? ibm_iam_service_id.secrets_stores_secret_puller[secrets_store_key].id : secrets_store.existing_serviceid_id
       "secretGroupID" : secrets_store.existing_account_secrets_group_id != null && secrets_store.existing_account_secrets_group_id != "" ? secrets_store.existing_account_secrets_group_id : module.secrets_stores_account_secrets_groups[secrets_store_key].secret_group_id
+      "apikeyRotation" : secrets_store.apikey_rotation
     }
   })
   source  = "terraform-ibm-modules/iam-serviceid-apikey-secrets-manager/ibm"
@@ -591,6 +688,11 @@ module "secrets_store_account_serviceid_apikey" {
   serviceid_id              = each.value.accountServiceID
   secrets_manager_guid      = local.sm_guid
   secret_group_id           = each.value.secretGroupID
+  # with the rotation enabled the API key is kept between the reads of the secret, to let ESO sync the same API key until the next rotation
+  sm_iam_secret_api_key_persistence    = each.value.apikeyRotation != null
+  sm_iam_secret_auto_rotation          = each.value.apikeyRotation != null
+  sm_iam_secret_auto_rotation_interval = each.value.apikeyRotation != null ? each.value.apikeyRotation.interval : null
+  sm_iam_secret_auto_rotation_unit     = each.value.apikeyRotation != null ? each.value.apikeyRotation.unit : null
   providers = {
     ibm = ibm.ibm-sm
   }
@@ -608,6 +710,25 @@ locals {
   }
 }
 
+# Create policy to allow the service id to read its own API key secret from the account secrets group, so that ESO can sync the rotated API key
+resource "ibm_iam_service_policy" "secrets_store_apikey_reader_policy" {
+  for_each = tomap({
+    for secrets_store_key, secrets_store in var.eso_secretsstores_configuration.secrets_stores :
+    secrets_store_key => {
+      "accountServiceID" : local.secrets_stores_policies_to_create[secrets_store_key].accountServiceID
+      "secretGroupID" : local.secrets_store_account_serviceid_apikey_secrets[secrets_store_key].secrets_group_id
+    } if secrets_store.apikey_rotation != null
+  })
+  iam_id = each.value.accountServiceID
+  roles  = ["SecretsReader"]
+  resources {
+    service              = "secrets-manager"
+    resource_instance_id = local.sm_guid
+    resource_type        = "secret-group"
+    resource             = each.value.secretGroupID
+  }
+}
+
 # # data source to get the API key to pull secrets from secrets manager
 data "ibm_sm_iam_credentials_secret" "secrets_store_account_serviceid_apikey" {
   for_each    = var.eso_secretsstores_configuration.secrets_stores
@@ -628,6 +749,8 @@ module "eso_clustersecretsstore" {
       "secret_apikey" : data.ibm_sm_iam_credentials_secret.cluster_secrets_store_account_serviceid_apikey[cluster_secrets_store_key].api_key != null ? data.ibm_sm_iam_credentials_secret.cluster_secrets_store_account_serviceid_apikey[cluster_secrets_store_key].api_key : null
       "trusted_profile_name" : cluster_secrets_store.trusted_profile_name != null && cluster_secrets_store.trusted_profile_name != "" ? try("${local.prefix}-${cluster_secrets_store.trusted_profile_name}", cluster_secrets_store.trusted_profile_name) : null
       "namespace" : cluster_secrets_store.namespace
+      "apikey_secret_id" : cluster_secrets_store.apikey_rotation != null ? module.cluster_secrets_store_account_serviceid_apikey[cluster_secrets_store_key].secret_id : null
+      "apikey_refresh_interval" : cluster_secrets_store.apikey_rotation != null ? cluster_secrets_store.apikey_rotation.refresh_interval : "1h"
     }
   })
   source                            = "../../modules/eso-clusterstore"
@@ -641,8 +764,16 @@ module "eso_clustersecretsstore" {
   eso_namespace                     = each.value.namespace
   service_endpoints                 = var.service_endpoints
   clusterstore_trusted_profile_name = each.value.trusted_profile_name != null && each.value.trusted_profile_name != "" ? each.value.trusted_profile_name : null
+  eso_features                      = module.external_secrets_operator.eso_features
+  helm_release_settings             = module.external_secrets_operator.helm_release_settings
+  # API key rotation: the API key secret is synced by ESO from the Secrets Manager iam_credentials secret
+  clusterstore_secret_apikey_secret_id        = each.value.apikey_secret_id
+  clusterstore_secret_apikey_refresh_interval = each.value.apikey_refresh_interval
+  # readiness gating
+  wait_for_ready  = var.wait_for_secrets_stores_ready
+  kubeconfig_path = data.ibm_container_cluster_config.cluster_config.config_file_path
   depends_on = [
-    module.external_secrets_operator, module.cluster_secrets_store_namespace
+    module.external_secrets_operator, module.cluster_secrets_store_namespace, ibm_iam_service_policy.cluster_secrets_store_apikey_reader_policy
   ]
 }
 
@@ -656,9 +787,11 @@ module "eso_secretsstore" {
       "secret_apikey" : data.ibm_sm_iam_credentials_secret.secrets_store_account_serviceid_apikey[secrets_store_key].api_key != null ? data.ibm_sm_iam_credentials_secret.secrets_store_account_serviceid_apikey[secrets_store_key].api_key : null
       "trusted_profile_name" : secrets_store.trusted_profile_name != null && secrets_store.trusted_profile_name != "" ? try("${local.prefix}-${secrets_store.trusted_profile_name}", secrets_store.trusted_profile_name) : null
       "namespace" : secrets_store.namespace
+      "apikey_secret_id" : secrets_store.apikey_rotation != null ? module.secrets_store_account_serviceid_apikey[secrets_store_key].secret_id : null
+      "apikey_refresh_interval" : secrets_store.apikey_rotation != null ? secrets_store.apikey_rotation.refresh_interval : "1h"
     }
   })
-  depends_on                  = [module.external_secrets_operator, module.secrets_store_namespace]
+  depends_on                  = [module.external_secrets_operator, module.secrets_store_namespace, ibm_iam_service_policy.secrets_store_apikey_reader_policy]
   source                      = "../../modules/eso-secretstore"
   eso_authentication          = each.value.authentication
   region                      = local.sm_region
@@ -670,4 +803,59 @@ module "eso_secretsstore" {
   sstore_helm_rls_name        = "${each.value.name}-helmrelease"
   sstore_trusted_profile_name = each.value.trusted_profile_name != null && each.value.trusted_profile_name != "" ? each.value.trusted_profile_name : null
   sstore_secret_name          = each.value.secret_apikey != null ? "${each.value.name}-auth-apikey" : null #checkov:skip=CKV_SECRET_6
+  helm_release_settings       = module.external_secrets_operator.helm_release_settings
+  # API key rotation: the API key secret is synced by ESO from the Secrets Manager iam_credentials secret
+  sstore_secret_apikey_secret_id        = each.value.apikey_secret_id
+  sstore_secret_apikey_refresh_interval = each.value.apikey_refresh_interval
+  # readiness gating
+  wait_for_ready  = var.wait_for_secrets_stores_ready
+  kubeconfig_path = data.ibm_container_cluster_config.cluster_config.config_file_path
+}
+
+##################################################################
+# Context-based restrictions
+# Restricts the access to the Secrets Manager instance to the
+# cluster network for each store with a cbr_rule configuration
+##################################################################
+
+module "cluster_secrets_stores_cbr_rule" {
+  for_each = tomap({
+    for cluster_secrets_store_key, cluster_secrets_store in var.eso_secretsstores_configuration.cluster_secrets_stores :
+    cluster_secrets_store_key => cluster_secrets_store.cbr_rule if cluster_secrets_store.cbr_rule != null
+  })
+  source               = "../../modules/eso-cbr-rule"
+  secrets_manager_guid = local.sm_guid
+  zone_name            = try("${local.prefix}-${each.key}-zone", "${each.key}-zone")
+  zone_vpc_crns        = each.value.include_cluster_vpc ? data.ibm_is_vpc.cluster_vpc[*].crn : []
+  zone_ip_addresses    = each.value.zone_ip_addresses
+  existing_zone_ids    = each.value.existing_zone_ids
+  endpoint_types       = each.value.endpoint_types
+  enforcement_mode     = each.value.enforcement_mode
+  rule_description     = "Rule to restrict the access to the secrets manager instance ${local.sm_guid} for the cluster secrets store ${each.key}"
+  providers = {
+    ibm = ibm.ibm-sm
+  }
+  # the rule is created at the end to avoid blocking the Secrets Manager resources creation
+  depends_on = [module.eso_clustersecretsstore]
+}
+
+module "secrets_stores_cbr_rule" {
+  for_each = tomap({
+    for secrets_store_key, secrets_store in var.eso_secretsstores_configuration.secrets_stores :
+    secrets_store_key => secrets_store.cbr_rule if secrets_store.cbr_rule != null
+  })
+  source               = "../../modules/eso-cbr-rule"
+  secrets_manager_guid = local.sm_guid
+  zone_name            = try("${local.prefix}-${each.key}-zone", "${each.key}-zone")
+  zone_vpc_crns        = each.value.include_cluster_vpc ? data.ibm_is_vpc.cluster_vpc[*].crn : []
+  zone_ip_addresses    = each.value.zone_ip_addresses
+  existing_zone_ids    = each.value.existing_zone_ids
+  endpoint_types       = each.value.endpoint_types
+  enforcement_mode     = each.value.enforcement_mode
+  rule_description     = "Rule to restrict the access to the secrets manager instance ${local.sm_guid} for the secrets store ${each.key}"
+  providers = {
+    ibm = ibm.ibm-sm
+  }
+  # the rule is created at the end to avoid blocking the Secrets Manager resources creation
+  depends_on = [module.eso_secretsstore]
 }
@@ -41,3 +41,15 @@ output "secrets_store_account_serviceid_apikey_secrets" {
   description = "Secrets Manager secret created for each secrets store and the related serviceID for the API key to pull secrets from Secrets Manager"
   value       = local.secrets_store_account_serviceid_apikey_secrets
 }
+
+# context-based restrictions created resources
+
+output "cluster_secrets_stores_cbr_rules" {
+  description = "Context-based restrictions rules and network zones created for each cluster secrets store with cbr_rule configuration"
+  value       = module.cluster_secrets_stores_cbr_rule
+}
+
+output "secrets_stores_cbr_rules" {
+  description = "Context-based restrictions rules and network zones created for each secrets store with cbr_rule configuration"
+  value       = module.secrets_stores_cbr_rule
+}
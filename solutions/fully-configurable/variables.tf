@@ -151,6 +151,20 @@ variable "eso_pod_configuration" {
   default = {}
 }
 
+# images registry and digests, for the clusters without access to the public registries
+variable "image_registry_mirror" {
+  type        = string
+  description = "The registry, optionally followed by a path, mirroring the ESO and Reloader images, for example `private.us.icr.io/mirror`: it replaces the registry of eso_image and reloader_image. If null the images are pulled from eso_image and reloader_image. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#air-gapped-installation)"
+  default     = null
+}
+
+variable "image_digest_required" {
+  type        = bool
+  description = "Set to true to require the sha256 digest of the images in eso_image_version and, if the Reloader is deployed, in reloader_image_version."
+  default     = false
+  nullable    = false
+}
+
 # external secrets operator image and helm charts references
 variable "eso_image" {
   type        = string
@@ -165,14 +179,14 @@ variable "eso_image_version" {
   default     = "v2.7.0-ubi@sha256:22735b14bb4fd82c39ad784c22f88657676bd4af22fc1b75c5a11dacc737a740" # datasource: ghcr.io/external-secrets/external-secrets
   nullable    = false
   validation {
-    condition     = can(regex("(^v\\d+\\.\\d+.\\d+(\\-\\w+)?(\\@sha256\\:\\w+){0,1})$", var.eso_image_version))
-    error_message = "The value of the external secrets image version must match classic version or the tag and sha256 image digest format"
+    condition     = can(regex("^v\\d+\\.\\d+\\.\\d+(\\-\\w+)?(\\@sha256\\:[a-f0-9]{64})?$", var.eso_image_version))
+    error_message = "The value of the external secrets image version must match classic version or the tag and sha256 image digest format, the digest being made of 64 lowercase hexadecimal characters"
   }
 }
 
 variable "eso_chart_location" {
   type        = string
-  description = "The location of the External Secrets Operator Helm chart."
+  description = "The location of the External Secrets Operator Helm chart: the URL of a chart repository or the `oci://` URL of the OCI registry repository containing the chart (for example `oci://private.us.icr.io/mirror/charts`)."
   default     = "https://charts.external-secrets.io"
   nullable    = false
 }
@@ -184,6 +198,44 @@ variable "eso_chart_version" {
   nullable    = false
 }
 
+variable "eso_chart_repository_credentials_secret_id" {
+  type        = string
+  description = "The ID of the username and password secret of the Secrets Manager instance of existing_secrets_manager_crn holding the credentials of the External Secrets Operator Helm chart repository or OCI registry of eso_chart_location. If null the chart is pulled anonymously. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#air-gapped-installation)"
+  default     = null
+}
+
+variable "eso_log" {
+  type = object({
+    level         = optional(string, "info")
+    time_encoding = optional(string, "epoch")
+    webhook = optional(object({
+      level         = optional(string)
+      time_encoding = optional(string)
+    }), {})
+    cert_controller = optional(object({
+      level         = optional(string)
+      time_encoding = optional(string)
+    }), {})
+  })
+  description = "The logging configuration of the External Secrets Operator: the `level` (`debug`, `info`, `warn` or `error`) and the `time_encoding` of the timestamps (`epoch`, `millis`, `nano`, `iso8601`, `rfc3339` or `rfc3339nano`) of the controller logs, used also by the webhook and the cert controller unless overridden in `webhook` and `cert_controller`. ESO always writes JSON structured logs. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#eso-logging)"
+  default     = {}
+  nullable    = false
+}
+
+variable "helm_release_settings" {
+  type = object({
+    timeout         = optional(number)
+    atomic          = optional(bool)
+    wait            = optional(bool, true)
+    wait_for_jobs   = optional(bool, false)
+    cleanup_on_fail = optional(bool, false)
+    max_history     = optional(number, 0)
+  })
+  description = "The helm behaviour of all the helm releases of the deployable architecture, ESO, reloader and secrets stores: `timeout` in seconds of each helm operation, 300 for the ESO and reloader releases and 600 for the secrets stores releases if null, `atomic` to purge the release on a failed install and roll it back on a failed upgrade, `wait` to wait for the resources of the releases to be ready, `wait_for_jobs` to wait also for the jobs to complete, `cleanup_on_fail` to delete the resources created by a failed upgrade and `max_history` to limit the number of revisions kept by helm, 0 for no limit. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#helm-release-settings)"
+  default     = {}
+  nullable    = false
+}
+
 variable "eso_image_pull_secrets" {
   type        = list(string)
   description = "The list of global imagePullSecrets that will be added to every ESO deployments. The referenced secrets must already exist in the target Kubernetes namespace before deployment. This module does not create or manage imagePullSecret resources; it only configures existing secrets for use by the deployments."
@@ -191,6 +243,33 @@ variable "eso_image_pull_secrets" {
   nullable    = false
 }
 
+variable "eso_custom_values" {
+  type        = string
+  description = "String containing custom values to be used for the External Secrets Operator helm chart, merged after the values set by the module. More details [here](https://github.com/external-secrets/external-secrets/blob/main/deploy/charts/external-secrets/values.yaml). The keys owned by the module (`installCRDs` and the `extraVolumes` and `extraVolumeMounts` of the controller and of the webhook, mounting the `sa-token` used by the Trusted Profile authentication) can't be set, and the keys set by the module through the other ESO input variables, which take precedence over the ones of this string, are reported with a warning"
+  default     = null
+}
+
+variable "eso_crds_separate_release" {
+  type        = bool
+  description = "Whether to manage the External Secrets Operator CRDs in a dedicated helm release (`external-secrets-crds`) instead of the ESO helm release, so that the CRDs are not upgraded, rolled back or deleted with the ESO deployment. To switch an existing installation, apply first with eso_crds_keep_on_destroy set to true, then switch with eso_crds_pre_upgrade_check enabled to move the existing CRDs to the new release."
+  default     = false
+  nullable    = false
+}
+
+variable "eso_crds_keep_on_destroy" {
+  type        = bool
+  description = "Whether to keep the External Secrets Operator CRDs, and therefore all the ESO resources of the cluster, when the helm release installing them is destroyed, through the `helm.sh/resource-policy: keep` annotation. It applies to the release installing the CRDs, the ESO helm release unless eso_crds_separate_release is true. False by default, as in the previous versions of the module, so that the upgrade doesn't change the CRDs of the existing installations: set it to true before switching to eso_crds_separate_release."
+  default     = false
+  nullable    = false
+}
+
+variable "eso_crds_pre_upgrade_check" {
+  type        = bool
+  description = "Set to true to check, before the install or the upgrade of the External Secrets Operator CRDs, that the versions stored in the cluster (for example v1beta1 before the v1 storage) are still served by the new CRDs, and to move the CRDs to the helm release managing them when eso_crds_separate_release is changed. It requires kubectl to be available where terraform runs."
+  default     = false
+  nullable    = false
+}
+
 # ESO
 variable "eso_enroll_in_servicemesh" {
   description = "Flag to enroll the External Secrets Operator into RedHat Service Mesh adding the istio-injection annotation to the ESO namespace and to ESO pods. Default to false."
@@ -198,6 +277,25 @@ variable "eso_enroll_in_servicemesh" {
   default     = false
 }
 
+variable "eso_is_openshift" {
+  description = "Whether the cluster is a Red Hat OpenShift cluster, to have the user ID of the ESO pods assigned by the restricted-v2 SCC from the namespace UID range instead of the runAsUser 1000. Set it to null to detect it from the namespaces of the cluster, for both classic and VPC clusters. Defaults to false so that the user ID of the existing deployments is not changed."
+  type        = bool
+  default     = false
+}
+
+variable "eso_features" {
+  description = "The ESO resource kinds to support: setting a kind to false disables its controller and the creation of its CRD. The ClusterSecretStores of eso_secretsstores_configuration require cluster_secret_store. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#eso-resource-kinds)"
+  type = object({
+    cluster_secret_store    = optional(bool, true)
+    cluster_external_secret = optional(bool, true)
+    push_secret             = optional(bool, true)
+    cluster_push_secret     = optional(bool, true)
+    cluster_generator       = optional(bool, true)
+  })
+  default  = {}
+  nullable = false
+}
+
 ############################################################################################################
 # RELOADER DEPLOYMENT CONFIGURATION
 ############################################################################################################
@@ -294,12 +392,61 @@ variable "reloader_log_format" {
   }
 }
 
+variable "reloader_auto_reload_all" {
+  description = "Whether reloader reloads the workloads on the update of any secret or configmap they consume, without the workloads being annotated"
+  type        = bool
+  default     = false
+}
+
+variable "reloader_custom_annotations" {
+  description = "Custom annotation keys used by reloader in place of the default ones: `auto` (`reloader.stakater.com/auto`), `search` (`reloader.stakater.com/search`), `match` (`reloader.stakater.com/match`), `secret` (`secret.reloader.stakater.com/reload`) and `configmap` (`configmap.reloader.stakater.com/reload`)"
+  type = object({
+    auto      = optional(string)
+    search    = optional(string)
+    match     = optional(string)
+    secret    = optional(string)
+    configmap = optional(string)
+  })
+  default  = {}
+  nullable = false
+}
+
 variable "reloader_custom_values" {
-  description = "String containing custom values to be used for reloader helm chart. More details [here](https://github.com/stakater/Reloader/blob/master/deployments/kubernetes/chart/reloader/values.yaml)"
+  description = "String containing custom values to be used for reloader helm chart. More details [here](https://github.com/stakater/Reloader/blob/master/deployments/kubernetes/chart/reloader/values.yaml). The keys set by the other reloader input variables take precedence over the ones of this string and are reported with a warning. Prefer `reloader_values` for the settings it supports"
   type        = string
   default     = null
 }
 
+variable "reloader_values" {
+  description = "Values of the reloader helm chart, overriding the ones of `reloader_custom_values`: `replicas` and `resources` of the reloader deployment, `high_availability` to enable the leader election between the replicas (at least 2 replicas are required), `service_monitor` to create a Prometheus ServiceMonitor and `rbac` to disable the RBAC resources of the chart or to restrict their `scope` to the reloader namespace (`namespace`, reloader only watching its namespace) instead of the cluster (`cluster`). Ignore the keys if not required"
+  type = object({
+    replicas = optional(number)
+    resources = optional(object({
+      requests = optional(object({
+        cpu    = optional(string)
+        memory = optional(string)
+      }))
+      limits = optional(object({
+        cpu    = optional(string)
+        memory = optional(string)
+      }))
+    }))
+    high_availability = optional(bool)
+    service_monitor = optional(object({
+      enabled  = optional(bool, true)
+      interval = optional(string)
+      timeout  = optional(string)
+      labels   = optional(map(string), {})
+    }))
+    rbac = optional(object({
+      enabled = optional(bool, true)
+      scope   = optional(string, "cluster")
+    }))
+  })
+  default  = {}
+  nullable = false
+}
+
 # reloader image and helm charts references
 variable "reloader_image" {
   type        = string
@@ -314,14 +461,14 @@ variable "reloader_image_version" {
   default     = "v1.4.19-ubi@sha256:19b44d99e04ff043f6c1b0c0c7bbc2622af23f9650fca65632b0c76b1c0a4245" # datasource: ghcr.io/stakater/reloader
   nullable    = false
   validation {
-    condition     = can(regex("(^v\\d+\\.\\d+.\\d+(\\-\\w+)?(\\@sha256\\:\\w+){0,1})$", var.reloader_image_version))
-    error_message = "The value of the reloader image version must match classic version or the tag and sha256 image digest format"
+    condition     = can(regex("^v\\d+\\.\\d+\\.\\d+(\\-\\w+)?(\\@sha256\\:[a-f0-9]{64})?$", var.reloader_image_version))
+    error_message = "The value of the reloader image version must match classic version or the tag and sha256 image digest format, the digest being made of 64 lowercase hexadecimal characters"
   }
 }
 
 variable "reloader_chart_location" {
   type        = string
-  description = "The location of the Reloader Helm chart."
+  description = "The location of the Reloader Helm chart: the URL of a chart repository or the `oci://` URL of the OCI registry repository containing the chart (for example `oci://private.us.icr.io/mirror/charts`)."
   default     = "https://stakater.github.io/stakater-charts"
   nullable    = false
 }
@@ -333,6 +480,12 @@ variable "reloader_chart_version" {
   nullable    = false
 }
 
+variable "reloader_chart_repository_credentials_secret_id" {
+  type        = string
+  description = "The ID of the username and password secret of the Secrets Manager instance of existing_secrets_manager_crn holding the credentials of the Reloader Helm chart repository or OCI registry of reloader_chart_location. If null the chart is pulled anonymously. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#air-gapped-installation)"
+  default     = null
+}
+
 variable "reloader_image_pull_secrets" {
   type        = list(string)
   description = "The list of global imagePullSecrets that will be added to every reloader deployments. The referenced secrets must already exist in the target Kubernetes namespace before deployment. This module does not create or manage imagePullSecret resources; it only configures existing secrets for use by the deployments."
@@ -361,6 +514,18 @@ variable "eso_secretsstores_configuration" {
         name        = string
         description = string
       })), [])
+      apikey_rotation = optional(object({
+        interval         = optional(number, 30)
+        unit             = optional(string, "day")
+        refresh_interval = optional(string, "1h")
+      }), null)
+      cbr_rule = optional(object({
+        enforcement_mode    = optional(string, "report")
+        endpoint_types      = optional(list(string), ["private"])
+        include_cluster_vpc = optional(bool, true)
+        zone_ip_addresses   = optional(list(string), [])
+        existing_zone_ids   = optional(list(string), [])
+      }), null)
     }))
     secrets_stores = map(object({
       create_namespace                       = bool
@@ -378,12 +543,47 @@ variable "eso_secretsstores_configuration" {
         name        = string
         description = string
       })), [])
+      apikey_rotation = optional(object({
+        interval         = optional(number, 30)
+        unit             = optional(string, "day")
+        refresh_interval = optional(string, "1h")
+      }), null)
+      cbr_rule = optional(object({
+        enforcement_mode    = optional(string, "report")
+        endpoint_types      = optional(list(string), ["private"])
+        include_cluster_vpc = optional(bool, true)
+        zone_ip_addresses   = optional(list(string), [])
+        existing_zone_ids   = optional(list(string), [])
+      }), null)
     }))
   })
   default = {
     cluster_secrets_stores = {}
     secrets_stores         = {}
   }
+
+  validation {
+    condition = alltrue([
+      for store in concat(values(var.eso_secretsstores_configuration.cluster_secrets_stores), values(var.eso_secretsstores_configuration.secrets_stores)) :
+      store.cbr_rule == null ? true : contains(["enabled", "disabled", "report"], store.cbr_rule.enforcement_mode)
+    ])
+    error_message = "The cbr_rule enforcement_mode of each store must be one of 'enabled', 'disabled' or 'report'."
+  }
+
+  validation {
+    condition = alltrue([
+      for store in concat(values(var.eso_secretsstores_configuration.cluster_secrets_stores), values(var.eso_secretsstores_configuration.secrets_stores)) :
+      store.apikey_rotation == null ? true : contains(["day", "month"], store.apikey_rotation.unit) && store.apikey_rotation.interval >= 1
+    ])
+    error_message = "The apikey_rotation unit of each store must be one of 'day' or 'month' and the interval must be at least 1."
+  }
+}
+
+variable "wait_for_secrets_stores_ready" {
+  type        = bool
+  description = "Set to true to wait for each cluster secrets store and secrets store to be ready after its creation, failing the deployment with the External Secrets Operator error if the store can't connect to Secrets Manager. It requires kubectl to be available in the Terraform runtime: kubectl is not guaranteed in the IBM Cloud Schematics runtime, so keep it false when deploying from Schematics unless kubectl is available there."
+  default     = false
+  nullable    = false
 }
 
 variable "service_endpoints" {
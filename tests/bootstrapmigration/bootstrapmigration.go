@@ -0,0 +1,29 @@
+// Package bootstrapmigration runs the migrate-apikey-bootstrap-secret.sh script, moving in the Terraform state the API
+// key secret of the store modules to the bootstrap secret before the apply enabling the API key rotation.
+package bootstrapmigration
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// Command returns the command running the script in the Terraform root directory for the store modules, with the
+// terraform binary, "terraform" if empty
+func Command(ctx context.Context, terraformDir string, terraform string, moduleAddresses ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "bash", append([]string{Script()}, moduleAddresses...)...)
+	cmd.Dir = terraformDir
+	cmd.Env = os.Environ()
+	if terraform != "" {
+		cmd.Env = append(cmd.Env, "TERRAFORM="+terraform)
+	}
+	return cmd
+}
+
+// Script returns the absolute path of the migration script, run from the Terraform root directory
+func Script() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "scripts", "migrate-apikey-bootstrap-secret.sh")
+}
@@ -0,0 +1,91 @@
+// Tests in this file are run in the PR pipeline
+package bootstrapmigration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTerraform implements the state list and state mv commands on the addresses listed in the state file of the
+// directory
+const fakeTerraform = `#!/bin/bash
+set -euo pipefail
+case "$1 $2" in
+  "state list") cat terraform.state ;;
+  "state mv")
+    grep -qxF "$3" terraform.state
+    while IFS= read -r address; do
+      if [ "${address}" == "$3" ]; then echo "$4"; else echo "${address}"; fi
+    done < terraform.state > terraform.state.new
+    mv terraform.state.new terraform.state
+    ;;
+  *) exit 2 ;;
+esac
+`
+
+const (
+	secretstoreModule  = `module.eso_secretsstore["secrets-store-1"]`
+	clusterstoreModule = `module.eso_clustersecretsstore["cluster-secrets-store-1"]`
+)
+
+// terraformDir returns a directory with the fake terraform binary and a state with the addresses
+func terraformDir(t *testing.T, addresses ...string) (string, string) {
+	dir := t.TempDir()
+	terraform := filepath.Join(dir, "terraform")
+	require.NoError(t, os.WriteFile(terraform, []byte(fakeTerraform), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "terraform.state"), []byte(strings.Join(addresses, "\n")+"\n"), 0o600))
+	return dir, terraform
+}
+
+func readState(t *testing.T, dir string) []string {
+	content, err := os.ReadFile(filepath.Join(dir, "terraform.state"))
+	require.NoError(t, err)
+	return strings.Fields(string(content))
+}
+
+func TestMigration(t *testing.T) {
+	t.Parallel()
+
+	otherSecret := `module.eso_secretsstore["secrets-store-2"].kubernetes_secret_v1.eso_secretsstore_secret[0]`
+	dir, terraform := terraformDir(t,
+		secretstoreModule+".kubernetes_secret_v1.eso_secretsstore_secret[0]",
+		clusterstoreModule+".kubernetes_secret_v1.eso_clusterstore_secret[0]",
+		otherSecret,
+	)
+
+	output, err := Command(context.Background(), dir, terraform, secretstoreModule, clusterstoreModule).CombinedOutput()
+	require.NoError(t, err, string(output))
+	// the stores not listed are not migrated
+	assert.Equal(t, []string{
+		secretstoreModule + ".kubernetes_secret_v1.eso_secretsstore_bootstrap_secret[0]",
+		clusterstoreModule + ".kubernetes_secret_v1.eso_clusterstore_bootstrap_secret[0]",
+		otherSecret,
+	}, readState(t, dir))
+
+	// running it again doesn't change the state
+	output, err = Command(context.Background(), dir, terraform, secretstoreModule, clusterstoreModule).CombinedOutput()
+	require.NoError(t, err, string(output))
+	assert.Contains(t, string(output), secretstoreModule+" already migrated")
+	assert.Len(t, readState(t, dir), 3)
+}
+
+func TestMigrationWithoutSecret(t *testing.T) {
+	t.Parallel()
+
+	// trusted profile stores have no API key secret
+	dir, terraform := terraformDir(t, secretstoreModule+".helm_release.external_secret_store_tp[0]")
+
+	output, err := Command(context.Background(), dir, terraform, secretstoreModule).CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "No API key secret of "+secretstoreModule+" found in the state")
+
+	output, err = Command(context.Background(), dir, terraform).CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(output), "Usage:")
+}
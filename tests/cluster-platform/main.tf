@@ -0,0 +1,4 @@
+module "eso_cluster_platform" {
+  source       = "../../modules/eso-cluster-platform"
+  is_openshift = var.is_openshift
+}
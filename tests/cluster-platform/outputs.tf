@@ -0,0 +1,4 @@
+output "is_openshift" {
+  value       = module.eso_cluster_platform.is_openshift
+  description = "Whether the cluster is detected as a Red Hat OpenShift cluster"
+}
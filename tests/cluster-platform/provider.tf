@@ -0,0 +1,5 @@
+# the namespaces are listed by the plan from the local API server started by the test
+provider "kubernetes" {
+  host     = var.cluster_host
+  insecure = true
+}
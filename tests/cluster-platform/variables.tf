@@ -0,0 +1,10 @@
+variable "cluster_host" {
+  type        = string
+  description = "Address of the Kubernetes API server listing the namespaces of the cluster."
+}
+
+variable "is_openshift" {
+  type        = bool
+  description = "Whether the cluster is a Red Hat OpenShift cluster, detected if null."
+  default     = null
+}
@@ -0,0 +1,83 @@
+// Tests in this file are run in the PR pipeline
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const clusterPlatformTerraformDir = "tests/cluster-platform"
+
+// newNamespacesAPIServer returns a local API server listing the namespaces, with the number of namespace lists served
+func newNamespacesAPIServer(t *testing.T, namespaces ...string) (*httptest.Server, *atomic.Int32) {
+	lists := &atomic.Int32{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/version":
+			_ = json.NewEncoder(w).Encode(map[string]string{"major": "1", "minor": "31", "gitVersion": "v1.31.0"})
+		case "/api/v1/namespaces":
+			lists.Add(1)
+			list := corev1.NamespaceList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "NamespaceList"}}
+			for _, namespace := range namespaces {
+				list.Items = append(list.Items, corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+			}
+			_ = json.NewEncoder(w).Encode(list)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, lists
+}
+
+// planClusterPlatform runs terraform plan on the cluster platform fixture and returns the planned is_openshift output
+func planClusterPlatform(t *testing.T, terraformDir string, terraformVars map[string]interface{}) interface{} {
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: terraformDir,
+		Vars:         terraformVars,
+		NoColor:      true,
+	})
+
+	plan, err := terraform.InitAndPlanAndShowWithStructContextE(t, context.Background(), options)
+	require.NoError(t, err, "Plan of the cluster platform detection should not have errored")
+	output, found := plan.RawPlan.OutputChanges["is_openshift"]
+	require.True(t, found, "is_openshift output not found in plan")
+	return output.After
+}
+
+func TestClusterPlatformPlan(t *testing.T) {
+	t.Parallel()
+
+	// the fixture references the module through a relative path so the whole repo is copied
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", clusterPlatformTerraformDir)
+
+	t.Run("openshift", func(t *testing.T) {
+		// classic and VPC OpenShift clusters have the same namespaces
+		server, _ := newNamespacesAPIServer(t, "default", "kube-system", "openshift-config", "openshift-ingress")
+		assert.Equal(t, true, planClusterPlatform(t, terraformDir, map[string]interface{}{"cluster_host": server.URL}))
+	})
+
+	t.Run("kubernetes", func(t *testing.T) {
+		server, _ := newNamespacesAPIServer(t, "default", "kube-system", "ibm-system")
+		assert.Equal(t, false, planClusterPlatform(t, terraformDir, map[string]interface{}{"cluster_host": server.URL}))
+	})
+
+	t.Run("override", func(t *testing.T) {
+		// the namespaces are not listed when is_openshift is set
+		server, lists := newNamespacesAPIServer(t, "default", "openshift-config")
+		assert.Equal(t, false, planClusterPlatform(t, terraformDir, map[string]interface{}{"cluster_host": server.URL, "is_openshift": false}))
+		assert.Zero(t, lists.Load())
+	})
+}
@@ -0,0 +1,17 @@
+##################################################################
+# ESO deployment with the helm release values to verify at plan time
+##################################################################
+
+module "external_secrets_operator" {
+  source                    = "../../"
+  eso_namespace             = var.eso_namespace
+  eso_is_openshift          = var.eso_is_openshift
+  eso_features              = var.eso_features
+  image_registry_mirror     = var.image_registry_mirror
+  eso_log                   = var.eso_log
+  helm_release_settings     = var.helm_release_settings
+  eso_crds_separate_release = var.eso_crds_separate_release
+  eso_scoped_installations  = var.eso_scoped_installations
+  eso_custom_values         = var.eso_custom_values
+  reloader_deployed         = false
+}
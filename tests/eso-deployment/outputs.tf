@@ -0,0 +1,8 @@
+##############################################################################
+# Outputs
+##############################################################################
+
+output "eso_namespace" {
+  description = "Namespace of the ESO deployment"
+  value       = var.eso_namespace
+}
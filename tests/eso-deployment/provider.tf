@@ -0,0 +1,12 @@
+# nothing is applied by the plan tests: the providers don't need to reach the cluster
+provider "kubernetes" {
+  host     = var.cluster_host
+  insecure = true
+}
+
+provider "helm" {
+  kubernetes = {
+    host     = var.cluster_host
+    insecure = true
+  }
+}
@@ -0,0 +1,96 @@
+#######################################################################
+# Generic
+#######################################################################
+
+variable "cluster_host" {
+  type        = string
+  description = "Address of the Kubernetes API server configured in the providers, not reached by the plan."
+  default     = "https://127.0.0.1:6443"
+}
+
+#######################################################################
+# ESO deployment
+#######################################################################
+
+variable "eso_namespace" {
+  type        = string
+  description = "Namespace to deploy ESO into."
+  default     = "es-operator"
+}
+
+variable "eso_is_openshift" {
+  type        = bool
+  description = "Whether ESO is deployed on an OpenShift cluster."
+  default     = false
+}
+
+variable "eso_features" {
+  type = object({
+    cluster_secret_store    = optional(bool, true)
+    cluster_external_secret = optional(bool, true)
+    push_secret             = optional(bool, true)
+    cluster_push_secret     = optional(bool, true)
+    cluster_generator       = optional(bool, true)
+  })
+  description = "The ESO resource kinds to support."
+  default     = {}
+}
+
+variable "image_registry_mirror" {
+  type        = string
+  description = "The registry mirroring the ESO image."
+  default     = null
+}
+
+variable "eso_log" {
+  type = object({
+    level         = optional(string, "info")
+    time_encoding = optional(string, "epoch")
+    webhook = optional(object({
+      level         = optional(string)
+      time_encoding = optional(string)
+    }), {})
+    cert_controller = optional(object({
+      level         = optional(string)
+      time_encoding = optional(string)
+    }), {})
+  })
+  description = "The logging configuration of ESO."
+  default     = {}
+}
+
+variable "helm_release_settings" {
+  type = object({
+    timeout         = optional(number)
+    atomic          = optional(bool)
+    wait            = optional(bool, true)
+    wait_for_jobs   = optional(bool, false)
+    cleanup_on_fail = optional(bool, false)
+    max_history     = optional(number, 0)
+  })
+  description = "The helm behaviour of the ESO helm releases."
+  default     = {}
+}
+
+variable "eso_crds_separate_release" {
+  type        = bool
+  description = "Whether to manage the ESO CRDs in a dedicated helm release."
+  default     = false
+}
+
+variable "eso_scoped_installations" {
+  type = map(object({
+    controller_class = string
+    namespace        = optional(string)
+    scoped_namespace = optional(string)
+    scoped_rbac      = optional(bool, true)
+  }))
+  description = "Additional ESO installations, passed as is to verify the validation of the module."
+  default     = {}
+}
+
+variable "eso_custom_values" {
+  type        = string
+  description = "Custom values of the ESO helm releases."
+  default     = null
+}
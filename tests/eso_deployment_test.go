@@ -0,0 +1,305 @@
+// Tests in this file are run in the PR pipeline
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const esoDeploymentTerraformDir = "tests/eso-deployment"
+
+// address of the ESO helm release in the plan of the fixture
+const esoReleaseAddress = "module.external_secrets_operator.helm_release.external_secrets_operator"
+
+// address of the helm releases of the ESO scoped installations in the plan of the fixture
+const esoScopedReleaseAddress = "module.external_secrets_operator.helm_release.external_secrets_operator_scoped"
+
+// address of the helm release of the ESO CRDs in the plan of the fixture
+const esoCRDsReleaseAddress = "module.external_secrets_operator.helm_release.external_secrets_operator_crds[0]"
+
+// planESODeployment runs terraform plan on the ESO deployment fixture with the given input variables
+func planESODeployment(t *testing.T, terraformDir string, terraformVars map[string]interface{}) *terraform.PlanStruct {
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: terraformDir,
+		Vars:         terraformVars,
+		NoColor:      true,
+	})
+
+	plan, err := terraform.InitAndPlanAndShowWithStructContextE(t, context.Background(), options)
+	require.NoError(t, err, "Plan of the ESO deployment should not have errored")
+	return plan
+}
+
+// plannedHelmSet returns the values of the set of the planned helm release with the given address, by name
+func plannedHelmSet(t *testing.T, plan *terraform.PlanStruct, address string) map[string]interface{} {
+	resource, found := plan.ResourcePlannedValuesMap[address]
+	require.True(t, found, "Helm release %s not found in plan", address)
+	entries, ok := resource.AttributeValues["set"].([]interface{})
+	require.True(t, ok, "set of the helm release %s not found in planned values", address)
+
+	set := map[string]interface{}{}
+	for _, entry := range entries {
+		values := entry.(map[string]interface{})
+		set[values["name"].(string)] = values["value"]
+	}
+	return set
+}
+
+// plannedHelmValues returns the documents of the values of the planned helm release with the given address, in order
+func plannedHelmValues(t *testing.T, plan *terraform.PlanStruct, address string) []map[string]interface{} {
+	resource, found := plan.ResourcePlannedValuesMap[address]
+	require.True(t, found, "Helm release %s not found in plan", address)
+	entries, ok := resource.AttributeValues["values"].([]interface{})
+	require.True(t, ok, "values of the helm release %s not found in planned values", address)
+
+	documents := []map[string]interface{}{}
+	for _, entry := range entries {
+		document := map[string]interface{}{}
+		require.NoError(t, yaml.Unmarshal([]byte(entry.(string)), &document))
+		documents = append(documents, document)
+	}
+	return documents
+}
+
+// planErrorMessage returns the text of the diagnostics of a failed plan, without the box drawing and the line wrapping of terraform
+func planErrorMessage(err error) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(err.Error(), "│", " ")), " ")
+}
+
+func TestESODeploymentPlan(t *testing.T) {
+	t.Parallel()
+
+	// the fixture references the module through a relative path so the whole repo is copied
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", esoDeploymentTerraformDir)
+
+	// user ID set to null in the helm release of each ESO component on OpenShift
+	runAsUserKeys := []string{"securityContext.runAsUser", "webhook.securityContext.runAsUser", "certController.securityContext.runAsUser"}
+
+	t.Run("kubernetes", func(t *testing.T) {
+		plan := planESODeployment(t, terraformDir, map[string]interface{}{
+			"eso_is_openshift": false,
+		})
+
+		// the runAsUser 1000 of the module values is kept
+		set := plannedHelmSet(t, plan, esoReleaseAddress)
+		for _, key := range runAsUserKeys {
+			assert.NotContains(t, set, key)
+		}
+	})
+
+	t.Run("openshift", func(t *testing.T) {
+		plan := planESODeployment(t, terraformDir, map[string]interface{}{
+			"eso_is_openshift": true,
+		})
+
+		// the user ID is left to the restricted-v2 SCC
+		set := plannedHelmSet(t, plan, esoReleaseAddress)
+		for _, key := range runAsUserKeys {
+			assert.Equal(t, "null", set[key], "%s should be set to null on OpenShift", key)
+		}
+	})
+}
+
+func TestESOFeaturesPlan(t *testing.T) {
+	t.Parallel()
+
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", esoDeploymentTerraformDir)
+	plan := planESODeployment(t, terraformDir, map[string]interface{}{
+		"eso_features": map[string]interface{}{
+			"cluster_secret_store": false,
+			"push_secret":          false,
+			"cluster_push_secret":  false,
+		},
+	})
+
+	// only the controllers of the disabled kinds are set, the others keeping the chart defaults
+	set := plannedHelmSet(t, plan, esoReleaseAddress)
+	for _, flag := range []string{"processClusterStore", "processPushSecret", "processClusterPushSecret"} {
+		assert.Equal(t, "false", set[flag], "%s should be disabled", flag)
+	}
+	assert.NotContains(t, set, "processClusterExternalSecret")
+
+	// the CRDs of the disabled kinds are not created by the release installing the CRDs
+	var crds map[string]interface{}
+	for _, document := range plannedHelmValues(t, plan, esoReleaseAddress) {
+		if values, found := document["crds"].(map[string]interface{}); found {
+			crds = values
+		}
+	}
+	require.NotNil(t, crds, "crds values not found in the ESO helm release")
+	assert.Equal(t, false, crds["createClusterSecretStore"])
+	assert.Equal(t, false, crds["createPushSecret"])
+	assert.Equal(t, false, crds["createClusterPushSecret"])
+	assert.Equal(t, true, crds["createClusterExternalSecret"])
+	assert.Equal(t, true, crds["createClusterGenerator"])
+}
+
+func TestESOImageRegistryMirrorPlan(t *testing.T) {
+	t.Parallel()
+
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", esoDeploymentTerraformDir)
+	plan := planESODeployment(t, terraformDir, map[string]interface{}{
+		"image_registry_mirror": "private.us.icr.io/mirror",
+	})
+
+	// the registry of the default image is replaced by the mirror for all the ESO components
+	set := plannedHelmSet(t, plan, esoReleaseAddress)
+	for _, key := range []string{"image.repository", "webhook.image.repository", "certController.image.repository"} {
+		assert.Equal(t, "private.us.icr.io/mirror/external-secrets/external-secrets", set[key], "%s should be pulled from the mirror", key)
+	}
+}
+
+func TestESOLogPlan(t *testing.T) {
+	t.Parallel()
+
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", esoDeploymentTerraformDir)
+	plan := planESODeployment(t, terraformDir, map[string]interface{}{
+		"eso_log": map[string]interface{}{
+			"level":         "debug",
+			"time_encoding": "iso8601",
+			"webhook": map[string]interface{}{
+				"level": "info",
+			},
+		},
+	})
+
+	set := plannedHelmSet(t, plan, esoReleaseAddress)
+	assert.Equal(t, "debug", set["log.level"])
+	assert.Equal(t, "iso8601", set["log.timeEncoding"])
+	// the cert controller inherits the configuration of the controller
+	assert.Equal(t, "debug", set["certController.log.level"])
+	assert.Equal(t, "iso8601", set["certController.log.timeEncoding"])
+	// the level of the webhook is overridden with the chart default, so only its time encoding is set
+	assert.NotContains(t, set, "webhook.log.level")
+	assert.Equal(t, "iso8601", set["webhook.log.timeEncoding"])
+}
+
+func TestHelmReleaseSettingsPlan(t *testing.T) {
+	t.Parallel()
+
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", esoDeploymentTerraformDir)
+
+	t.Run("default", func(t *testing.T) {
+		plan := planESODeployment(t, terraformDir, map[string]interface{}{})
+
+		// the helm timeout and the rollback_on_failure of the module
+		release := plan.ResourcePlannedValuesMap[esoReleaseAddress]
+		require.NotNil(t, release, "Helm release %s not found in plan", esoReleaseAddress)
+		assert.Equal(t, float64(300), release.AttributeValues["timeout"])
+		assert.Equal(t, false, release.AttributeValues["atomic"])
+		assert.Equal(t, true, release.AttributeValues["wait"])
+		assert.Equal(t, float64(0), release.AttributeValues["max_history"])
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		plan := planESODeployment(t, terraformDir, map[string]interface{}{
+			"helm_release_settings": map[string]interface{}{
+				"timeout":         900,
+				"atomic":          true,
+				"wait_for_jobs":   true,
+				"cleanup_on_fail": true,
+				"max_history":     5,
+			},
+			"eso_crds_separate_release": true,
+		})
+
+		release := plan.ResourcePlannedValuesMap[esoReleaseAddress]
+		require.NotNil(t, release, "Helm release %s not found in plan", esoReleaseAddress)
+		assert.Equal(t, float64(900), release.AttributeValues["timeout"])
+		assert.Equal(t, true, release.AttributeValues["atomic"])
+		assert.Equal(t, true, release.AttributeValues["wait_for_jobs"])
+		assert.Equal(t, true, release.AttributeValues["cleanup_on_fail"])
+		assert.Equal(t, float64(5), release.AttributeValues["max_history"])
+
+		// the CRDs release is never purged nor rolled back, the other settings apply
+		crds := plan.ResourcePlannedValuesMap[esoCRDsReleaseAddress]
+		require.NotNil(t, crds, "Helm release %s not found in plan", esoCRDsReleaseAddress)
+		assert.Equal(t, false, crds.AttributeValues["atomic"])
+		assert.Equal(t, float64(900), crds.AttributeValues["timeout"])
+		assert.Equal(t, float64(5), crds.AttributeValues["max_history"])
+	})
+}
+
+func TestESOScopedInstallationsPlan(t *testing.T) {
+	t.Parallel()
+
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", esoDeploymentTerraformDir)
+
+	t.Run("scoped", func(t *testing.T) {
+		plan := planESODeployment(t, terraformDir, map[string]interface{}{
+			"eso_scoped_installations": map[string]interface{}{
+				"tenant-a": map[string]interface{}{
+					"controller_class": "tenant-a",
+					"scoped_namespace": "tenant-a",
+				},
+			},
+		})
+
+		set := plannedHelmSet(t, plan, esoScopedReleaseAddress+`["tenant-a"]`)
+		assert.Equal(t, "tenant-a", set["controllerClass"])
+		assert.Equal(t, "tenant-a", set["scopedNamespace"])
+		assert.Equal(t, "true", fmt.Sprint(set["scopedRBAC"]))
+		assert.Equal(t, "false", fmt.Sprint(set["processClusterStore"]))
+		// the main installation doesn't get a controller class, the stores of the scoped namespace must set the one of the installation
+		assert.NotContains(t, plannedHelmSet(t, plan, esoReleaseAddress), "controllerClass")
+	})
+
+	// the custom values apply to the scoped installations as to the main installation
+	t.Run("custom-values", func(t *testing.T) {
+		plan := planESODeployment(t, terraformDir, map[string]interface{}{
+			"eso_custom_values": "resources:\n  limits:\n    memory: 256Mi\n",
+			"eso_scoped_installations": map[string]interface{}{
+				"tenant-a": map[string]interface{}{
+					"controller_class": "tenant-a",
+					"scoped_namespace": "tenant-a",
+				},
+			},
+		})
+
+		for _, address := range []string{esoReleaseAddress, esoScopedReleaseAddress + `["tenant-a"]`} {
+			assert.Contains(t, plannedHelmValues(t, plan, address), map[string]interface{}{
+				"resources": map[string]interface{}{"limits": map[string]interface{}{"memory": "256Mi"}},
+			}, "custom values of %s", address)
+		}
+	})
+
+	// an installation not scoped to a namespace would process the stores without controller class along with the main installation
+	t.Run("not-scoped", func(t *testing.T) {
+		_, err := terraform.InitAndPlanE(t, terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+			TerraformDir: terraformDir,
+			Vars: map[string]interface{}{
+				"eso_scoped_installations": map[string]interface{}{
+					"tenant-a": map[string]interface{}{
+						"controller_class": "tenant-a",
+					},
+				},
+			},
+			NoColor: true,
+		}))
+		require.Error(t, err)
+		assert.Contains(t, planErrorMessage(err), "The scoped_namespace of each installation of eso_scoped_installations must be set and unique.")
+	})
+
+	t.Run("same-namespace", func(t *testing.T) {
+		_, err := terraform.InitAndPlanE(t, terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+			TerraformDir: terraformDir,
+			Vars: map[string]interface{}{
+				"eso_scoped_installations": map[string]interface{}{
+					"tenant-a": map[string]interface{}{"controller_class": "tenant-a", "scoped_namespace": "tenants"},
+					"tenant-b": map[string]interface{}{"controller_class": "tenant-b", "scoped_namespace": "tenants"},
+				},
+			},
+			NoColor: true,
+		}))
+		require.Error(t, err)
+		assert.Contains(t, planErrorMessage(err), "The scoped_namespace of each installation of eso_scoped_installations must be set and unique.")
+	})
+}
@@ -0,0 +1,331 @@
+// Package exemptions derives from a terraform plan the resources whose planned updates can be ignored by the
+// consistency and upgrade checks: helm_release updates only touching image tags, chart versions, the formatting of the
+// values or known-noisy attributes. It also reports the entries of a static exemptions list which are no longer needed.
+package exemptions
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"gopkg.in/yaml.v3"
+)
+
+const helmReleaseType = "helm_release"
+
+// DefaultNoisyAttributes are the attributes, by resource type, whose updates are expected at each plan
+var DefaultNoisyAttributes = map[string][]string{
+	// computed by the helm provider from the release status after each apply
+	helmReleaseType: {"metadata"},
+	// the history field of the trusted profile is updated at each apply, https://github.com/IBM-Cloud/terraform-provider-ibm/issues/6050
+	"ibm_iam_trusted_profile": {"history"},
+}
+
+// imageTagKeys are the last segments of the helm values paths holding an image tag
+var imageTagKeys = map[string]bool{"tag": true, "digest": true, "imageTag": true}
+
+// Exemption is a resource whose planned update can be ignored
+type Exemption struct {
+	Address string
+	Reason  string
+}
+
+// Unclassified is a resource with a planned update which doesn't qualify as an exemption
+type Unclassified struct {
+	Address string
+	// Attributes are the updated attributes which can't be ignored
+	Attributes []string
+}
+
+// Result is the classification of the planned updates
+type Result struct {
+	Exemptions   []Exemption
+	Unclassified []Unclassified
+}
+
+// Addresses returns the addresses of the exemptions
+func (r Result) Addresses() []string {
+	addresses := make([]string, 0, len(r.Exemptions))
+	for _, exemption := range r.Exemptions {
+		addresses = append(addresses, exemption.Address)
+	}
+	return addresses
+}
+
+// Classifier classifies the planned updates
+type Classifier struct {
+	// NoisyAttributes are the attributes, by resource type, whose updates can always be ignored
+	NoisyAttributes map[string][]string
+}
+
+// NewClassifier returns a classifier ignoring the DefaultNoisyAttributes
+func NewClassifier() *Classifier {
+	return &Classifier{NoisyAttributes: DefaultNoisyAttributes}
+}
+
+// Classify returns the exemptions for the updates of the plan, in the order of the plan
+func (c *Classifier) Classify(plan *tfjson.Plan) Result {
+	var result Result
+	for _, change := range plan.ResourceChanges {
+		if change.Change == nil || !change.Change.Actions.Update() {
+			continue
+		}
+		reasons, unclassified := c.classifyChange(change)
+		if len(unclassified) > 0 {
+			result.Unclassified = append(result.Unclassified, Unclassified{Address: change.Address, Attributes: unclassified})
+			continue
+		}
+		result.Exemptions = append(result.Exemptions, Exemption{Address: change.Address, Reason: strings.Join(reasons, "; ")})
+	}
+	return result
+}
+
+// classifyChange returns the reasons to ignore the updated attributes and the attributes which can't be ignored
+func (c *Classifier) classifyChange(change *tfjson.ResourceChange) ([]string, []string) {
+	before, _ := change.Change.Before.(map[string]interface{})
+	after, _ := change.Change.After.(map[string]interface{})
+	afterUnknown, _ := change.Change.AfterUnknown.(map[string]interface{})
+
+	noisy := map[string]bool{}
+	for _, attribute := range c.NoisyAttributes[change.Type] {
+		noisy[attribute] = true
+	}
+
+	var reasons, unclassified []string
+	for _, attribute := range changedAttributes(before, after, afterUnknown) {
+		switch {
+		case noisy[attribute]:
+			reasons = append(reasons, fmt.Sprintf("known-noisy attribute %s", attribute))
+		case isUnknown(afterUnknown[attribute]):
+			// a value known only after apply can't be inspected
+			unclassified = append(unclassified, attribute)
+		case change.Type == helmReleaseType && attribute == "version":
+			reasons = append(reasons, fmt.Sprintf("chart version %v -> %v", before[attribute], after[attribute]))
+		case change.Type == helmReleaseType && attribute == "set":
+			if names, ok := imageTagSetUpdates(before[attribute], after[attribute]); ok {
+				reasons = append(reasons, fmt.Sprintf("image tag set %s", strings.Join(names, ", ")))
+			} else {
+				unclassified = append(unclassified, attribute)
+			}
+		case change.Type == helmReleaseType && attribute == "values" && sameValuesDocuments(before[attribute], after[attribute]):
+			// the values are rendered differently, for example by a module refactoring, without changing the release
+			reasons = append(reasons, "values reformatted, documents unchanged")
+		case change.Type == helmReleaseType && attribute == "values":
+			if paths, ok := imageTagValuesUpdates(before[attribute], after[attribute]); ok {
+				reasons = append(reasons, fmt.Sprintf("image tag values %s", strings.Join(paths, ", ")))
+			} else {
+				unclassified = append(unclassified, attribute)
+			}
+		default:
+			unclassified = append(unclassified, attribute)
+		}
+	}
+	return reasons, unclassified
+}
+
+// changedAttributes returns the sorted attributes whose value changes or becomes unknown
+func changedAttributes(before map[string]interface{}, after map[string]interface{}, afterUnknown map[string]interface{}) []string {
+	changed := map[string]bool{}
+	for attribute, value := range after {
+		if !reflect.DeepEqual(before[attribute], value) {
+			changed[attribute] = true
+		}
+	}
+	for attribute := range before {
+		if _, found := after[attribute]; !found {
+			changed[attribute] = true
+		}
+	}
+	for attribute, unknown := range afterUnknown {
+		if isUnknown(unknown) {
+			changed[attribute] = true
+		}
+	}
+	attributes := make([]string, 0, len(changed))
+	for attribute := range changed {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+	return attributes
+}
+
+// isUnknown returns true if the after_unknown value marks the attribute or any of its nested values as unknown
+func isUnknown(value interface{}) bool {
+	switch node := value.(type) {
+	case bool:
+		return node
+	case map[string]interface{}:
+		for _, element := range node {
+			if isUnknown(element) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, element := range node {
+			if isUnknown(element) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// imageTagSetUpdates returns the names of the updated helm set entries, true if they all are image tags
+func imageTagSetUpdates(before interface{}, after interface{}) ([]string, bool) {
+	beforeSet, beforeOK := setByName(before)
+	afterSet, afterOK := setByName(after)
+	if !beforeOK || !afterOK || len(beforeSet) != len(afterSet) {
+		return nil, false
+	}
+	var names []string
+	for name, value := range afterSet {
+		previous, found := beforeSet[name]
+		if !found {
+			return nil, false
+		}
+		if reflect.DeepEqual(previous, value) {
+			continue
+		}
+		segments := strings.Split(name, ".")
+		if !imageTagKeys[segments[len(segments)-1]] || !reflect.DeepEqual(previous["type"], value["type"]) {
+			return nil, false
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, len(names) > 0
+}
+
+// setByName returns the helm set entries by name
+func setByName(value interface{}) (map[string]map[string]interface{}, bool) {
+	entries, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	byName := map[string]map[string]interface{}{}
+	for _, entry := range entries {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, _ := fields["name"].(string)
+		byName[name] = fields
+	}
+	return byName, true
+}
+
+// imageTagValuesUpdates returns the paths updated in the helm values documents, true if they all are image tags
+func imageTagValuesUpdates(before interface{}, after interface{}) ([]string, bool) {
+	beforeValues, beforeOK := before.([]interface{})
+	afterValues, afterOK := after.([]interface{})
+	if !beforeOK || !afterOK || len(beforeValues) != len(afterValues) {
+		return nil, false
+	}
+	var paths []string
+	for index := range afterValues {
+		beforeDocument, beforeOK := decodeValues(beforeValues[index])
+		afterDocument, afterOK := decodeValues(afterValues[index])
+		if !beforeOK || !afterOK {
+			return nil, false
+		}
+		for _, path := range diffPaths(fmt.Sprintf("values[%d]", index), beforeDocument, afterDocument) {
+			segments := strings.Split(path, ".")
+			if !imageTagKeys[segments[len(segments)-1]] {
+				return nil, false
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, len(paths) > 0
+}
+
+// sameValuesDocuments returns true if the helm values decode to the same documents
+func sameValuesDocuments(before interface{}, after interface{}) bool {
+	beforeValues, beforeOK := before.([]interface{})
+	afterValues, afterOK := after.([]interface{})
+	if !beforeOK || !afterOK || len(beforeValues) != len(afterValues) {
+		return false
+	}
+	for index := range afterValues {
+		beforeDocument, beforeOK := decodeValues(beforeValues[index])
+		afterDocument, afterOK := decodeValues(afterValues[index])
+		if !beforeOK || !afterOK || !reflect.DeepEqual(beforeDocument, afterDocument) {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeValues(value interface{}) (interface{}, bool) {
+	content, ok := value.(string)
+	if !ok {
+		return nil, false
+	}
+	var document interface{}
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return nil, false
+	}
+	return document, true
+}
+
+// diffPaths returns the dot separated paths of the leaves which differ, a path of a different structure being returned as a whole
+func diffPaths(prefix string, before interface{}, after interface{}) []string {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		keys := map[string]bool{}
+		for key := range beforeMap {
+			keys[key] = true
+		}
+		for key := range afterMap {
+			keys[key] = true
+		}
+		var paths []string
+		for key := range keys {
+			paths = append(paths, diffPaths(prefix+"."+key, beforeMap[key], afterMap[key])...)
+		}
+		sort.Strings(paths)
+		return paths
+	}
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	return []string{prefix}
+}
+
+// Stale is an entry of a static exemptions list which is no longer needed
+type Stale struct {
+	Address string
+	Reason  string
+}
+
+// Report returns the entries of the static exemptions list which are no longer needed for the plan: not in the plan,
+// without a planned update or already covered by the classification result
+func Report(static []string, plan *tfjson.Plan, result Result) []Stale {
+	changes := map[string]*tfjson.ResourceChange{}
+	for _, change := range plan.ResourceChanges {
+		changes[change.Address] = change
+	}
+	exemptions := map[string]Exemption{}
+	for _, exemption := range result.Exemptions {
+		exemptions[exemption.Address] = exemption
+	}
+
+	var stale []Stale
+	for _, address := range static {
+		change, found := changes[address]
+		switch {
+		case !found:
+			stale = append(stale, Stale{Address: address, Reason: "not in the plan"})
+		case change.Change == nil || !change.Change.Actions.Update():
+			stale = append(stale, Stale{Address: address, Reason: "no update planned"})
+		default:
+			if exemption, covered := exemptions[address]; covered {
+				stale = append(stale, Stale{Address: address, Reason: "covered by the derived exemption: " + exemption.Reason})
+			}
+		}
+	}
+	return stale
+}
@@ -0,0 +1,158 @@
+// Tests in this file are run in the PR pipeline
+package exemptions
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plan with a resource change for each classification case, as returned by terraform show -json after the apply
+const consistencyPlanFile = "testdata/consistency-plan.json"
+
+func loadPlan(t *testing.T) *tfjson.Plan {
+	content, err := os.ReadFile(consistencyPlanFile)
+	require.NoError(t, err)
+	var plan tfjson.Plan
+	require.NoError(t, json.Unmarshal(content, &plan))
+	return &plan
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	result := NewClassifier().Classify(loadPlan(t))
+
+	assert.Equal(t, []Exemption{
+		{
+			Address: "module.external_secrets_operator.helm_release.external_secrets_operator",
+			Reason:  "known-noisy attribute metadata; image tag set image.tag; chart version 0.10.0 -> 0.10.1",
+		},
+		{
+			Address: "module.external_secrets_operator.helm_release.pod_reloader[0]",
+			Reason:  "known-noisy attribute metadata; image tag values values[0].image.tag",
+		},
+		{
+			Address: "module.external_secret_tp[1].helm_release.kubernetes_secret[0]",
+			Reason:  "known-noisy attribute metadata",
+		},
+		{
+			Address: "module.external_secrets_trusted_profiles[0].ibm_iam_trusted_profile.trusted_profile",
+			Reason:  "known-noisy attribute history",
+		},
+	}, result.Exemptions)
+
+	// the refresh interval of the ExternalSecret is a real change, the replace is not an update
+	assert.Equal(t, []Unclassified{
+		{Address: "module.external_secret_kv_singlekey.helm_release.kubernetes_secret_kv_key[0]", Attributes: []string{"values"}},
+	}, result.Unclassified)
+
+	assert.Equal(t, []string{
+		"module.external_secrets_operator.helm_release.external_secrets_operator",
+		"module.external_secrets_operator.helm_release.pod_reloader[0]",
+		"module.external_secret_tp[1].helm_release.kubernetes_secret[0]",
+		"module.external_secrets_trusted_profiles[0].ibm_iam_trusted_profile.trusted_profile",
+	}, result.Addresses())
+}
+
+func TestClassifyWithoutNoisyAttributes(t *testing.T) {
+	t.Parallel()
+
+	classifier := &Classifier{}
+	result := classifier.Classify(loadPlan(t))
+
+	assert.Empty(t, result.Exemptions)
+	assert.Len(t, result.Unclassified, 5)
+	assert.Contains(t, result.Unclassified, Unclassified{
+		Address:    "module.external_secrets_trusted_profiles[0].ibm_iam_trusted_profile.trusted_profile",
+		Attributes: []string{"history"},
+	})
+}
+
+func TestClassifyReformattedValues(t *testing.T) {
+	t.Parallel()
+
+	// the values of the release rendered from a heredoc and then with yamlencode
+	heredoc := "resources:\n  - apiVersion: external-secrets.io/v1\n    kind: ExternalSecret\n    metadata:\n      name: \"secret\"\n"
+	encoded := "\"resources\":\n- \"apiVersion\": \"external-secrets.io/v1\"\n  \"kind\": \"ExternalSecret\"\n  \"metadata\":\n    \"name\": \"secret\"\n"
+	renamed := "\"resources\":\n- \"apiVersion\": \"external-secrets.io/v1\"\n  \"kind\": \"ExternalSecret\"\n  \"metadata\":\n    \"name\": \"other-secret\"\n"
+	change := func(address string, after string) *tfjson.ResourceChange {
+		return &tfjson.ResourceChange{
+			Address: address,
+			Type:    "helm_release",
+			Change: &tfjson.Change{
+				Actions: tfjson.Actions{tfjson.ActionUpdate},
+				Before:  map[string]interface{}{"values": []interface{}{heredoc}},
+				After:   map[string]interface{}{"values": []interface{}{after}},
+			},
+		}
+	}
+
+	result := NewClassifier().Classify(&tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		change("helm_release.reformatted", encoded),
+		change("helm_release.renamed", renamed),
+	}})
+	assert.Equal(t, []Exemption{{Address: "helm_release.reformatted", Reason: "values reformatted, documents unchanged"}}, result.Exemptions)
+	assert.Equal(t, []Unclassified{{Address: "helm_release.renamed", Attributes: []string{"values"}}}, result.Unclassified)
+}
+
+func TestImageTagSetUpdates(t *testing.T) {
+	t.Parallel()
+
+	entry := func(name string, value string) interface{} {
+		return map[string]interface{}{"name": name, "type": "string", "value": value}
+	}
+
+	names, ok := imageTagSetUpdates(
+		[]interface{}{entry("image.tag", "v1"), entry("webhook.image.tag", "v1"), entry("image.repository", "repo")},
+		[]interface{}{entry("image.tag", "v2"), entry("webhook.image.tag", "v2"), entry("image.repository", "repo")},
+	)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"image.tag", "webhook.image.tag"}, names)
+
+	_, ok = imageTagSetUpdates(
+		[]interface{}{entry("image.tag", "v1"), entry("image.repository", "repo")},
+		[]interface{}{entry("image.tag", "v2"), entry("image.repository", "other-repo")},
+	)
+	assert.False(t, ok, "a repository update is not an image tag update")
+
+	_, ok = imageTagSetUpdates(
+		[]interface{}{entry("image.tag", "v1")},
+		[]interface{}{entry("image.tag", "v1"), entry("concurrent", "2")},
+	)
+	assert.False(t, ok, "an added set entry is not an image tag update")
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	plan := loadPlan(t)
+	static := []string{
+		// covered by the classification
+		"module.external_secrets_operator.helm_release.external_secrets_operator",
+		// still needed
+		"module.external_secret_kv_singlekey.helm_release.kubernetes_secret_kv_key[0]",
+		// no update
+		"module.eso_clusterstore.helm_release.cluster_secret_store_apikey[0]",
+		// replaced, not updated
+		"module.external_secret_usr_pass.helm_release.kubernetes_secret_user_pw[0]",
+		// renamed or removed from the example
+		"module.es_kubernetes_secret_usr_pass.helm_release.external_secrets_operator[0]",
+	}
+
+	stale := Report(static, plan, NewClassifier().Classify(plan))
+
+	assert.Equal(t, []Stale{
+		{
+			Address: "module.external_secrets_operator.helm_release.external_secrets_operator",
+			Reason:  "covered by the derived exemption: known-noisy attribute metadata; image tag set image.tag; chart version 0.10.0 -> 0.10.1",
+		},
+		{Address: "module.eso_clusterstore.helm_release.cluster_secret_store_apikey[0]", Reason: "no update planned"},
+		{Address: "module.external_secret_usr_pass.helm_release.kubernetes_secret_user_pw[0]", Reason: "no update planned"},
+		{Address: "module.es_kubernetes_secret_usr_pass.helm_release.external_secrets_operator[0]", Reason: "not in the plan"},
+	}, stale)
+}
@@ -0,0 +1,113 @@
+##################################################################
+# The same ExternalSecrets created by one helm release per namespace
+# or by one helm release per ExternalSecret, to compare them
+##################################################################
+
+locals {
+  namespaces = [for index in range(var.namespaces_count) : "${var.prefix}-${index}"]
+
+  # every combination of sm_secret_type and es_kubernetes_secret_type, in the first namespace
+  combinations = {
+    "arbitrary-opaque"                       = { sm_secret_type = "arbitrary", es_kubernetes_secret_type = "opaque", es_kubernetes_secret_data_key = "secret" }
+    "arbitrary-dockerconfigjson"             = { sm_secret_type = "arbitrary", es_kubernetes_secret_type = "dockerconfigjson", es_container_registry_email = "user@example.com" }
+    "iam-credentials-opaque"                 = { sm_secret_type = "iam_credentials", es_kubernetes_secret_type = "opaque", es_kubernetes_secret_data_key = "secret" }
+    "iam-credentials-dockerconfigjson"       = { sm_secret_type = "iam_credentials", es_kubernetes_secret_type = "dockerconfigjson" }
+    "iam-credentials-dockerconfigjson-chain" = { sm_secret_type = "iam_credentials", es_kubernetes_secret_type = "dockerconfigjson", sm_secret_id = null, es_container_registry_secrets_chain = local.secrets_chain }
+    "trusted-profile-opaque"                 = { sm_secret_type = "trusted_profile", es_kubernetes_secret_type = "opaque", es_kubernetes_secret_data_key = "secret" }
+    "trusted-profile-dockerconfigjson"       = { sm_secret_type = "trusted_profile", es_kubernetes_secret_type = "dockerconfigjson" }
+    "trusted-profile-dockerconfigjson-chain" = { sm_secret_type = "trusted_profile", es_kubernetes_secret_type = "dockerconfigjson", sm_secret_id = null, es_container_registry_secrets_chain = local.secrets_chain }
+    "username-password-opaque"               = { sm_secret_type = "username_password", es_kubernetes_secret_type = "opaque" }
+    "username-password-dockerconfigjson"     = { sm_secret_type = "username_password", es_kubernetes_secret_type = "dockerconfigjson" }
+    "service-credentials-opaque"             = { sm_secret_type = "service_credentials", es_kubernetes_secret_type = "opaque", es_kubernetes_secret_data_key = "secret" }
+    "service-credentials-opaque-mappings"    = { sm_secret_type = "service_credentials", es_kubernetes_secret_type = "opaque", sm_service_credentials_mappings = { apikey = ".credentials.apikey" } }
+    "service-credentials-dockerconfigjson"   = { sm_secret_type = "service_credentials", es_kubernetes_secret_type = "dockerconfigjson", es_kubernetes_secret_data_key = "secret" }
+    "imported-cert-tls"                      = { sm_secret_type = "imported_cert", es_kubernetes_secret_type = "tls" }
+    "imported-cert-tls-intermediate"         = { sm_secret_type = "imported_cert", es_kubernetes_secret_type = "tls", sm_certificate_bundle = false }
+    "imported-cert-opaque"                   = { sm_secret_type = "imported_cert", es_kubernetes_secret_type = "opaque" }
+    "public-cert-tls"                        = { sm_secret_type = "public_cert", es_kubernetes_secret_type = "tls" }
+    "public-cert-tls-intermediate"           = { sm_secret_type = "public_cert", es_kubernetes_secret_type = "tls", sm_certificate_bundle = false }
+    "public-cert-opaque"                     = { sm_secret_type = "public_cert", es_kubernetes_secret_type = "opaque" }
+    "private-cert-tls"                       = { sm_secret_type = "private_cert", es_kubernetes_secret_type = "tls" }
+    "private-cert-opaque"                    = { sm_secret_type = "private_cert", es_kubernetes_secret_type = "opaque" }
+    "kv-opaque"                              = { sm_secret_type = "kv", es_kubernetes_secret_type = "opaque" }
+    "kv-opaque-keyid"                        = { sm_secret_type = "kv", es_kubernetes_secret_type = "opaque", sm_kv_keyid = "key" }
+    "kv-opaque-keypath"                      = { sm_secret_type = "kv", es_kubernetes_secret_type = "opaque", sm_kv_keypath = "path.key" }
+  }
+  secrets_chain = [
+    { es_container_registry = "us.icr.io", sm_secret_id = "00000000-0000-0000-0000-000000000001", trusted_profile = "Profile-00000000-0000-0000-0000-000000000001" },
+    { es_container_registry = "de.icr.io", sm_secret_id = "00000000-0000-0000-0000-000000000002", es_container_registry_email = "user@example.com" },
+  ]
+
+  # the ExternalSecrets of the combinations with all the attributes set, the ones not set by a combination to the module defaults
+  combination_external_secrets = {
+    for key, combination in local.combinations : key => {
+      es_kubernetes_namespace             = local.namespaces[0]
+      es_kubernetes_secret_type           = combination.es_kubernetes_secret_type
+      es_kubernetes_secret_data_key       = lookup(combination, "es_kubernetes_secret_data_key", null)
+      sm_secret_type                      = combination.sm_secret_type
+      sm_secret_id                        = lookup(combination, "sm_secret_id", "00000000-0000-0000-0000-000000000000")
+      sm_kv_keyid                         = lookup(combination, "sm_kv_keyid", null)
+      sm_kv_keypath                       = lookup(combination, "sm_kv_keypath", null)
+      sm_certificate_bundle               = lookup(combination, "sm_certificate_bundle", true)
+      sm_service_credentials_mappings     = lookup(combination, "sm_service_credentials_mappings", {})
+      es_container_registry_email         = lookup(combination, "es_container_registry_email", null)
+      es_container_registry_secrets_chain = lookup(combination, "es_container_registry_secrets_chain", [])
+    } if var.all_combinations
+  }
+  arbitrary_external_secrets = {
+    for index in range(var.external_secrets_count) : format("es-%04d", index) => {
+      es_kubernetes_namespace       = local.namespaces[index % var.namespaces_count]
+      es_kubernetes_secret_type     = "opaque"
+      es_kubernetes_secret_data_key = "secret"
+      sm_secret_type                = "arbitrary"
+      # the ExternalSecrets are not synced by the benchmark, the secret doesn't need to exist
+      sm_secret_id                        = format("00000000-0000-0000-0000-%012d", index)
+      sm_kv_keyid                         = null
+      sm_kv_keypath                       = null
+      sm_certificate_bundle               = true
+      sm_service_credentials_mappings     = {}
+      es_container_registry_email         = null
+      es_container_registry_secrets_chain = []
+    } if !var.all_combinations
+  }
+  external_secrets = merge(local.combination_external_secrets, local.arbitrary_external_secrets)
+}
+
+resource "kubernetes_namespace_v1" "namespaces" {
+  for_each = toset(local.namespaces)
+  metadata {
+    name = each.key
+  }
+}
+
+module "external_secrets_batch" {
+  count               = var.batched ? 1 : 0
+  source              = "../../modules/eso-external-secrets-batch"
+  eso_store_name      = var.eso_store_name
+  external_secrets    = local.external_secrets
+  render_only         = var.render_only
+  helm_keep_resources = var.helm_keep_resources
+  depends_on          = [kubernetes_namespace_v1.namespaces]
+}
+
+module "external_secret" {
+  for_each                            = var.batched ? {} : local.external_secrets
+  source                              = "../../modules/eso-external-secret"
+  eso_store_name                      = var.eso_store_name
+  es_kubernetes_namespace             = each.value.es_kubernetes_namespace
+  es_kubernetes_secret_name           = each.key
+  es_kubernetes_secret_type           = each.value.es_kubernetes_secret_type
+  es_kubernetes_secret_data_key       = each.value.es_kubernetes_secret_data_key
+  sm_secret_type                      = each.value.sm_secret_type
+  sm_secret_id                        = each.value.sm_secret_id
+  sm_kv_keyid                         = each.value.sm_kv_keyid
+  sm_kv_keypath                       = each.value.sm_kv_keypath
+  sm_certificate_bundle               = each.value.sm_certificate_bundle
+  sm_service_credentials_mappings     = each.value.sm_service_credentials_mappings
+  es_container_registry_email         = each.value.es_container_registry_email
+  es_container_registry_secrets_chain = each.value.es_container_registry_secrets_chain
+  es_helm_rls_name                    = each.key
+  render_only                         = var.render_only
+  helm_keep_resources                 = var.helm_keep_resources
+  depends_on                          = [kubernetes_namespace_v1.namespaces]
+}
@@ -0,0 +1,15 @@
+##############################################################################
+# Outputs
+##############################################################################
+
+output "helm_releases_count" {
+  description = "Number of helm releases creating the ExternalSecrets"
+  value       = var.render_only ? 0 : var.batched ? length(module.external_secrets_batch[0].helm_releases) : length(local.external_secrets)
+}
+
+output "manifests" {
+  description = "Manifests of the ExternalSecrets of each namespace, in the order of their keys"
+  value = var.batched ? module.external_secrets_batch[0].manifests : {
+    for namespace in distinct([for es in local.external_secrets : es.es_kubernetes_namespace]) : namespace => join("", [for key in sort(keys(module.external_secret)) : module.external_secret[key].manifests if local.external_secrets[key].es_kubernetes_namespace == namespace])
+  }
+}
@@ -0,0 +1,14 @@
+# the plan doesn't reach the cluster: kubeconfig_path is only needed to apply
+provider "kubernetes" {
+  config_path = var.kubeconfig_path
+  host        = var.kubeconfig_path == null ? var.cluster_host : null
+  insecure    = var.kubeconfig_path == null ? true : null
+}
+
+provider "helm" {
+  kubernetes = {
+    config_path = var.kubeconfig_path
+    host        = var.kubeconfig_path == null ? var.cluster_host : null
+    insecure    = var.kubeconfig_path == null ? true : null
+  }
+}
@@ -0,0 +1,67 @@
+#######################################################################
+# Generic
+#######################################################################
+
+variable "cluster_host" {
+  type        = string
+  description = "Address of the Kubernetes API server configured in the providers when kubeconfig_path is not set, not reached by the plan."
+  default     = "https://127.0.0.1:6443"
+}
+
+variable "kubeconfig_path" {
+  type        = string
+  description = "Path of the kubeconfig file of the cluster to apply the ExternalSecrets to, with the ESO CRDs installed. If null only the plan can be run."
+  default     = null
+}
+
+#######################################################################
+# ExternalSecrets
+#######################################################################
+
+variable "batched" {
+  type        = bool
+  description = "Whether the ExternalSecrets are created by the eso-external-secrets-batch module, one helm release per namespace, or by one eso-external-secret module per ExternalSecret."
+  default     = true
+}
+
+variable "render_only" {
+  type        = bool
+  description = "Whether the ExternalSecrets manifests are only rendered in the manifests output instead of being installed with helm releases."
+  default     = false
+}
+
+variable "helm_keep_resources" {
+  type        = bool
+  description = "Whether the ExternalSecrets of the helm releases are annotated to be kept by helm when the releases are uninstalled."
+  default     = false
+}
+
+variable "external_secrets_count" {
+  type        = number
+  description = "Number of ExternalSecrets to create."
+  default     = 100
+}
+
+variable "namespaces_count" {
+  type        = number
+  description = "Number of namespaces the ExternalSecrets are spread over."
+  default     = 5
+}
+
+variable "prefix" {
+  type        = string
+  description = "Prefix of the namespaces."
+  default     = "es-batch"
+}
+
+variable "eso_store_name" {
+  type        = string
+  description = "Name of the ClusterSecretStore referenced by the ExternalSecrets."
+  default     = "cluster-store"
+}
+
+variable "all_combinations" {
+  type        = bool
+  description = "Whether every combination of sm_secret_type and es_kubernetes_secret_type is created in the first namespace, instead of external_secrets_count arbitrary opaque ExternalSecrets."
+  default     = false
+}
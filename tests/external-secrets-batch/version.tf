@@ -0,0 +1,13 @@
+terraform {
+  required_version = ">= 1.9.0"
+  required_providers {
+    kubernetes = {
+      source  = "hashicorp/kubernetes"
+      version = ">= 3.0.1, < 4.0.0"
+    }
+    helm = {
+      source  = "hashicorp/helm"
+      version = ">= 3.0.0, <4.0.0"
+    }
+  }
+}
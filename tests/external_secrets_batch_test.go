@@ -0,0 +1,269 @@
+// Tests in this file are run in the PR pipeline
+package test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const externalSecretsBatchTerraformDir = "tests/external-secrets-batch"
+
+// numbers of ExternalSecrets of the benchmarks, spread over the 5 namespaces of the fixture
+var benchmarkExternalSecretsCounts = []int{20, 100, 500}
+
+// externalSecretsBatchOptions returns the options of the batch fixture creating count ExternalSecrets, batched or with
+// one helm release per ExternalSecret
+func externalSecretsBatchOptions(t testing.TB, terraformDir string, batched bool, count int, kubeconfigPath string) *terraform.Options {
+	terraformVars := map[string]interface{}{
+		"batched":                batched,
+		"external_secrets_count": count,
+	}
+	if kubeconfigPath != "" {
+		terraformVars["kubeconfig_path"] = kubeconfigPath
+	}
+	return terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: terraformDir,
+		Vars:         terraformVars,
+		NoColor:      true,
+	})
+}
+
+// plannedHelmReleases returns the number of helm releases in the plan
+func plannedHelmReleases(plan *terraform.PlanStruct) int {
+	releases := 0
+	for _, resource := range plan.ResourcePlannedValuesMap {
+		if resource.Type == "helm_release" {
+			releases++
+		}
+	}
+	return releases
+}
+
+// approachName returns the name of the sub benchmarks of each approach
+func approachName(batched bool) string {
+	if batched {
+		return "batched"
+	}
+	return "per-secret"
+}
+
+func TestExternalSecretsBatchPlan(t *testing.T) {
+	t.Parallel()
+
+	// the fixture references the modules through a relative path so the whole repo is copied
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", externalSecretsBatchTerraformDir)
+
+	batchedPlan, err := terraform.InitAndPlanAndShowWithStructE(t, externalSecretsBatchOptions(t, terraformDir, true, 12, ""))
+	require.NoError(t, err)
+	perSecretPlan, err := terraform.InitAndPlanAndShowWithStructE(t, externalSecretsBatchOptions(t, terraformDir, false, 12, ""))
+	require.NoError(t, err)
+
+	// one release per namespace with the ExternalSecrets of the namespace, rendered as the eso-external-secret module does
+	for namespaceIndex := range 5 {
+		namespace := fmt.Sprintf("es-batch-%d", namespaceIndex)
+		address := fmt.Sprintf("module.external_secrets_batch[0].helm_release.external_secrets[%q]", namespace)
+		documents := plannedHelmValues(t, batchedPlan, address)
+		require.Len(t, documents, 1)
+		resources, ok := documents[0]["resources"].([]interface{})
+		require.True(t, ok, "resources of the helm release %s not found", address)
+
+		expected := []interface{}{}
+		for index := namespaceIndex; index < 12; index += 5 {
+			perSecretAddress := fmt.Sprintf("module.external_secret[%q].helm_release.kubernetes_secret[0]", fmt.Sprintf("es-%04d", index))
+			perSecretDocuments := plannedHelmValues(t, perSecretPlan, perSecretAddress)
+			require.Len(t, perSecretDocuments, 1)
+			expected = append(expected, perSecretDocuments[0]["resources"].([]interface{})...)
+		}
+		assert.Equal(t, expected, resources, "ExternalSecrets of the namespace %s", namespace)
+	}
+
+	// one release per namespace when batched, one per ExternalSecret otherwise
+	assert.Equal(t, 5, plannedHelmReleases(batchedPlan))
+	assert.Equal(t, 12, plannedHelmReleases(perSecretPlan))
+}
+
+// plannedManifests returns the YAML documents of the manifests output of the fixture, by namespace
+func plannedManifests(t *testing.T, plan *terraform.PlanStruct) map[string][]interface{} {
+	change, ok := plan.RawPlan.OutputChanges["manifests"]
+	require.True(t, ok, "manifests output not found in the plan")
+	manifests, ok := change.After.(map[string]interface{})
+	require.True(t, ok, "manifests output is not a map")
+
+	documents := map[string][]interface{}{}
+	for namespace, manifest := range manifests {
+		decoder := yaml.NewDecoder(strings.NewReader(manifest.(string)))
+		for {
+			var document interface{}
+			err := decoder.Decode(&document)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err, "manifests of the namespace %s", namespace)
+			documents[namespace] = append(documents[namespace], document)
+		}
+	}
+	return documents
+}
+
+func TestExternalSecretsRenderOnlyPlan(t *testing.T) {
+	t.Parallel()
+
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", externalSecretsBatchTerraformDir)
+
+	plans := map[bool]*terraform.PlanStruct{}
+	for _, batched := range []bool{true, false} {
+		options := externalSecretsBatchOptions(t, terraformDir, batched, 12, "")
+		options.Vars["render_only"] = true
+		plan, err := terraform.InitAndPlanAndShowWithStructE(t, options)
+		require.NoError(t, err)
+		// the ExternalSecrets are rendered only, without any helm release
+		assert.Equal(t, 0, plannedHelmReleases(plan), "helm releases of the %s plan", approachName(batched))
+		plans[batched] = plan
+	}
+
+	// the manifests of each namespace are the same whether the ExternalSecrets are batched or not
+	batched := plannedManifests(t, plans[true])
+	perSecret := plannedManifests(t, plans[false])
+	require.Len(t, batched, 5)
+	for namespace, documents := range batched {
+		assert.Equal(t, perSecret[namespace], documents, "manifests of the namespace %s", namespace)
+	}
+}
+
+func TestExternalSecretsCombinationsPlan(t *testing.T) {
+	t.Parallel()
+
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", externalSecretsBatchTerraformDir)
+
+	manifests := map[bool]map[string][]interface{}{}
+	for _, batched := range []bool{true, false} {
+		options := externalSecretsBatchOptions(t, terraformDir, batched, 0, "")
+		options.Vars["render_only"] = true
+		options.Vars["all_combinations"] = true
+		plan, err := terraform.InitAndPlanAndShowWithStructE(t, options)
+		require.NoError(t, err)
+		manifests[batched] = plannedManifests(t, plan)
+	}
+
+	// every combination of secret types is rendered the same whether the ExternalSecrets are batched or not
+	documents := manifests[true]["es-batch-0"]
+	require.Len(t, manifests[true], 1)
+	require.Len(t, documents, 24)
+	assert.Equal(t, manifests[false], manifests[true])
+
+	data := map[string]map[string]interface{}{}
+	for _, document := range documents {
+		externalSecret := document.(map[string]interface{})
+		name := externalSecret["metadata"].(map[string]interface{})["name"].(string)
+		template := externalSecret["spec"].(map[string]interface{})["target"].(map[string]interface{})["template"].(map[string]interface{})
+		data[name] = template["data"].(map[string]interface{})
+		// the secrets are generated without an empty key or value
+		require.NotEmpty(t, data[name], "template data of %s", name)
+		for key, value := range data[name] {
+			assert.NotEmpty(t, key, "template data key of %s", name)
+			assert.NotEmpty(t, value, "template data %q of %s", key, name)
+		}
+	}
+	assert.Equal(t, map[string]interface{}{"secret": "{{ .secretid }}"}, data["trusted-profile-opaque"])
+	assert.Equal(t, map[string]interface{}{"username": "{{ .username }}", "password": "{{ .password }}"}, data["username-password-opaque"])
+	assert.Equal(t, "{{ .certificate }}\n{{ .intermediate }}", data["public-cert-tls-intermediate"]["tls.crt"])
+	assert.Equal(t, map[string]interface{}{"apikey": "{{ .credentials.apikey }}"}, data["service-credentials-opaque-mappings"])
+}
+
+func TestExternalSecretsHelmKeepResourcesPlan(t *testing.T) {
+	t.Parallel()
+
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", externalSecretsBatchTerraformDir)
+
+	addresses := map[bool]string{
+		true:  `module.external_secrets_batch[0].helm_release.external_secrets["es-batch-0"]`,
+		false: `module.external_secret["es-0000"].helm_release.kubernetes_secret[0]`,
+	}
+	for batched, address := range addresses {
+		options := externalSecretsBatchOptions(t, terraformDir, batched, 5, "")
+		options.Vars["helm_keep_resources"] = true
+		plan, err := terraform.InitAndPlanAndShowWithStructE(t, options)
+		require.NoError(t, err)
+
+		// the ExternalSecrets of the helm releases are annotated to be kept by helm when the release is uninstalled
+		documents := plannedHelmValues(t, plan, address)
+		require.Len(t, documents, 1)
+		resources, ok := documents[0]["resources"].([]interface{})
+		require.True(t, ok, "resources of the helm release %s not found", address)
+		require.NotEmpty(t, resources)
+		for _, resource := range resources {
+			metadata := resource.(map[string]interface{})["metadata"].(map[string]interface{})
+			assert.Equal(t, map[string]interface{}{"helm.sh/resource-policy": "keep"}, metadata["annotations"], "annotations of %s in %s", metadata["name"], address)
+		}
+	}
+}
+
+// BenchmarkExternalSecretsPlan compares the time to plan the ExternalSecrets created with one helm release per
+// namespace and with one helm release per ExternalSecret. The plan doesn't reach the cluster.
+func BenchmarkExternalSecretsPlan(b *testing.B) {
+	terraformDir := test_structure.CopyTerraformFolderToTemp(b, "..", externalSecretsBatchTerraformDir)
+	terraform.Init(b, &terraform.Options{TerraformDir: terraformDir, NoColor: true, Logger: logger.Discard})
+
+	for _, count := range benchmarkExternalSecretsCounts {
+		for _, batched := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/%d", approachName(batched), count), func(b *testing.B) {
+				options := externalSecretsBatchOptions(b, terraformDir, batched, count, "")
+				// the output of hundreds of resources would slow down the benchmark
+				options.Logger = logger.Discard
+				for b.Loop() {
+					terraform.Plan(b, options)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkExternalSecretsApply compares the time to apply the ExternalSecrets created with one helm release per
+// namespace and with one helm release per ExternalSecret, destroying them after each apply. It runs against the
+// cluster of the kubeconfig set in the BENCHMARK_KUBECONFIG environment variable, with the ESO CRDs installed, and is
+// skipped if not set. The number of ExternalSecrets can be set with the BENCHMARK_EXTERNAL_SECRETS environment variable.
+func BenchmarkExternalSecretsApply(b *testing.B) {
+	kubeconfigPath := os.Getenv("BENCHMARK_KUBECONFIG")
+	if kubeconfigPath == "" {
+		b.Skip("BENCHMARK_KUBECONFIG not set")
+	}
+	counts := benchmarkExternalSecretsCounts
+	if value := os.Getenv("BENCHMARK_EXTERNAL_SECRETS"); value != "" {
+		count, err := strconv.Atoi(value)
+		require.NoError(b, err, "BENCHMARK_EXTERNAL_SECRETS must be a number")
+		counts = []int{count}
+	}
+
+	terraformDir := test_structure.CopyTerraformFolderToTemp(b, "..", externalSecretsBatchTerraformDir)
+	terraform.Init(b, &terraform.Options{TerraformDir: terraformDir, NoColor: true, Logger: logger.Discard})
+
+	for _, count := range counts {
+		for _, batched := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/%d", approachName(batched), count), func(b *testing.B) {
+				options := externalSecretsBatchOptions(b, terraformDir, batched, count, kubeconfigPath)
+				options.Logger = logger.Discard
+				releases := 0
+				for b.Loop() {
+					terraform.Apply(b, options)
+					b.StopTimer()
+					releases, _ = strconv.Atoi(terraform.Output(b, options, "helm_releases_count"))
+					terraform.Destroy(b, options)
+					b.StartTimer()
+				}
+				b.ReportMetric(float64(releases), "releases")
+			})
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package loadtest runs a model of the ESO controller, not ESO, syncing a large number of ExternalSecrets against the
+// rate limits of Secrets Manager: the ExternalSecrets generated in the format of eso-external-secret are created on a
+// local API server and synced from the Secrets Manager stand-in, with its latency and rate limit, by ModelController
+// reconciling them with concurrent_reconciles workers. Each run reports the time taken by the model to sync all the
+// ExternalSecrets, the number of Secrets Manager API calls and the error rate of the reconciles. The reports only
+// estimate the API calls of the reconciles: they don't measure ESO, which must be load tested on a cluster.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/smstandin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// ExternalSecretResource is the resource of the ExternalSecrets created by eso-external-secret
+var ExternalSecretResource = schema.GroupVersionResource{Group: "external-secrets.io", Version: "v1", Resource: "externalsecrets"}
+
+// SecretResource is the resource of the secrets generated by the ExternalSecrets
+var SecretResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+const defaultTimeout = 2 * time.Minute
+
+// Config is a load test run
+type Config struct {
+	// ExternalSecrets is the number of ExternalSecrets generated, each one syncing its own Secrets Manager secret
+	ExternalSecrets int
+	// Namespaces is the number of namespaces the ExternalSecrets are spread over, 1 if not set
+	Namespaces int
+	// ConcurrentReconciles is the number of ExternalSecrets reconciled at the same time, as concurrent_reconciles
+	ConcurrentReconciles int
+	// RefreshInterval is the refresh interval of the ExternalSecrets, as es_refresh_interval. The intervals of a
+	// real deployment (1h by default) can be scaled down together with Duration to measure the load of the refreshes
+	RefreshInterval time.Duration
+	// Duration is the time the load is measured for, from the start of the controller. The run lasts until all the
+	// ExternalSecrets are synced if longer
+	Duration time.Duration
+	// Limits are the latency and the rate limit of the Secrets Manager stand-in
+	Limits smstandin.Limits
+	// RateLimiter is the backoff of the failed reconciles, the one of ESO if not set
+	RateLimiter workqueue.TypedRateLimiter[string]
+	// Timeout is the maximum time to wait for all the ExternalSecrets to be synced, 2 minutes if not set
+	Timeout time.Duration
+}
+
+func (c Config) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return defaultTimeout
+}
+
+// Report is the result of a load test run
+type Report struct {
+	Config Config
+	// TimeToAllSynced is the time taken to sync all the ExternalSecrets once, from the start of the controller
+	TimeToAllSynced time.Duration
+	// Elapsed is the duration of the run the counters refer to
+	Elapsed time.Duration
+	// APICalls is the number of Secrets Manager API calls, including the ones rejected by the rate limit
+	APICalls int
+	Counters
+}
+
+// ErrorRate returns the ratio of the failed reconciles
+func (r Report) ErrorRate() float64 {
+	if r.Reconciles == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Reconciles)
+}
+
+// APICallsPerSecond returns the average rate of the Secrets Manager API calls during the run
+func (r Report) APICallsPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.APICalls) / r.Elapsed.Seconds()
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%d ExternalSecrets, concurrent_reconciles %d, refresh interval %s: %d/%d synced in %s, %d API calls (%.1f/s, %d throttled), error rate %.1f%%",
+		r.Config.ExternalSecrets, r.Config.ConcurrentReconciles, r.Config.RefreshInterval, r.Synced, r.Config.ExternalSecrets,
+		r.TimeToAllSynced.Round(time.Millisecond), r.APICalls, r.APICallsPerSecond(), r.Throttled, 100*r.ErrorRate())
+}
+
+// FormatReports returns the reports as a table, one run per line
+func FormatReports(reports []Report) string {
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "EXTERNALSECRETS\tCONCURRENT_RECONCILES\tREFRESH\tTIME_TO_ALL_SYNCED\tAPI_CALLS\tAPI_CALLS/S\tTHROTTLED\tERROR_RATE")
+	for _, r := range reports {
+		fmt.Fprintf(writer, "%d\t%d\t%s\t%s\t%d\t%.1f\t%d\t%.1f%%\n", r.Config.ExternalSecrets, r.Config.ConcurrentReconciles, r.Config.RefreshInterval,
+			r.TimeToAllSynced.Round(time.Millisecond), r.APICalls, r.APICallsPerSecond(), r.Throttled, 100*r.ErrorRate())
+	}
+	_ = writer.Flush()
+	return builder.String()
+}
+
+// ExternalSecret returns the ExternalSecret created by eso-external-secret for an arbitrary secret synced to an opaque
+// secret of the same name
+func ExternalSecret(namespace string, name string, secretID string, refreshInterval time.Duration) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "external-secrets.io/v1",
+		"kind":       "ExternalSecret",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+		"spec": map[string]interface{}{
+			"refreshInterval": refreshInterval.String(),
+			"secretStoreRef": map[string]interface{}{
+				"name": "cluster-store",
+				"kind": "ClusterSecretStore",
+			},
+			"target": map[string]interface{}{
+				"name": name,
+				"template": map[string]interface{}{
+					"engineVersion": "v2",
+					"type":          "Opaque",
+					"data": map[string]interface{}{
+						"secret": "{{ .secretid }}",
+					},
+				},
+			},
+			"data": []interface{}{
+				map[string]interface{}{
+					"secretKey": "secretid",
+					"remoteRef": map[string]interface{}{
+						"key": secretID,
+					},
+				},
+			},
+		},
+	}}
+}
+
+// NewDynamicClient returns the client of a local API server serving the ExternalSecrets and the secrets
+func NewDynamicClient() *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ExternalSecretResource: "ExternalSecretList",
+		SecretResource:         "SecretList",
+	})
+}
+
+// Run generates the ExternalSecrets and their Secrets Manager secrets and syncs them with the ESO model,
+// returning the report of the run, partial with an error if the ExternalSecrets are not all synced within the timeout
+func Run(ctx context.Context, t testing.TB, config Config) (Report, error) {
+	report := Report{Config: config}
+	if config.ExternalSecrets <= 0 {
+		return report, fmt.Errorf("the number of ExternalSecrets must be positive, got %d", config.ExternalSecrets)
+	}
+	if config.RefreshInterval <= 0 {
+		return report, fmt.Errorf("the refresh interval must be positive, got %s", config.RefreshInterval)
+	}
+
+	server := smstandin.NewServer(t)
+	dynamicClient := NewDynamicClient()
+	namespaces := max(config.Namespaces, 1)
+	for i := range config.ExternalSecrets {
+		id := fmt.Sprintf("load-secret-%05d", i)
+		server.SetSecret(smstandin.Secret{ID: id, SecretType: "arbitrary", Payload: "value-" + id})
+		object := ExternalSecret(fmt.Sprintf("load-ns-%d", i%namespaces), fmt.Sprintf("load-es-%05d", i), id, config.RefreshInterval)
+		if _, err := dynamicClient.Resource(ExternalSecretResource).Namespace(object.GetNamespace()).Create(ctx, object, metav1.CreateOptions{}); err != nil {
+			return report, fmt.Errorf("creating the ExternalSecret %s: %w", object.GetName(), err)
+		}
+	}
+	// the limits apply only to the calls of the controller
+	server.SetLimits(config.Limits)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	controller := &ModelController{Dynamic: dynamicClient, Source: server.Client(), Workers: config.ConcurrentReconciles, RateLimiter: config.RateLimiter}
+	start := time.Now()
+	if err := controller.Start(runCtx); err != nil {
+		return report, err
+	}
+
+	collect := func() {
+		report.Elapsed = time.Since(start)
+		report.Counters = controller.Counters()
+		report.APICalls = server.Requests()
+	}
+	err := wait.PollUntilContextTimeout(runCtx, 10*time.Millisecond, config.timeout(), true, func(context.Context) (bool, error) {
+		return controller.Counters().Synced == config.ExternalSecrets, nil
+	})
+	if err != nil {
+		collect()
+		return report, fmt.Errorf("%d of %d ExternalSecrets synced after %s: %w", report.Synced, config.ExternalSecrets, report.Elapsed.Round(time.Millisecond), err)
+	}
+	report.TimeToAllSynced = time.Since(start)
+
+	if remaining := config.Duration - time.Since(start); remaining > 0 {
+		select {
+		case <-time.After(remaining):
+		case <-ctx.Done():
+		}
+	}
+	collect()
+	return report, ctx.Err()
+}
+
+// RunMatrix runs the load test for each combination of concurrent reconciles and refresh interval, with the other
+// settings of config, stopping at the first failed run
+func RunMatrix(ctx context.Context, t testing.TB, config Config, concurrentReconciles []int, refreshIntervals []time.Duration) ([]Report, error) {
+	reports := []Report{}
+	for _, workers := range concurrentReconciles {
+		for _, refreshInterval := range refreshIntervals {
+			run := config
+			run.ConcurrentReconciles = workers
+			run.RefreshInterval = refreshInterval
+			report, err := Run(ctx, t, run)
+			reports = append(reports, report)
+			if err != nil {
+				return reports, fmt.Errorf("concurrent_reconciles %d, refresh interval %s: %w", workers, refreshInterval, err)
+			}
+		}
+	}
+	return reports, nil
+}
@@ -0,0 +1,158 @@
+// Tests in this file are run in the PR pipeline
+package loadtest
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/smstandin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// newController returns an ESO model syncing the ExternalSecrets from the server, on a local API server
+func newController(t *testing.T, server *smstandin.Server, externalSecrets ...*unstructured.Unstructured) *ModelController {
+	dynamicClient := NewDynamicClient()
+	for _, object := range externalSecrets {
+		_, err := dynamicClient.Resource(ExternalSecretResource).Namespace(object.GetNamespace()).Create(context.Background(), object, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	return &ModelController{Dynamic: dynamicClient, Source: server.Client()}
+}
+
+// skipTimingTest skips the tests whose assertions depend on the scheduling of the goroutines and on the timers, such
+// as the number of throttled calls or of refreshes, unless the LOADTEST_TIMING environment variable is set, as they
+// are flaky on loaded CI runners
+func skipTimingTest(t *testing.T) {
+	if os.Getenv("LOADTEST_TIMING") == "" {
+		t.Skip("LOADTEST_TIMING not set")
+	}
+}
+
+func TestLoadTestRun(t *testing.T) {
+	t.Parallel()
+
+	report, err := Run(context.Background(), t, Config{
+		ExternalSecrets:      300,
+		Namespaces:           3,
+		ConcurrentReconciles: 4,
+		RefreshInterval:      time.Hour,
+		Limits:               smstandin.Limits{Latency: time.Millisecond},
+		Timeout:              30 * time.Second,
+	})
+	require.NoError(t, err)
+	t.Log(report)
+
+	// each ExternalSecret is synced once with a single call, the refresh interval being longer than the run
+	assert.Equal(t, 300, report.Synced)
+	assert.Equal(t, 300, report.Reconciles)
+	assert.Equal(t, 300, report.APICalls)
+	assert.Zero(t, report.Errors)
+	assert.Zero(t, report.ErrorRate())
+	assert.Positive(t, report.TimeToAllSynced)
+}
+
+func TestLoadTestThrottling(t *testing.T) {
+	skipTimingTest(t)
+	t.Parallel()
+
+	report, err := Run(context.Background(), t, Config{
+		ExternalSecrets:      200,
+		ConcurrentReconciles: 8,
+		RefreshInterval:      time.Hour,
+		Limits:               smstandin.Limits{RateLimit: 500, Burst: 20},
+		// backoff of the failed reconciles without the overall rate limit of ESO, to keep the test short
+		RateLimiter: workqueue.NewTypedItemExponentialFailureRateLimiter[string](5*time.Millisecond, time.Second),
+		Timeout:     30 * time.Second,
+	})
+	require.NoError(t, err)
+	t.Log(report)
+
+	// the throttled reconciles are retried until all the ExternalSecrets are synced
+	assert.Equal(t, 200, report.Synced)
+	assert.Positive(t, report.Throttled)
+	assert.Equal(t, report.Throttled, report.Errors)
+	assert.Equal(t, 200+report.Throttled, report.APICalls)
+	assert.Equal(t, report.Reconciles, report.APICalls)
+	assert.InDelta(t, float64(report.Throttled)/float64(report.Reconciles), report.ErrorRate(), 1e-9)
+}
+
+func TestLoadTestRefresh(t *testing.T) {
+	skipTimingTest(t)
+	t.Parallel()
+
+	report, err := Run(context.Background(), t, Config{
+		ExternalSecrets:      50,
+		ConcurrentReconciles: 2,
+		RefreshInterval:      100 * time.Millisecond,
+		Duration:             time.Second,
+		Timeout:              10 * time.Second,
+	})
+	require.NoError(t, err)
+	t.Log(report)
+
+	// the ExternalSecrets are refreshed about every 100ms during the second of the run
+	assert.Equal(t, 50, report.Synced)
+	assert.Greater(t, report.APICalls, 5*50)
+	assert.LessOrEqual(t, report.APICalls, 11*50)
+	assert.GreaterOrEqual(t, report.Elapsed, time.Second)
+}
+
+func TestLoadTestGeneratedSecrets(t *testing.T) {
+	t.Parallel()
+
+	server := smstandin.NewServer(t)
+	server.SetSecret(smstandin.Secret{ID: "load-secret", SecretType: "arbitrary", Payload: "load-value"})
+	controller := newController(t, server, ExternalSecret("load-ns", "load-es", "load-secret", time.Hour))
+	require.NoError(t, controller.Start(t.Context()))
+
+	require.Eventually(t, func() bool { return controller.Counters().Synced == 1 }, 5*time.Second, 10*time.Millisecond)
+	secret, err := controller.Dynamic.Resource(SecretResource).Namespace("load-ns").Get(context.Background(), "load-es", metav1.GetOptions{})
+	require.NoError(t, err)
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "data")
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("load-value")), data["secretid"])
+}
+
+func TestLoadTestTimeout(t *testing.T) {
+	t.Parallel()
+
+	// one call per second can't sync the ExternalSecrets before the timeout
+	report, err := Run(context.Background(), t, Config{
+		ExternalSecrets:      20,
+		ConcurrentReconciles: 2,
+		RefreshInterval:      time.Hour,
+		Limits:               smstandin.Limits{RateLimit: 1},
+		RateLimiter:          workqueue.NewTypedItemExponentialFailureRateLimiter[string](5*time.Millisecond, 100*time.Millisecond),
+		Timeout:              500 * time.Millisecond,
+	})
+	assert.ErrorContains(t, err, "of 20 ExternalSecrets synced after")
+	assert.Less(t, report.Synced, 20)
+	assert.Positive(t, report.Throttled)
+}
+
+// TestLoadTestMatrix runs the load test for several concurrent_reconciles and refresh intervals, against a Secrets
+// Manager with 20ms of latency and a rate limit of 100 requests per second. The number of ExternalSecrets is set with
+// the LOADTEST_EXTERNAL_SECRETS environment variable, the test being skipped if not set.
+func TestLoadTestMatrix(t *testing.T) {
+	externalSecrets, err := strconv.Atoi(os.Getenv("LOADTEST_EXTERNAL_SECRETS"))
+	if err != nil || externalSecrets <= 0 {
+		t.Skip("LOADTEST_EXTERNAL_SECRETS not set")
+	}
+
+	reports, err := RunMatrix(context.Background(), t, Config{
+		ExternalSecrets: externalSecrets,
+		Namespaces:      10,
+		Duration:        10 * time.Second,
+		Limits:          smstandin.Limits{Latency: 20 * time.Millisecond, RateLimit: 100, Burst: 20},
+		Timeout:         10 * time.Minute,
+	}, []int{1, 4, 16}, []time.Duration{5 * time.Second, 30 * time.Second})
+	t.Log("\n" + FormatReports(reports))
+	require.NoError(t, err)
+}
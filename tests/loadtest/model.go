@@ -0,0 +1,169 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/smstandin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Counters are the reconciles of the ESO model, and their results
+type Counters struct {
+	// Reconciles is the number of reconciles of ExternalSecrets
+	Reconciles int
+	// Errors is the number of reconciles failed, including the throttled ones
+	Errors int
+	// Throttled is the number of reconciles failed because Secrets Manager answered 429 Too Many Requests
+	Throttled int
+	// Synced is the number of ExternalSecrets synced at least once
+	Synced int
+}
+
+// ModelController is a model of the ESO ExternalSecret controller, not ESO itself: it syncs the ExternalSecrets of a
+// local API server from the Secrets Manager stand-in with the queueing of the ESO reconciles, Workers ExternalSecrets
+// (concurrent_reconciles) being reconciled at the same time, each one being requeued after its refresh interval once
+// synced or with the backoff of RateLimiter if the provider fails. It doesn't implement the rest of the reconcile of
+// ESO (templates, store resolution, status and events), so the loads it measures are the Secrets Manager API calls of
+// the reconciles, not the resources used by ESO. The ExternalSecrets and the secrets they generate are read and
+// written through the dynamic client, which is much cheaper than the typed fake clientset on a large number of objects
+type ModelController struct {
+	Dynamic dynamic.Interface
+	Source  *smstandin.Client
+	// Workers is the number of concurrent reconciles, 1 if not set
+	Workers int
+	// RateLimiter is the backoff of the failed reconciles, the default rate limiter of the controller-runtime
+	// controllers used by ESO (per item exponential backoff from 5ms and overall 10 qps with a burst of 100) if not set
+	RateLimiter workqueue.TypedRateLimiter[string]
+
+	queue    workqueue.TypedRateLimitingInterface[string]
+	mu       sync.Mutex
+	counters Counters
+	synced   map[string]bool
+}
+
+// Start lists the ExternalSecrets to reconcile and starts the workers, stopped with the context
+func (c *ModelController) Start(ctx context.Context) error {
+	rateLimiter := c.RateLimiter
+	if rateLimiter == nil {
+		rateLimiter = workqueue.DefaultTypedControllerRateLimiter[string]()
+	}
+	c.queue = workqueue.NewTypedRateLimitingQueue(rateLimiter)
+	c.synced = map[string]bool{}
+
+	list, err := c.Dynamic.Resource(ExternalSecretResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		c.queue.ShutDown()
+		return fmt.Errorf("listing the ExternalSecrets: %w", err)
+	}
+	for _, item := range list.Items {
+		c.queue.Add(item.GetNamespace() + "/" + item.GetName())
+	}
+
+	go func() {
+		<-ctx.Done()
+		c.queue.ShutDown()
+	}()
+	for range max(c.Workers, 1) {
+		go func() {
+			for c.processNext(ctx) {
+			}
+		}()
+	}
+	return nil
+}
+
+// Counters returns the reconciles done so far
+func (c *ModelController) Counters() Counters {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counters
+}
+
+func (c *ModelController) processNext(ctx context.Context) bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	refreshInterval, err := c.reconcile(ctx, key)
+	c.mu.Lock()
+	c.counters.Reconciles++
+	if err != nil {
+		c.counters.Errors++
+		if errors.Is(err, smstandin.ErrRateLimited) {
+			c.counters.Throttled++
+		}
+	} else if !c.synced[key] {
+		c.synced[key] = true
+		c.counters.Synced++
+	}
+	c.mu.Unlock()
+
+	switch {
+	case ctx.Err() != nil:
+	case err != nil:
+		c.queue.AddRateLimited(key)
+	default:
+		c.queue.Forget(key)
+		c.queue.AddAfter(key, refreshInterval)
+	}
+	return true
+}
+
+// reconcile syncs the secret of the ExternalSecret, returning its refresh interval
+func (c *ModelController) reconcile(ctx context.Context, key string) (time.Duration, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return 0, err
+	}
+	object, err := c.Dynamic.Resource(ExternalSecretResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	refresh, _, _ := unstructured.NestedString(object.Object, "spec", "refreshInterval")
+	refreshInterval, err := time.ParseDuration(refresh)
+	if err != nil {
+		return 0, fmt.Errorf("ExternalSecret %s: refresh interval: %w", key, err)
+	}
+
+	targetName, _, _ := unstructured.NestedString(object.Object, "spec", "target", "name")
+	targetData := map[string]interface{}{}
+	data, _, _ := unstructured.NestedSlice(object.Object, "spec", "data")
+	for _, item := range data {
+		secretKey, _, _ := unstructured.NestedString(item.(map[string]interface{}), "secretKey")
+		remoteKey, _, _ := unstructured.NestedString(item.(map[string]interface{}), "remoteRef", "key")
+		secret, err := c.Source.GetSecret(ctx, remoteKey)
+		if err != nil {
+			return 0, err
+		}
+		targetData[secretKey] = base64.StdEncoding.EncodeToString([]byte(secret.Payload))
+	}
+	target := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      targetName,
+			"namespace": namespace,
+		},
+		"type": "Opaque",
+		"data": targetData,
+	}}
+
+	secrets := c.Dynamic.Resource(SecretResource).Namespace(namespace)
+	_, err = secrets.Update(ctx, target, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, target, metav1.CreateOptions{})
+	}
+	return refreshInterval, err
+}
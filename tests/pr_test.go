@@ -10,66 +10,60 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gruntwork-io/terratest/modules/k8s"
 	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/terraform-ibm-modules/ibmcloud-terratest-wrapper/cloudinfo"
-	"github.com/terraform-ibm-modules/ibmcloud-terratest-wrapper/common"
 	"github.com/terraform-ibm-modules/ibmcloud-terratest-wrapper/testhelper"
 	"github.com/terraform-ibm-modules/ibmcloud-terratest-wrapper/testschematic"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/bootstrapmigration"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/exemptions"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/reloadercheck"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/rotation"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/scenario"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/syncverify"
 	"gopkg.in/yaml.v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 )
 
 const resourceGroup = "geretain-test-ext-secrets-sync"
-const defaultExampleTerraformDir = "examples/all-combined"
 const basicExampleTerraformDir = "examples/basic"
 
 // schematics DA consts
-const fullConfigSolutionDir = "solutions/fully-configurable"
 const existingResourcesTerraformDir = "tests/existing-resources"
 
 // Define a struct with fields that match the structure of the YAML data
 const yamlLocation = "../common-dev-assets/common-go-assets/common-permanent-resources.yaml"
 
+// scenario files declaring the terraform vars and the expected secrets and stores of the tests
+const allCombinedScenarioFile = "scenarios/all-combined.yaml"
+const fullConfigSolutionScenarioFile = "scenarios/fully-configurable.yaml"
+
 type Config struct {
 	SmGuid   string `yaml:"secretsManagerGuid"`
-	SmCRN    string `yaml:"secretsManagerCRN"`
 	SmRegion string `yaml:"secretsManagerRegion"`
-	RgId     string `yaml:"resourceGroupTestPermanentId"`
-	CisName  string `yaml:"cisInstanceName"`
-
-	// secret ids for the secrets composing the imported certificate to create
-	ImpCertIntermediateSecretId string `yaml:"imported_certificate_intermediate_secret_id"`
-	ImpCertPublicSecretId       string `yaml:"imported_certificate_public_secret_id"`
-	ImpCertPrivateSecretId      string `yaml:"imported_certificate_private_secret_id"`
-	ImpCertificateSmGuid        string `yaml:"imported_certificate_sm_id"`
-	ImpCertificateSmRegion      string `yaml:"imported_certificate_sm_region"`
-
-	// acme private apikey references for CA
-	AcmeLEPrivateKeySmGuid   string `yaml:"acme_letsencrypt_private_key_sm_id"`
-	AcmeLEPrivateKeySmRegion string `yaml:"acme_letsencrypt_private_key_sm_region"`
-	AcmeLEPrivateKeySecretId string `yaml:"acme_letsencrypt_private_key_secret_id"`
 }
 
 var smGuid string
-var smCRN string
 var smRegion string
-var rgId string
-var cisName string
-var impCertificateSmRegion string
-var impCertificateSmGuid string
-var impCertIntermediateSecretID string
-var impCertPublicSecretID string
-var impCertPrivateSecretID string
-var acmeLEPrivateKeySmGuid string
-var acmeLEPrivateKeySmRegion string
-var acmeLEPrivateKeySecretId string
+
+// values of the permanent resources, used to replace the placeholders of the scenarios
+var permanentResources map[string]string
+
+// scenarios for all-combined test (including Upgrade one) and for full config solution tests
+var allCombinedScenario *scenario.Scenario
+var fullConfigSolutionScenario *scenario.Scenario
 
 // terraform vars for all-combined test (including Upgrade one)
 var allCombinedTerraformVars map[string]interface{}
@@ -119,43 +113,33 @@ func TestMain(m *testing.M) {
 		log.Fatal(err)
 	}
 
-	// Parse the SM guid and region from data and setting all-combined test input values used in TestRunDefaultExample and TestRunUpgradeExample
+	// Parse the SM guid and region from data, used in TestReloaderOperational
 	smGuid = config.SmGuid
-	smCRN = config.SmCRN
 	smRegion = config.SmRegion
-	cisName = config.CisName
-	rgId = config.RgId
-	impCertIntermediateSecretID = config.ImpCertIntermediateSecretId
-	impCertPrivateSecretID = config.ImpCertPrivateSecretId
-	impCertPublicSecretID = config.ImpCertPublicSecretId
-	acmeLEPrivateKeySmGuid = config.AcmeLEPrivateKeySmGuid
-	acmeLEPrivateKeySmRegion = config.AcmeLEPrivateKeySmRegion
-	acmeLEPrivateKeySecretId = config.AcmeLEPrivateKeySecretId
-	impCertificateSmGuid = config.ImpCertificateSmGuid
-	impCertificateSmRegion = config.ImpCertificateSmRegion
-
-	allCombinedTerraformVars = map[string]interface{}{
-		"existing_cis_instance_name":              cisName,
-		"existing_cis_instance_resource_group_id": rgId,
-		// imported certificate and public certificate creation management
-		"existing_sm_instance_crn":                    smCRN,
-		"existing_sm_instance_guid":                   smGuid,
-		"existing_sm_instance_region":                 smRegion,
-		"imported_certificate_sm_region":              impCertificateSmRegion,
-		"imported_certificate_sm_id":                  impCertificateSmGuid,
-		"imported_certificate_intermediate_secret_id": impCertIntermediateSecretID,
-		"imported_certificate_public_secret_id":       impCertPublicSecretID,
-		"imported_certificate_private_secret_id":      impCertPrivateSecretID,
-		"acme_letsencrypt_private_key_secret_id":      acmeLEPrivateKeySecretId,
-		"acme_letsencrypt_private_key_sm_id":          acmeLEPrivateKeySmGuid,
-		"acme_letsencrypt_private_key_sm_region":      acmeLEPrivateKeySmRegion,
-		// setting skip_iam_authorization_policy to true because using the existing secrets manager instance and the policy already exists
-		"skip_iam_authorization_policy": true,
-		"service_endpoints":             "public",
-		// setting CIS domain to be used in the test
-		"pvt_cert_common_name":    "goldeneye.dev.cloud.ibm.com",
-		"pvt_root_ca_common_name": "goldeneye.dev.cloud.ibm.com",
-		"cert_common_name":        "goldeneye.dev.cloud.ibm.com",
+
+	// the permanent resources values by YAML key, to replace the placeholders of the scenarios
+	// setting all-combined test input values used in TestRunDefaultExample and TestRunUpgradeExample
+	var permanentResourcesData map[string]interface{}
+	err = yaml.Unmarshal(data, &permanentResourcesData)
+	if err != nil {
+		log.Fatal(err)
+	}
+	permanentResources = map[string]string{}
+	for key, value := range permanentResourcesData {
+		permanentResources[key] = fmt.Sprint(value)
+	}
+
+	allCombinedScenario, err = scenario.Load(allCombinedScenarioFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	allCombinedTerraformVars, err = allCombinedScenario.Vars(permanentResources)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fullConfigSolutionScenario, err = scenario.Load(fullConfigSolutionScenarioFile)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	os.Exit(m.Run())
@@ -171,6 +155,8 @@ func TestMain(m *testing.M) {
 // which is a public certificate generated for a test CN and contains the three different components whose value can be used to rotate the expired certificates
 // mentioned above. It is configured to be automatically rotated by Secrets Manager so its values are always up to date.
 
+// static list of the updates to ignore for the consistency and upgrade checks, completed at each run by the updates
+// derived from the plan by deriveIgnoreUpdates: the entries it reports as stale can be removed
 var ignoreUpdates = []string{
 	"module.es_kubernetes_secret_usr_pass.helm_release.external_secrets_operator[0]",
 	"module.es_kubernetes_secret_arbitrary_cloudant.helm_release.external_secrets_operator[0]",
@@ -200,6 +186,24 @@ var ignoreUpdates = []string{
 	"module.external_secrets_trusted_profiles[1].ibm_iam_trusted_profile.trusted_profile",
 }
 
+// scenarioValues returns the values to replace the scenarios placeholders: the permanent resources ones and the given ones
+func scenarioValues(values map[string]string) map[string]string {
+	merged := map[string]string{}
+	for key, value := range permanentResources {
+		merged[key] = value
+	}
+	for key, value := range values {
+		merged[key] = value
+	}
+	return merged
+}
+
+// getStoreReadyStatus returns the status of the Ready condition of a SecretStore or ClusterSecretStore
+func getStoreReadyStatus(t *testing.T, options *k8s.KubectlOptions, store scenario.Store) (string, error) {
+	resource := strings.ToLower(store.Kind) + "s.external-secrets.io"
+	return k8s.RunKubectlAndGetOutputContextE(t, context.Background(), options, "get", resource, store.Name, "-o", `jsonpath={.status.conditions[?(@.type=="Ready")].status}`)
+}
+
 func setupOptions(t *testing.T, prefix string, terraformDir string, terraformVars map[string]interface{}) *testhelper.TestOptions {
 	options := testhelper.TestOptionsDefaultWithVars(&testhelper.TestOptions{
 		Testing:       t,
@@ -222,13 +226,53 @@ func setupOptions(t *testing.T, prefix string, terraformDir string, terraformVar
 		CheckApplyResultForUpgrade: true,
 	})
 
+	// the updates to ignore are derived from the plan of the applied configuration, on top of the static list
+	options.PostApplyHook = func(options *testhelper.TestOptions) error {
+		return deriveIgnoreUpdates(t, options, options.TerraformOptions.TerraformDir)
+	}
+
 	return options
 }
 
+// deriveIgnoreUpdates plans planDir with the state of the last apply of the test helper, and sets the updates to ignore
+// to the static ignoreUpdates list completed by the updates derived from the plan by the exemptions package, logging
+// the reason of each of them. It also reports the entries of the static list which are no longer needed, failing the
+// test if IGNORE_UPDATES_REPORT is set to strict.
+func deriveIgnoreUpdates(t *testing.T, options *testhelper.TestOptions, planDir string) error {
+	planOptions := *options.TerraformOptions
+	planOptions.TerraformDir = planDir
+	planOptions.PlanFilePath = filepath.Join(t.TempDir(), "ignore-updates.tfplan")
+	if planDir != options.TerraformOptions.TerraformDir {
+		planOptions.ExtraArgs.Plan = append(slices.Clone(planOptions.ExtraArgs.Plan), "-state="+filepath.Join(options.TerraformOptions.TerraformDir, "terraform.tfstate"))
+	}
+	plan, err := terraform.InitAndPlanAndShowWithStructContextE(t, context.Background(), &planOptions)
+	if err != nil {
+		return fmt.Errorf("planning to derive the updates to ignore: %w", err)
+	}
+
+	result := exemptions.NewClassifier().Classify(&plan.RawPlan)
+	for _, exemption := range result.Exemptions {
+		logger.Logf(t, "Ignoring update of %s: %s", exemption.Address, exemption.Reason)
+	}
+	for _, unclassified := range result.Unclassified {
+		logger.Logf(t, "Update of %s not derived, attributes %v", unclassified.Address, unclassified.Attributes)
+	}
+	options.IgnoreUpdates.List = append(slices.Clone(ignoreUpdates), result.Addresses()...)
+
+	stale := exemptions.Report(ignoreUpdates, &plan.RawPlan, result)
+	for _, entry := range stale {
+		logger.Logf(t, "Stale ignoreUpdates entry %s: %s", entry.Address, entry.Reason)
+	}
+	if len(stale) > 0 && os.Getenv("IGNORE_UPDATES_REPORT") == "strict" {
+		return fmt.Errorf("%d stale entries in ignoreUpdates", len(stale))
+	}
+	return nil
+}
+
 func TestRunDefaultExample(t *testing.T) {
 	t.Parallel()
 
-	options := setupOptions(t, "eso", defaultExampleTerraformDir, allCombinedTerraformVars)
+	options := setupOptions(t, "eso", allCombinedScenario.TerraformDir, allCombinedTerraformVars)
 
 	// Temp workaround for https://github.com/terraform-ibm-modules/terraform-ibm-base-ocp-vpc?tab=readme-ov-file#the-specified-api-key-could-not-be-found
 	createContainersApikey(t, options.Region, resourceGroup)
@@ -250,29 +294,15 @@ func TestRunDefaultExample(t *testing.T) {
 
 			log.Println("clusterId " + clusterId)
 
-			// building the list of secrets to test
-			namespaces_for_apikey_login := []string{"apikeynspace1", "apikeynspace2", "apikeynspace3", "apikeynspace4"}
-			namespaces_for_tp_login := []string{"tpnspace1", "tpnspace2"}
-
-			secretsMap := map[string]string{
-				"dockerconfigjson-uc": namespaces_for_apikey_login[0],
-				// temporary disabled cloudant resource key secret test
-				"dockerconfigjson-arb":                         namespaces_for_apikey_login[2],
-				"pvtcertificate-tls":                           namespaces_for_apikey_login[2],
-				"kv-single-key":                                namespaces_for_apikey_login[3],
-				"kv-multiple-keys":                             namespaces_for_apikey_login[3],
-				"dockerconfigjson-iam":                         namespaces_for_apikey_login[3],
-				"dockerconfigjson-chain":                       namespaces_for_apikey_login[3],
-				options.Prefix + "-arbitrary-arb-tp-0":         namespaces_for_tp_login[0],
-				options.Prefix + "-arbitrary-arb-tp-1":         namespaces_for_tp_login[1],
-				options.Prefix + "-arbitrary-arb-tp-multisg-1": "tpns-multisg",
-				options.Prefix + "-arbitrary-arb-tp-multisg-2": "tpns-multisg",
-				options.Prefix + "-arbitrary-arb-tp-nosg":      "tpns-nosg",
-				options.Prefix + "-arbitrary-arb-cstore-tp":    "eso-cstore-tp-namespace",
-				"service-credential-test-secret":               "service-credential-test-ns", // pragma: allowlist secret
-			}
+			// building the list of secrets and stores to test from the scenario
+			values := scenarioValues(map[string]string{"prefix": options.Prefix})
+			expectations, err := allCombinedScenario.ExpectedSecrets(values)
+			require.NoError(t, err)
+			stores, err := allCombinedScenario.ExpectedStores(values)
+			require.NoError(t, err)
 
-			log.Printf("secretsMap %s", secretsMap)
+			log.Printf("secrets to verify %v", expectations)
+			log.Printf("stores to verify %v", stores)
 
 			// get cluster config
 			log.Println("Loading cluster configuration with id " + clusterId)
@@ -285,12 +315,22 @@ func TestRunDefaultExample(t *testing.T) {
 				}()
 				if assert.Nil(t, err, "Error getting cluster config path") {
 					// for each secret to test configure Terratest with cluster config
-					// the test checks if each secret is correctly created in the cluster
-					for secretName, secretNamespace := range secretsMap {
-						ocOptions := k8s.NewKubectlOptions("", clusterConfigPath, secretNamespace)
-						log.Printf("Testing secret name %s namespace %s\n", secretName, secretNamespace)
-						_, err := k8s.GetSecretContextE(t, context.Background(), ocOptions, secretName)
-						assert.Nil(t, err, "Error retrieving secret "+secretName+" in namespace "+secretNamespace)
+					// the test checks if each secret is correctly created in the cluster with the expected keys and non empty values
+					for _, expectation := range expectations {
+						ocOptions := k8s.NewKubectlOptions("", clusterConfigPath, expectation.Namespace)
+						log.Printf("Testing secret name %s namespace %s\n", expectation.Name, expectation.Namespace)
+						secret, err := k8s.GetSecretContextE(t, context.Background(), ocOptions, expectation.Name)
+						if assert.Nil(t, err, "Error retrieving secret "+expectation.Name+" in namespace "+expectation.Namespace) {
+							assert.NoError(t, syncverify.Verify(context.Background(), secret, expectation, nil))
+						}
+					}
+					// the test checks if each store is created in the cluster and ready
+					for _, store := range stores {
+						log.Printf("Testing %s name %s namespace %s\n", store.Kind, store.Name, store.Namespace)
+						ready, err := getStoreReadyStatus(t, k8s.NewKubectlOptions("", clusterConfigPath, store.Namespace), store)
+						if assert.Nil(t, err, "Error retrieving "+store.Kind+" "+store.Name) {
+							assert.Equal(t, "True", ready, store.Kind+" "+store.Name+" is not ready")
+						}
 					}
 				}
 			}
@@ -302,11 +342,24 @@ func TestRunDefaultExample(t *testing.T) {
 func TestRunUpgradeExample(t *testing.T) {
 	t.Parallel()
 
-	options := setupOptions(t, "eso-upg", defaultExampleTerraformDir, allCombinedTerraformVars)
+	options := setupOptions(t, "eso-upg", allCombinedScenario.TerraformDir, allCombinedTerraformVars)
 
 	// Temp workaround for https://github.com/terraform-ibm-modules/terraform-ibm-base-ocp-vpc?tab=readme-ov-file#the-specified-api-key-could-not-be-found
 	createContainersApikey(t, options.Region, resourceGroup)
 
+	// the upgrade is planned by the test helper after the apply of the base ref: the updates to ignore are derived
+	// from the plan of a copy of the working tree with the state of the base ref
+	upgradeDir := test_structure.CopyTerraformFolderToTemp(t, "..", options.TerraformDir)
+	options.PostApplyHook = func(options *testhelper.TestOptions) error {
+		// the API key rotation enabled on the secrets store replaces its API key secret with the bootstrap one
+		output, err := bootstrapmigration.Command(context.Background(), options.TerraformOptions.TerraformDir, "", "module.eso_apikey_namespace_secretstore_1").CombinedOutput()
+		logger.Log(t, string(output))
+		if err != nil {
+			return fmt.Errorf("migrating the API key secret to the bootstrap secret: %w", err)
+		}
+		return deriveIgnoreUpdates(t, options, upgradeDir)
+	}
+
 	output, err := options.RunTestUpgrade()
 	if !options.UpgradeTestSkipped {
 		assert.Nil(t, err, "This should not have errored")
@@ -314,6 +367,9 @@ func TestRunUpgradeExample(t *testing.T) {
 	}
 }
 
+// namespace ignored by the Reloader in TestReloaderOperational
+const reloaderIgnoredNamespace = "reloader-ignored-ns"
+
 func TestReloaderOperational(t *testing.T) {
 	t.Parallel()
 	// terraform vars for reloader test
@@ -321,6 +377,8 @@ func TestReloaderOperational(t *testing.T) {
 
 	reloaderTerraformVars["existing_sm_instance_guid"] = smGuid
 	reloaderTerraformVars["existing_sm_instance_region"] = smRegion
+	// the updates of the secrets of this namespace must not reload the workloads
+	reloaderTerraformVars["reloader_namespaces_to_ignore"] = reloaderIgnoredNamespace
 
 	options := setupOptions(t, "reloader", basicExampleTerraformDir, reloaderTerraformVars)
 
@@ -422,94 +480,50 @@ func TestReloaderOperational(t *testing.T) {
 						}
 					}
 
-					// test reloader functionality
-					sampleApp := "./samples/sample.yaml"
-					deploymentName := "example-deployment"
-					namespace := "reloader-test-ns"
-					containerName := "busybox-container"
-					secretName := "example-secret"
-					secretValue := "top-secret"
-					updatedSecret := "./samples/updated_secret.yaml" // pragma: allowlist secret
-					updatedSecretValue := "updated-secret"
-
-					sleepBetweenRetries := 20 * time.Second
-					// configure Terratest with cluster config
-					ocOptions := k8s.NewKubectlOptions("", clusterConfigPath, namespace)
-					// deploy sample app
-					applyError := k8s.KubectlApplyContextE(t, context.Background(), ocOptions, sampleApp)
-					if assert.Nil(t, applyError, "Error applying sample app") {
-						// confirm app is running
-						k8s.WaitUntilDeploymentAvailableContext(t, context.Background(), ocOptions, deploymentName, 20, sleepBetweenRetries)
-						k8s.WaitUntilSecretAvailableContext(t, context.Background(), ocOptions, secretName, 20, sleepBetweenRetries)
-						// Check that the secret value is correct
-						// Get pod name from deployment
-						pods, err := GetPodNamesFromDeployment(t, ocOptions, deploymentName)
-						if assert.Nil(t, err, "Error getting pod names") {
-							initialPod := k8s.GetPodContext(t, context.Background(), ocOptions, pods[0])
-							k8s.WaitUntilPodAvailableContext(t, context.Background(), ocOptions, initialPod.Name, 20, sleepBetweenRetries)
-							logs := k8s.GetPodLogsContext(t, context.Background(), ocOptions, initialPod, containerName)
-							if assert.Contains(t, logs, secretValue, "Initial Secret value not found in logs") {
-								t.Log("Initial secret value found in logs")
-								t.Log(logs)
-							}
-
-							// update secret with updated secret
-							applyError = k8s.KubectlApplyContextE(t, context.Background(), ocOptions, updatedSecret)
-							if assert.Nil(t, applyError, "Error applying updated secret") {
-								// Set a timeout duration
-								timeout := 20 * time.Second
-
-								// Create a channel to signal the end of the timeout
-								timeoutChan := time.After(timeout)
-								var newPodName string
-								failed := false
-								// Loop until a new initialPod is found or until timeout
-								// Using a label on the for loop allows us to break out of the loop, otherwise the break would only break out of the select statement
-							Loop:
-								for {
-									select {
-									case <-timeoutChan:
-										// Handle the timeout case
-										assert.Fail(t, "timeout reached while waiting for initialPod to change")
-										failed = true
-										break Loop
-									default:
-										// Sleep to avoid busy waiting
-										time.Sleep(time.Second)
-
-										// Update initialPod names
-										currentPods, err := GetPodNamesFromDeployment(t, ocOptions, deploymentName)
-										if err != nil {
-											t.Log("Error getting initialPod names")
-											// Use the labeled break to exit the outer loop
-											continue Loop
-										}
-
-										for _, pod := range currentPods {
-											if !common.StrArrayContains(pods, pod) {
-												newPodName = pod
-												break Loop
-											}
-										}
-
-										if newPodName != "" {
-											break Loop
-										}
-									}
-								}
-								if !failed {
-									k8s.WaitUntilDeploymentAvailableContext(t, context.Background(), ocOptions, deploymentName, 20, sleepBetweenRetries)
-									newPod := k8s.GetPodContext(t, context.Background(), ocOptions, newPodName)
-									k8s.WaitUntilPodAvailableContext(t, context.Background(), ocOptions, newPod.Name, 20, sleepBetweenRetries)
-									// confirm app restarted and picked up new secret by checking logs
-									newLogs := k8s.GetPodLogsContext(t, context.Background(), ocOptions, newPod, containerName)
-									if assert.Contains(t, newLogs, updatedSecretValue, "Updated Secret value not found in logs") {
-										t.Log("Updated secret value found in logs")
-										t.Log(newLogs)
-									}
+					// test reloader functionality with the reload strategy of the module, for all the kinds of workload
+					reloadStrategy, _ := options.TerraformVars["reloader_reload_strategy"].(string)
+					if reloadStrategy == "" {
+						if rootData, err := os.ReadFile(filepath.Join(options.TerraformDir, "..", "..", "variables.tf")); err == nil {
+							reloadStrategy = extractDefaultValueFromFile(strings.Split(string(rootData), "\n"), "reloader_reload_strategy")
+						}
+					}
+					clientset, err := k8s.GetKubernetesClientFromOptionsContextE(t, context.Background(), k8s.NewKubectlOptions("", clusterConfigPath, ""))
+					if assert.Nil(t, err, "Error creating kubernetes client") {
+						checker := &reloadercheck.Checker{
+							Client:       clientset,
+							Namespace:    "reloader-test-ns",
+							Strategy:     reloadercheck.Strategy(reloadStrategy),
+							Timeout:      5 * time.Minute,
+							NodeSelector: map[string]string{"dedicated": "default"},
+							CheckRollout: true,
+						}
+						if assert.Nil(t, checker.EnsureNamespace(context.Background()), "Error creating reloader test namespace") {
+							defer func() {
+								assert.Nil(t, checker.DeleteNamespace(context.Background()), "Error deleting reloader test namespace")
+							}()
+							for _, kind := range reloadercheck.Kinds {
+								reload, err := checker.VerifyReload(context.Background(), kind, "reload-"+strings.ToLower(string(kind)))
+								if assert.Nil(t, err, "%s not reloaded", kind) {
+									t.Logf("%s reloaded with strategy %s after %s", kind, reloadStrategy, reload.Duration)
 								}
 							}
+							// reloader_reload_on_create is enabled by default
+							reload, err := checker.VerifyReloadOnCreate(context.Background(), reloadercheck.KindDeployment, "reload-on-create")
+							if assert.Nil(t, err, "Deployment not reloaded on the creation of the secret") {
+								t.Logf("Deployment reloaded on the creation of the secret after %s", reload.Duration)
+							}
+						}
+						// the workloads of the namespace ignored through reloader_namespaces_to_ignore are not reloaded
+						ignoredChecker := *checker
+						ignoredChecker.Namespace = reloaderIgnoredNamespace
+						if assert.Nil(t, ignoredChecker.EnsureNamespace(context.Background()), "Error creating reloader ignored namespace") {
+							defer func() {
+								assert.Nil(t, ignoredChecker.DeleteNamespace(context.Background()), "Error deleting reloader ignored namespace")
+							}()
+							assert.Nil(t, ignoredChecker.VerifyNoReload(context.Background(), reloadercheck.KindDeployment, "no-reload"), "Deployment reloaded in an ignored namespace")
 						}
+						// the rotation of the arbitrary secret of the example is synced by ESO and reloads its workload
+						verifyRotation(t, outputs, clusterConfigPath, checker)
 					}
 				}
 			}
@@ -518,29 +532,62 @@ func TestReloaderOperational(t *testing.T) {
 	}
 }
 
-func GetPodNamesFromDeployment(t *testing.T, options *k8s.KubectlOptions, deploymentName string) ([]string, error) {
-	// Get the deployment object
-	deployment, err := k8s.GetDeploymentContextE(t, context.Background(), options, deploymentName)
-	if err != nil {
-		return nil, err
+// verifyRotation rotates the value of the arbitrary secret of the basic example in Secrets Manager, forces the refresh
+// of its ExternalSecret and checks that the deployment consuming it is reloaded and rolled out with the rotated value
+func verifyRotation(t *testing.T, outputs map[string]interface{}, clusterConfigPath string, checker *reloadercheck.Checker) {
+	_, tfOutputsErr := testhelper.ValidateTerraformOutputs(outputs, "secrets_manager_guid", "secrets_manager_region", "rotated_secret_id", "rotated_external_secret")
+	if !assert.Nil(t, tfOutputsErr, tfOutputsErr) {
+		return
+	}
+	externalSecret, _ := outputs["rotated_external_secret"].(map[string]interface{})
+	workloadAnnotations := map[string]string{}
+	annotations, _ := externalSecret["workload_annotations"].(map[string]interface{})
+	for name, value := range annotations {
+		workloadAnnotations[name] = fmt.Sprint(value)
 	}
 
-	// Construct the label selector from the deployment
-	labelSelector := metav1.FormatLabelSelector(deployment.Spec.Selector)
-
-	// List Pods using label selector
-	pods, err := k8s.ListPodsContextE(t, context.Background(), options, metav1.ListOptions{LabelSelector: labelSelector})
-	if err != nil {
-		return nil, err
+	config, err := k8s.LoadApiClientConfigE(clusterConfigPath, "")
+	if !assert.Nil(t, err, "Error loading the cluster config") {
+		return
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if !assert.Nil(t, err, "Error creating kubernetes dynamic client") {
+		return
 	}
 
-	// Extract the pod names
-	var podNames []string
-	for _, pod := range pods {
-		podNames = append(podNames, pod.Name)
+	// the deployment is created in the namespace of the ExternalSecret
+	rotationChecker := *checker
+	rotationChecker.Namespace = fmt.Sprint(externalSecret["namespace"])
+	rotationChecker.SecretKey = fmt.Sprint(externalSecret["data_key"])
+	rotationScenario := &rotation.Scenario{
+		Dynamic: dynamicClient,
+		Source: &rotation.SecretsManager{
+			URL:    rotation.SecretsManagerURL(fmt.Sprint(outputs["secrets_manager_guid"]), fmt.Sprint(outputs["secrets_manager_region"])),
+			APIKey: os.Getenv("TF_VAR_ibmcloud_api_key"),
+		},
+		SecretID:            fmt.Sprint(outputs["rotated_secret_id"]),
+		ExternalSecret:      fmt.Sprint(externalSecret["name"]),
+		Checker:             &rotationChecker,
+		Deployment:          "rotation-app",
+		WorkloadAnnotations: workloadAnnotations,
+		Timeout:             5 * time.Minute,
 	}
+	defer func() {
+		err := rotationChecker.Client.AppsV1().Deployments(rotationChecker.Namespace).Delete(context.Background(), rotationScenario.Deployment, metav1.DeleteOptions{})
+		assert.Nil(t, err, "Error deleting the rotation deployment")
+	}()
 
-	return podNames, nil
+	value := "rotated-" + strings.ToLower(random.UniqueId())
+	report, err := rotationScenario.Run(context.Background(), value)
+	t.Logf("Rotation of secret %s: %s", rotationScenario.SecretID, report)
+	if assert.Nil(t, err, "Rotated secret not reloaded") {
+		stages := make([]string, 0, len(report.Stages))
+		for _, stage := range report.Stages {
+			stages = append(stages, stage.Name)
+		}
+		assert.Equal(t, []string{rotation.StageRotate, rotation.StageRefresh, rotation.StageReload, rotation.StageRollout}, stages)
+		assert.Nil(t, rotationChecker.WaitForPodsValue(context.Background(), rotationScenario.Deployment, value), "Rolled out pods don't consume the rotated value")
+	}
 }
 
 // Helper function to extract default value from terraform variable definitions
@@ -637,25 +684,35 @@ func setupOptionsSchematics(t *testing.T, prefix string, dir string) *testhelper
 	return options
 }
 
+// solutionTarIncludePatterns returns the patterns of the files uploaded to Schematics for the solution in dir: the
+// modules it calls, the chart and the scripts they run
+func solutionTarIncludePatterns(dir string) []string {
+	return []string{
+		"*.tf",
+		"chart/*.yaml",
+		"chart/raw/*.yaml",
+		"chart/raw/templates/*.yaml",
+		"chart/raw/templates/*.tpl",
+		"modules/eso-cbr-rule/*.tf",
+		"modules/eso-cluster-platform/*.tf",
+		"modules/eso-clusterstore/*.tf",
+		"modules/eso-secretstore/*.tf",
+		"modules/eso-trusted-profile/*.tf",
+		"modules/eso-external-secret/*.tf",
+		"modules/eso-external-secret-resource/*.tf",
+		"scripts/*.sh",
+		dir + "/*.tf",
+	}
+}
+
 // sets up options for solutions through schematics
 func setupSolutionSchematicOptions(t *testing.T, prefix string, dir string) *testschematic.TestSchematicOptions {
 
 	logger.Log(t, "setupSolutionSchematicOptions - Using prefix: ", prefix)
 
 	options := testschematic.TestSchematicOptionsDefault(&testschematic.TestSchematicOptions{
-		Testing: t,
-		TarIncludePatterns: []string{
-			"*.tf",
-			"chart/*.yaml",
-			"chart/raw/*.yaml",
-			"chart/raw/templates/*.yaml",
-			"chart/raw/templates/*.tpl",
-			"modules/eso-clusterstore/*.tf",
-			"modules/eso-secretstore/*.tf",
-			"modules/eso-trusted-profile/*.tf",
-			"modules/eso-external-secret/*.tf",
-			dir + "/*.tf",
-		},
+		Testing:               t,
+		TarIncludePatterns:    solutionTarIncludePatterns(dir),
 		TemplateFolder:        dir,
 		Tags:                  []string{"test-esoda-schematic"},
 		Prefix:                prefix,
@@ -672,125 +729,106 @@ func setupSolutionSchematicOptions(t *testing.T, prefix string, dir string) *tes
 	return options
 }
 
+// localModuleSource matches the path of the modules called from a local directory
+var localModuleSource = regexp.MustCompile(`source\s*=\s*"(\.\.?/[^"]*)"`)
+
+// modulePathFile matches the files referenced from the module directory, such as the scripts run by local-exec, the
+// paths built with other interpolations being ignored
+var modulePathFile = regexp.MustCompile(`\$\{path\.module\}/([^"$]+)"`)
+
+// solutionFiles returns the paths, relative to root, of the terraform files of the solution in dir and of the modules
+// it calls, and of the files referenced from their directories
+func solutionFiles(t *testing.T, root string, dir string) []string {
+	var files []string
+	visited := map[string]bool{}
+	modules := []string{filepath.Clean(dir)}
+	for len(modules) > 0 {
+		module := modules[0]
+		modules = modules[1:]
+		if visited[module] {
+			continue
+		}
+		visited[module] = true
+
+		paths, err := filepath.Glob(filepath.Join(root, module, "*.tf"))
+		require.NoError(t, err)
+		require.NotEmpty(t, paths, "no terraform files in the module %s", module)
+		for _, path := range paths {
+			files = append(files, filepath.ToSlash(filepath.Join(module, filepath.Base(path))))
+			content, err := os.ReadFile(path)
+			require.NoError(t, err)
+			for _, match := range localModuleSource.FindAllStringSubmatch(string(content), -1) {
+				modules = append(modules, filepath.Join(module, match[1]))
+			}
+			for _, match := range modulePathFile.FindAllStringSubmatch(string(content), -1) {
+				files = append(files, filepath.ToSlash(filepath.Join(module, match[1])))
+			}
+		}
+	}
+	return files
+}
+
+func TestSolutionTarIncludePatterns(t *testing.T) {
+	t.Parallel()
+
+	dir := fullConfigSolutionScenario.TerraformDir
+	patterns := solutionTarIncludePatterns(dir)
+	// terraform init fails on Schematics if a module called by the solution is not uploaded
+	for _, file := range solutionFiles(t, "..", dir) {
+		matched := false
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, file); ok {
+				matched = true
+				break
+			}
+		}
+		assert.True(t, matched, "%s, used by the solution %s, is not uploaded to Schematics", file, dir)
+	}
+}
+
 // helper function to set up inputs for full config solution test, will help keep it consistent
 // between normal and upgrade tests
 func getFullConfigSolutionTestVariables(mainOptions *testschematic.TestSchematicOptions, existingOptions *testhelper.TestOptions) []testschematic.TestSchematicTerraformVar {
 
-	eso_secretsstores_configuration := map[string]any{
-		"cluster_secrets_stores": map[string]any{
-
-			"css-1": map[string]any{
-				"namespace":        "eso-namespace-cs1",
-				"create_namespace": true,
-				// "existing_serviceid_id":                  "",
-				"serviceid_name":        "esoda-test-css-1-serviceid",
-				"serviceid_description": "esoda-test-css-1-serviceid description",
-				// "existing_account_secrets_group_id":      "",
-				"account_secrets_group_name":             "esoda-test-cs-accsg-1",
-				"account_secrets_group_description":      "esoda-test-cs-accsg-1 description",
-				"trusted_profile_name":                   "",
-				"trusted_profile_description":            "",
-				"existing_service_secrets_group_id_list": []string{},
-				"service_secrets_groups_list": []map[string]any{
-					{
-						"name":        "esoda-test-cs-s1-sg",
-						"description": "Secrets group 1 for secrets used by the ESO",
-					},
-					{
-						"name":        "esoda-test-cs-s2-sg",
-						"description": "Secrets group 2 for secrets used by the ESO",
-					},
-				},
-			},
-			"css-2": map[string]any{
-				"namespace":                         "eso-namespace-cs2",
-				"create_namespace":                  true,
-				"existing_serviceid_id":             "",
-				"serviceid_name":                    "esoda-test-css-3-serviceid",
-				"serviceid_description":             "esoda-test-css-3-serviceid description",
-				"existing_account_secrets_group_id": "",
-				"account_secrets_group_name":        "esoda-test-cs-accsg-3",
-				"account_secrets_group_description": "esoda-test-cs-accsg-3 description",
-				// "trusted_profile_name":                   "",
-				// "trusted_profile_description":            "",
-				"existing_service_secrets_group_id_list": []string{},
-				"service_secrets_groups_list": []map[string]any{
-					{
-						"name":        "esoda-test-cs-s3-sg",
-						"description": "Secrets group 3 for secrets used by the ESO",
-					},
-					{
-						"name":        "esoda-test-cs-s4-sg",
-						"description": "Secrets group 4 for secrets used by the ESO",
-					},
-				},
-			},
-		},
-		"secrets_stores": map[string]any{
-
-			"ss-1": map[string]any{
-				"namespace":                         "eso-namespace-ss1",
-				"create_namespace":                  true,
-				"existing_serviceid_id":             "",
-				"serviceid_name":                    "esoda-test-ss-1-serviceid",
-				"serviceid_description":             "esoda-test-ss-1-serviceid description",
-				"existing_account_secrets_group_id": "",
-				"account_secrets_group_name":        "esoda-test-ss-accsg-1",
-				"account_secrets_group_description": "esoda-test-ss-accsg-1 description",
-				// "trusted_profile_name":                   "",
-				// "trusted_profile_description":            "",
-				"existing_service_secrets_group_id_list": []string{},
-				"service_secrets_groups_list": []map[string]any{
-					{
-						"name":        "esoda-test-ss-s1-sg",
-						"description": "Secrets group 1 for secrets used by the ESO",
-					},
-					{
-						"name":        "esoda-test-ss-s2-sg",
-						"description": "Secrets group 2 for secrets used by the ESO",
-					},
-				},
-			},
-			"ss-2": map[string]any{
-				"namespace":        "eso-namespace-ss2",
-				"create_namespace": true,
-				// "existing_serviceid_id":                  "",
-				"serviceid_name":        "esoda-test-ss-2-serviceid",
-				"serviceid_description": "esoda-test-ss-2-serviceid description",
-				// "existing_account_secrets_group_id":      "",
-				"account_secrets_group_name":             "esoda-test-ss-accsg-2",
-				"account_secrets_group_description":      "esoda-test-ss-accsg-2 description",
-				"trusted_profile_name":                   "",
-				"trusted_profile_description":            "",
-				"existing_service_secrets_group_id_list": []string{},
-				"service_secrets_groups_list": []map[string]any{
-					{
-						"name":        "esoda-test-ss-s3-sg",
-						"description": "Secrets group 3 for secrets used by the ESO",
-					},
-					{
-						"name":        "esoda-test-ss-s4-sg",
-						"description": "Secrets group 4 for secrets used by the ESO",
-					},
-				},
-			},
-		},
-	}
+	scenarioVars, err := fullConfigSolutionScenario.Vars(scenarioValues(map[string]string{
+		"existingClusterCRN": fmt.Sprint(existingOptions.LastTestTerraformOutputs["cluster_crn"]),
+	}))
+	require.NoError(mainOptions.Testing, err)
 
 	logger.Log(mainOptions.Testing, "setupSolutionSchematicOptions - Using mainOptions.Prefix: ", mainOptions.Prefix)
 
 	vars := []testschematic.TestSchematicTerraformVar{
 		{Name: "ibmcloud_api_key", Value: mainOptions.RequiredEnvironmentVars["TF_VAR_ibmcloud_api_key"], DataType: "string", Secure: true},
 		{Name: "prefix", Value: mainOptions.Prefix, DataType: "string"},
-		{Name: "existing_secrets_manager_crn", Value: smCRN, DataType: "string"},
-		{Name: "existing_cluster_crn", Value: existingOptions.LastTestTerraformOutputs["cluster_crn"], DataType: "string"},
+	}
 
-		{Name: "eso_secretsstores_configuration", Value: eso_secretsstores_configuration, DataType: "object"},
+	// the scenario inputs, sorted to keep the workspace variables stable between runs
+	names := make([]string, 0, len(scenarioVars))
+	for name := range scenarioVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vars = append(vars, testschematic.TestSchematicTerraformVar{Name: name, Value: scenarioVars[name], DataType: schematicDataType(scenarioVars[name])})
 	}
 
 	return vars
 }
 
+// schematicDataType returns the Schematics data type of a scenario input value
+func schematicDataType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, float64:
+		return "number"
+	default:
+		return "object"
+	}
+}
+
 func TestRunFullConfigSolutionSchematics(t *testing.T) {
 
 	// set up the options for existing resource deployment
@@ -812,7 +850,7 @@ func TestRunFullConfigSolutionSchematics(t *testing.T) {
 	require.NoError(t, existDeployErr, "error creating needed existing resources")
 
 	// start main schematics test
-	options := setupSolutionSchematicOptions(t, "eso-full", fullConfigSolutionDir)
+	options := setupSolutionSchematicOptions(t, "eso-full", fullConfigSolutionScenario.TerraformDir)
 
 	options.TerraformVars = getFullConfigSolutionTestVariables(options, existingResourceOptions)
 
@@ -841,7 +879,7 @@ func TestRunFullConfigSolutionUpgradeSchematics(t *testing.T) {
 	require.NoError(t, existDeployErr, "error creating needed existing VPC resources")
 
 	// start main schematics test
-	options := setupSolutionSchematicOptions(t, "eso-fupg", fullConfigSolutionDir)
+	options := setupSolutionSchematicOptions(t, "eso-fupg", fullConfigSolutionScenario.TerraformDir)
 
 	options.TerraformVars = getFullConfigSolutionTestVariables(options, existingResourceOptions)
 
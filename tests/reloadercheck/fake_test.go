@@ -0,0 +1,135 @@
+package reloadercheck
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// fakeReloader reproduces on a local API server, without controllers, the reloads of the Reloader for the options set
+// by the module: it updates the pod templates of the workloads to reload on the secrets updates
+type fakeReloader struct {
+	client             kubernetes.Interface
+	strategy           Strategy
+	ignoreSecrets      bool
+	namespacesToIgnore []string
+	reloadOnCreate     bool
+}
+
+// start watches the secrets of all the namespaces until the end of the test, the errors failing the test
+func (r *fakeReloader) start(t testing.TB) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	watcher, err := r.client.CoreV1().Secrets("").Watch(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("fake reloader: watching secrets: %v", err)
+	}
+	go func() {
+		defer watcher.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+				secret, isSecret := event.Object.(*corev1.Secret)
+				if !isSecret || (event.Type != watch.Modified && (event.Type != watch.Added || !r.reloadOnCreate)) {
+					continue
+				}
+				if r.ignoreSecrets || slices.Contains(r.namespacesToIgnore, secret.Namespace) {
+					continue
+				}
+				if err := r.reload(ctx, secret); err != nil && ctx.Err() == nil {
+					t.Errorf("fake reloader: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (r *fakeReloader) reload(ctx context.Context, secret *corev1.Secret) error {
+	hash := SecretHash(secret.Data)
+	apps := r.client.AppsV1()
+	deployments, err := apps.Deployments(secret.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		if r.apply(deployment.ObjectMeta, &deployment.Spec.Template, secret, hash) {
+			if _, err := apps.Deployments(secret.Namespace).Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+	statefulSets, err := apps.StatefulSets(secret.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range statefulSets.Items {
+		statefulSet := &statefulSets.Items[i]
+		if r.apply(statefulSet.ObjectMeta, &statefulSet.Spec.Template, secret, hash) {
+			if _, err := apps.StatefulSets(secret.Namespace).Update(ctx, statefulSet, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+	daemonSets, err := apps.DaemonSets(secret.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range daemonSets.Items {
+		daemonSet := &daemonSets.Items[i]
+		if r.apply(daemonSet.ObjectMeta, &daemonSet.Spec.Template, secret, hash) {
+			if _, err := apps.DaemonSets(secret.Namespace).Update(ctx, daemonSet, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// apply updates the pod template of a workload to be reloaded for the secret, returns false if it is not
+func (r *fakeReloader) apply(meta metav1.ObjectMeta, template *corev1.PodTemplateSpec, secret *corev1.Secret, hash string) bool {
+	reload := slices.Contains(strings.Split(meta.Annotations[SecretReloadAnnotation], ","), secret.Name)
+	if meta.Annotations[AutoAnnotation] == "true" {
+		for _, container := range template.Spec.Containers {
+			for _, env := range container.Env {
+				if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.Name == secret.Name {
+					reload = true
+				}
+			}
+		}
+	}
+	if !reload {
+		return false
+	}
+
+	if r.strategy == StrategyAnnotations {
+		source, _ := json.Marshal(reloadSource{Type: "SECRET", Name: secret.Name, Namespace: secret.Namespace, Hash: hash})
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[LastReloadedFromAnnotation] = string(source)
+		return true
+	}
+	container := &template.Spec.Containers[0]
+	name := EnvVarName(secret.Name)
+	for i := range container.Env {
+		if container.Env[i].Name == name {
+			container.Env[i].Value = hash
+			return true
+		}
+	}
+	container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: hash})
+	return true
+}
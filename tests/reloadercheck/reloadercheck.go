@@ -0,0 +1,636 @@
+// Package reloadercheck verifies the behaviour of the Reloader deployed by the module: the reload of the Deployments,
+// StatefulSets and DaemonSets consuming an updated secret with the env-vars or annotations reload strategy, and the
+// absence of reload for the ignored secrets and namespaces.
+// The checks create their secrets and workloads through a Kubernetes client and wait on watches of the workloads, so
+// they run against any API server: the cluster of the test or a local API server.
+package reloadercheck
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // hash of the Reloader, not used for security
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// Strategy is a reload strategy of the Reloader, as set by the reloader_reload_strategy input of the module
+type Strategy string
+
+const (
+	StrategyEnvVars     Strategy = "env-vars"
+	StrategyAnnotations Strategy = "annotations"
+)
+
+// Kind is a kind of workload reloaded by the Reloader
+type Kind string
+
+const (
+	KindDeployment  Kind = "Deployment"
+	KindStatefulSet Kind = "StatefulSet"
+	KindDaemonSet   Kind = "DaemonSet"
+)
+
+// Kinds are all the kinds of workload reloaded by the Reloader
+var Kinds = []Kind{KindDeployment, KindStatefulSet, KindDaemonSet}
+
+const (
+	// AutoAnnotation enables the reload of a workload on the update of any secret or config map it consumes
+	AutoAnnotation = "reloader.stakater.com/auto"
+	// SecretReloadAnnotation lists the secrets whose update reloads the workload, consumed or not
+	SecretReloadAnnotation = "secret.reloader.stakater.com/reload"
+	// LastReloadedFromAnnotation is set on the pod template by the annotations strategy
+	LastReloadedFromAnnotation = "reloader.stakater.com/last-reloaded-from"
+
+	// defaultSecretKey is the key of the secrets created by the checks
+	defaultSecretKey = "value"
+	// appLabel selects the pods of the workloads created by the checks
+	appLabel = "app"
+
+	// secretValueLogPrefix prefixes the value of the secret logged by the containers of the workloads
+	secretValueLogPrefix = "secret value: "
+
+	defaultTimeout     = 2 * time.Minute
+	defaultQuietPeriod = 30 * time.Second
+	defaultImage       = "busybox"
+)
+
+// Checker creates the secrets and workloads of the checks in a namespace
+type Checker struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// Strategy is the reload strategy expected from the Reloader
+	Strategy Strategy
+	// Timeout is the maximum time to wait for a reload or a rollout, 2 minutes if not set
+	Timeout time.Duration
+	// QuietPeriod is the time during which no reload must happen for an ignored update, 30 seconds if not set
+	QuietPeriod time.Duration
+	// Image is the image of the workloads containers, busybox if not set
+	Image string
+	// NodeSelector is the node selector of the workloads pods
+	NodeSelector map[string]string
+	// SecretKey is the key of the secrets consumed by the workloads, value if not set
+	SecretKey string
+	// CheckRollout waits for the workloads to be available after their creation and their reload, and for the reloaded
+	// pods to log the new value of the secret, which requires the pods to run: to be disabled against an API server
+	// without nodes
+	CheckRollout bool
+}
+
+// Evidence is the trace of the reloads for a secret in a pod template, for each strategy
+type Evidence struct {
+	// EnvVar is the value of the STAKATER_<secret>_SECRET environment variable set by the env-vars strategy
+	EnvVar string
+	// Annotation is the value of the last-reloaded-from annotation set by the annotations strategy for the secret
+	Annotation string
+}
+
+func (e Evidence) forStrategy(strategy Strategy) string {
+	if strategy == StrategyAnnotations {
+		return e.Annotation
+	}
+	return e.EnvVar
+}
+
+// Hash returns the hash of the secret data set by the reload with the strategy, empty if not reloaded
+func (e Evidence) Hash(strategy Strategy) string {
+	if strategy != StrategyAnnotations {
+		return e.EnvVar
+	}
+	var source reloadSource
+	if json.Unmarshal([]byte(e.Annotation), &source) != nil {
+		return ""
+	}
+	return source.Hash
+}
+
+// reloadSource is the content of the last-reloaded-from annotation
+type reloadSource struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Hash      string `json:"hash"`
+}
+
+// SecretHash returns the hash of the data of a secret set by the Reloader in the pod templates it reloads
+func SecretHash(data map[string][]byte) string {
+	values := make([]string, 0, len(data))
+	for key, value := range data {
+		values = append(values, key+"="+string(value))
+	}
+	sort.Strings(values)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(values, ";")))) //nolint:gosec // hash of the Reloader
+}
+
+// EnvVarName returns the name of the environment variable set by the env-vars strategy for a secret
+func EnvVarName(secretName string) string {
+	var name strings.Builder
+	lastCharValid := false
+	for _, char := range strings.ToUpper(secretName) {
+		if (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') {
+			name.WriteRune(char)
+			lastCharValid = true
+			continue
+		}
+		if lastCharValid {
+			name.WriteRune('_')
+		}
+		lastCharValid = false
+	}
+	return "STAKATER_" + name.String() + "_SECRET"
+}
+
+// PodTemplateEvidence returns the trace of the reloads for a secret in a pod template
+func PodTemplateEvidence(template *corev1.PodTemplateSpec, secretName string) Evidence {
+	var evidence Evidence
+	envVarName := EnvVarName(secretName)
+	for _, container := range template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == envVarName {
+				evidence.EnvVar = env.Value
+			}
+		}
+	}
+	if value, found := template.Annotations[LastReloadedFromAnnotation]; found {
+		var source reloadSource
+		if json.Unmarshal([]byte(value), &source) == nil && strings.EqualFold(source.Type, "SECRET") && source.Name == secretName {
+			evidence.Annotation = value
+		}
+	}
+	return evidence
+}
+
+// Reload is an observed reload of a workload
+type Reload struct {
+	Kind     Kind
+	Name     string
+	Evidence Evidence
+	// Duration is the time between the secret update and the reload
+	Duration time.Duration
+}
+
+func (c *Checker) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return defaultTimeout
+}
+
+func (c *Checker) secretKey() string {
+	if c.SecretKey != "" {
+		return c.SecretKey
+	}
+	return defaultSecretKey
+}
+
+func (c *Checker) quietPeriod() time.Duration {
+	if c.QuietPeriod > 0 {
+		return c.QuietPeriod
+	}
+	return defaultQuietPeriod
+}
+
+// EnsureNamespace creates the namespace of the checker if it doesn't exist
+func (c *Checker) EnsureNamespace(ctx context.Context) error {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: c.Namespace}}
+	_, err := c.Client.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating namespace %s: %w", c.Namespace, err)
+	}
+	return nil
+}
+
+// DeleteNamespace deletes the namespace of the checker and all the secrets and workloads created in it
+func (c *Checker) DeleteNamespace(ctx context.Context) error {
+	err := c.Client.CoreV1().Namespaces().Delete(ctx, c.Namespace, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("deleting namespace %s: %w", c.Namespace, err)
+	}
+	return nil
+}
+
+// CreateSecret creates an opaque secret with a single value
+func (c *Checker) CreateSecret(ctx context.Context, name string, value string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: c.Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{c.secretKey(): []byte(value)},
+	}
+	if _, err := c.Client.CoreV1().Secrets(c.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("creating secret %s/%s: %w", c.Namespace, name, err)
+	}
+	return nil
+}
+
+// UpdateSecret updates the value of a secret created by CreateSecret
+func (c *Checker) UpdateSecret(ctx context.Context, name string, value string) error {
+	secret, err := c.Client.CoreV1().Secrets(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("getting secret %s/%s: %w", c.Namespace, name, err)
+	}
+	secret.Data = map[string][]byte{c.secretKey(): []byte(value)}
+	if _, err := c.Client.CoreV1().Secrets(c.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("updating secret %s/%s: %w", c.Namespace, name, err)
+	}
+	return nil
+}
+
+// CreateWorkload creates a workload whose container consumes the secret as an environment variable, the secret being
+// optional to allow its creation after the workload
+func (c *Checker) CreateWorkload(ctx context.Context, kind Kind, name string, secretName string, annotations map[string]string) error {
+	labels := map[string]string{appLabel: name}
+	meta := metav1.ObjectMeta{Name: name, Namespace: c.Namespace, Labels: labels, Annotations: annotations}
+	selector := &metav1.LabelSelector{MatchLabels: labels}
+	template := c.podTemplate(labels, secretName)
+
+	var err error
+	switch kind {
+	case KindDeployment:
+		_, err = c.Client.AppsV1().Deployments(c.Namespace).Create(ctx, &appsv1.Deployment{
+			ObjectMeta: meta,
+			Spec:       appsv1.DeploymentSpec{Replicas: replicas(1), Selector: selector, Template: template},
+		}, metav1.CreateOptions{})
+	case KindStatefulSet:
+		_, err = c.Client.AppsV1().StatefulSets(c.Namespace).Create(ctx, &appsv1.StatefulSet{
+			ObjectMeta: meta,
+			Spec:       appsv1.StatefulSetSpec{Replicas: replicas(1), Selector: selector, Template: template, ServiceName: name},
+		}, metav1.CreateOptions{})
+	case KindDaemonSet:
+		_, err = c.Client.AppsV1().DaemonSets(c.Namespace).Create(ctx, &appsv1.DaemonSet{
+			ObjectMeta: meta,
+			Spec:       appsv1.DaemonSetSpec{Selector: selector, Template: template},
+		}, metav1.CreateOptions{})
+	default:
+		return fmt.Errorf("unknown workload kind %q", kind)
+	}
+	if err != nil {
+		return fmt.Errorf("creating %s %s/%s: %w", kind, c.Namespace, name, err)
+	}
+	return nil
+}
+
+func (c *Checker) podTemplate(labels map[string]string, secretName string) corev1.PodTemplateSpec {
+	image := c.Image
+	if image == "" {
+		image = defaultImage
+	}
+	optional := true
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Spec: corev1.PodSpec{
+			NodeSelector: c.NodeSelector,
+			Containers: []corev1.Container{{
+				Name:    "app",
+				Image:   image,
+				Command: []string{"/bin/sh"},
+				// the value of the secret seen by the container is logged, to check the one of the reloaded pods
+				Args: []string{"-c", "while true; do echo \"" + secretValueLogPrefix + "$MY_SECRET\"; sleep 5; done"},
+				Env: []corev1.EnvVar{{
+					Name: "MY_SECRET",
+					ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+						Key:                  c.secretKey(),
+						Optional:             &optional,
+					}},
+				}},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi"), corev1.ResourceCPU: resource.MustParse("50m")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi"), corev1.ResourceCPU: resource.MustParse("100m")},
+				},
+			}},
+		},
+	}
+}
+
+func replicas(count int32) *int32 {
+	return &count
+}
+
+// listWatch returns the list and watch of a single workload, with the streaming lists disabled for the clients not
+// supporting them
+func (c *Checker) listWatch(kind Kind, name string) (cache.ListerWatcher, runtime.Object, error) {
+	lw, objectType, err := c.workloadListWatch(kind, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cache.ToListWatcherWithWatchListSemantics(lw, c.Client), objectType, nil
+}
+
+func (c *Checker) workloadListWatch(kind Kind, name string) (*cache.ListWatch, runtime.Object, error) {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	withSelector := func(options metav1.ListOptions) metav1.ListOptions {
+		options.FieldSelector = selector
+		return options
+	}
+	apps := c.Client.AppsV1()
+	switch kind {
+	case KindDeployment:
+		return &cache.ListWatch{
+			ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+				return apps.Deployments(c.Namespace).List(ctx, withSelector(options))
+			},
+			WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+				return apps.Deployments(c.Namespace).Watch(ctx, withSelector(options))
+			},
+		}, &appsv1.Deployment{}, nil
+	case KindStatefulSet:
+		return &cache.ListWatch{
+			ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+				return apps.StatefulSets(c.Namespace).List(ctx, withSelector(options))
+			},
+			WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+				return apps.StatefulSets(c.Namespace).Watch(ctx, withSelector(options))
+			},
+		}, &appsv1.StatefulSet{}, nil
+	case KindDaemonSet:
+		return &cache.ListWatch{
+			ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+				return apps.DaemonSets(c.Namespace).List(ctx, withSelector(options))
+			},
+			WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+				return apps.DaemonSets(c.Namespace).Watch(ctx, withSelector(options))
+			},
+		}, &appsv1.DaemonSet{}, nil
+	}
+	return nil, nil, fmt.Errorf("unknown workload kind %q", kind)
+}
+
+// workloadTemplate returns the metadata and pod template of a workload
+func workloadTemplate(object runtime.Object) (metav1.Object, *corev1.PodTemplateSpec, bool) {
+	switch workload := object.(type) {
+	case *appsv1.Deployment:
+		return workload, &workload.Spec.Template, true
+	case *appsv1.StatefulSet:
+		return workload, &workload.Spec.Template, true
+	case *appsv1.DaemonSet:
+		return workload, &workload.Spec.Template, true
+	}
+	return nil, nil, false
+}
+
+// RolloutComplete returns true if all the pods of the workload run its current pod template and are available
+func RolloutComplete(object runtime.Object) bool {
+	switch workload := object.(type) {
+	case *appsv1.Deployment:
+		expected := int32(1)
+		if workload.Spec.Replicas != nil {
+			expected = *workload.Spec.Replicas
+		}
+		status := workload.Status
+		return status.ObservedGeneration >= workload.Generation && status.UpdatedReplicas == expected &&
+			status.Replicas == expected && status.AvailableReplicas == expected
+	case *appsv1.StatefulSet:
+		expected := int32(1)
+		if workload.Spec.Replicas != nil {
+			expected = *workload.Spec.Replicas
+		}
+		status := workload.Status
+		return status.ObservedGeneration >= workload.Generation && status.UpdatedReplicas == expected &&
+			status.ReadyReplicas == expected && status.CurrentRevision == status.UpdateRevision
+	case *appsv1.DaemonSet:
+		status := workload.Status
+		return status.ObservedGeneration >= workload.Generation && status.DesiredNumberScheduled > 0 &&
+			status.UpdatedNumberScheduled == status.DesiredNumberScheduled && status.NumberAvailable == status.DesiredNumberScheduled
+	}
+	return false
+}
+
+// watchWorkload watches a workload until the condition on it is met, the context is done or the timeout expires
+func (c *Checker) watchWorkload(ctx context.Context, kind Kind, name string, timeout time.Duration, condition func(object runtime.Object) (bool, error)) error {
+	lw, objectType, err := c.listWatch(kind, name)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, err = watchtools.UntilWithSync(ctx, lw, objectType, nil, func(event watch.Event) (bool, error) {
+		if event.Type != watch.Added && event.Type != watch.Modified {
+			return false, nil
+		}
+		// the field selector is not supported by all the API servers
+		if meta, _, ok := workloadTemplate(event.Object); !ok || meta.GetName() != name {
+			return false, nil
+		}
+		return condition(event.Object)
+	})
+	return err
+}
+
+// GetEvidence returns the trace of the reloads for a secret in the pod template of a workload
+func (c *Checker) GetEvidence(ctx context.Context, kind Kind, name string, secretName string) (Evidence, error) {
+	var object runtime.Object
+	var err error
+	switch kind {
+	case KindDeployment:
+		object, err = c.Client.AppsV1().Deployments(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	case KindStatefulSet:
+		object, err = c.Client.AppsV1().StatefulSets(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	case KindDaemonSet:
+		object, err = c.Client.AppsV1().DaemonSets(c.Namespace).Get(ctx, name, metav1.GetOptions{})
+	default:
+		return Evidence{}, fmt.Errorf("unknown workload kind %q", kind)
+	}
+	if err != nil {
+		return Evidence{}, fmt.Errorf("getting %s %s/%s: %w", kind, c.Namespace, name, err)
+	}
+	_, template, _ := workloadTemplate(object)
+	return PodTemplateEvidence(template, secretName), nil
+}
+
+// WaitForReload waits for the reload of a workload for a secret with the strategy of the checker, a reload being a
+// change of the evidence from the previous one. A reload with the other strategy is an error.
+func (c *Checker) WaitForReload(ctx context.Context, kind Kind, name string, secretName string, previous Evidence) (Evidence, error) {
+	var current Evidence
+	err := c.watchWorkload(ctx, kind, name, c.timeout(), func(object runtime.Object) (bool, error) {
+		_, template, _ := workloadTemplate(object)
+		current = PodTemplateEvidence(template, secretName)
+		if current.forStrategy(c.Strategy) != previous.forStrategy(c.Strategy) {
+			return true, nil
+		}
+		if current != previous {
+			return false, fmt.Errorf("%s %s/%s reloaded for secret %s with a strategy other than %s: %+v", kind, c.Namespace, name, secretName, c.Strategy, current)
+		}
+		return false, nil
+	})
+	if wait.Interrupted(err) {
+		return current, fmt.Errorf("%s %s/%s not reloaded with strategy %s for secret %s after %s", kind, c.Namespace, name, c.Strategy, secretName, c.timeout())
+	}
+	return current, err
+}
+
+// ExpectNoReload watches a workload during the quiet period of the checker and returns an error if it is reloaded
+// for the secret, with any strategy
+func (c *Checker) ExpectNoReload(ctx context.Context, kind Kind, name string, secretName string, previous Evidence) error {
+	err := c.watchWorkload(ctx, kind, name, c.quietPeriod(), func(object runtime.Object) (bool, error) {
+		_, template, _ := workloadTemplate(object)
+		if current := PodTemplateEvidence(template, secretName); current != previous {
+			return false, fmt.Errorf("%s %s/%s unexpectedly reloaded for secret %s: %+v", kind, c.Namespace, name, secretName, current)
+		}
+		return false, nil
+	})
+	if wait.Interrupted(err) {
+		return nil
+	}
+	return err
+}
+
+// WaitForRollout waits for the pods of a workload to run its current pod template
+func (c *Checker) WaitForRollout(ctx context.Context, kind Kind, name string) error {
+	err := c.watchWorkload(ctx, kind, name, c.timeout(), func(object runtime.Object) (bool, error) {
+		return RolloutComplete(object), nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("rollout of %s %s/%s not complete after %s", kind, c.Namespace, name, c.timeout())
+	}
+	return err
+}
+
+// deploy creates the workload, waiting for its rollout if enabled, and returns its initial evidence
+func (c *Checker) deploy(ctx context.Context, kind Kind, name string, secretName string, annotations map[string]string) (Evidence, error) {
+	if err := c.CreateWorkload(ctx, kind, name, secretName, annotations); err != nil {
+		return Evidence{}, err
+	}
+	if c.CheckRollout {
+		if err := c.WaitForRollout(ctx, kind, name); err != nil {
+			return Evidence{}, err
+		}
+	}
+	return c.GetEvidence(ctx, kind, name, secretName)
+}
+
+// reloaded waits for the reload of the workload, and for its rollout if enabled
+func (c *Checker) reloaded(ctx context.Context, kind Kind, name string, secretName string, previous Evidence, start time.Time) (Reload, error) {
+	evidence, err := c.WaitForReload(ctx, kind, name, secretName, previous)
+	if err != nil {
+		return Reload{}, err
+	}
+	reload := Reload{Kind: kind, Name: name, Evidence: evidence, Duration: time.Since(start)}
+	if c.CheckRollout {
+		if err := c.WaitForRollout(ctx, kind, name); err != nil {
+			return reload, err
+		}
+	}
+	return reload, nil
+}
+
+// LoggedSecretValue returns the last value of the secret logged by a container of the workloads, false if not logged
+func LoggedSecretValue(logs string) (string, bool) {
+	lines := strings.Split(strings.TrimRight(logs, "\n"), "\n")
+	for index := len(lines) - 1; index >= 0; index-- {
+		if value, found := strings.CutPrefix(lines[index], secretValueLogPrefix); found {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// WaitForPodsValue waits for all the running pods of the workload to log the value of the secret, which requires the
+// pods to run
+func (c *Checker) WaitForPodsValue(ctx context.Context, name string, value string) error {
+	pods := c.Client.CoreV1().Pods(c.Namespace)
+	var mismatch string
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, c.timeout(), true, func(ctx context.Context) (bool, error) {
+		list, err := pods.List(ctx, metav1.ListOptions{LabelSelector: appLabel + "=" + name})
+		if err != nil {
+			return false, fmt.Errorf("listing pods of %s/%s: %w", c.Namespace, name, err)
+		}
+		running := 0
+		for _, pod := range list.Items {
+			// the pods replaced by the reload are ignored
+			if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+				continue
+			}
+			running++
+			logs, err := pods.GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+			if err != nil {
+				mismatch = fmt.Sprintf("logs of pod %s not available: %v", pod.Name, err)
+				return false, nil
+			}
+			if logged, _ := LoggedSecretValue(string(logs)); logged != value {
+				mismatch = fmt.Sprintf("pod %s logs the secret value %q", pod.Name, logged)
+				return false, nil
+			}
+		}
+		mismatch = "no running pod"
+		return running > 0, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("pods of %s/%s not logging the secret value %q after %s: %s", c.Namespace, name, value, c.timeout(), mismatch)
+	}
+	return err
+}
+
+// reloadedWithValue waits for the reload of the workload consuming the secret of the same name and, if the rollout is
+// checked, for its pods to see the value of the secret
+func (c *Checker) reloadedWithValue(ctx context.Context, kind Kind, name string, previous Evidence, start time.Time, value string) (Reload, error) {
+	reload, err := c.reloaded(ctx, kind, name, name, previous, start)
+	if err != nil || !c.CheckRollout {
+		return reload, err
+	}
+	return reload, c.WaitForPodsValue(ctx, name, value)
+}
+
+// VerifyReload creates a secret and a workload with the auto annotation consuming it, updates the secret and waits
+// for the reload of the workload with the strategy of the checker
+func (c *Checker) VerifyReload(ctx context.Context, kind Kind, name string) (Reload, error) {
+	if err := c.CreateSecret(ctx, name, "initial"); err != nil {
+		return Reload{}, err
+	}
+	previous, err := c.deploy(ctx, kind, name, name, map[string]string{AutoAnnotation: "true"})
+	if err != nil {
+		return Reload{}, err
+	}
+	start := time.Now()
+	if err := c.UpdateSecret(ctx, name, "updated"); err != nil {
+		return Reload{}, err
+	}
+	return c.reloadedWithValue(ctx, kind, name, previous, start, "updated")
+}
+
+// VerifyNoReload creates a secret and a workload with the auto annotation consuming it, updates the secret and checks
+// that the workload is not reloaded during the quiet period, as expected for an ignored secret or namespace
+func (c *Checker) VerifyNoReload(ctx context.Context, kind Kind, name string) error {
+	if err := c.CreateSecret(ctx, name, "initial"); err != nil {
+		return err
+	}
+	previous, err := c.deploy(ctx, kind, name, name, map[string]string{AutoAnnotation: "true"})
+	if err != nil {
+		return err
+	}
+	if err := c.UpdateSecret(ctx, name, "updated"); err != nil {
+		return err
+	}
+	return c.ExpectNoReload(ctx, kind, name, name, previous)
+}
+
+// VerifyReloadOnCreate creates a workload annotated to be reloaded for a secret which doesn't exist yet, creates the
+// secret and waits for the reload of the workload, as expected with reloader_reload_on_create
+func (c *Checker) VerifyReloadOnCreate(ctx context.Context, kind Kind, name string) (Reload, error) {
+	previous, err := c.deploy(ctx, kind, name, name, map[string]string{SecretReloadAnnotation: name})
+	if err != nil {
+		return Reload{}, err
+	}
+	if previous != (Evidence{}) {
+		return Reload{}, errors.New("workload reloaded before the creation of the secret")
+	}
+	start := time.Now()
+	if err := c.CreateSecret(ctx, name, "created"); err != nil {
+		return Reload{}, err
+	}
+	return c.reloadedWithValue(ctx, kind, name, previous, start, "created")
+}
@@ -0,0 +1,255 @@
+// Tests in this file are run in the PR pipeline
+package reloadercheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newChecker returns a checker on a local API server with a fake reloader
+func newChecker(t *testing.T, reloader *fakeReloader, namespace string) *Checker {
+	client := fake.NewClientset()
+	reloader.client = client
+	reloader.start(t)
+	checker := &Checker{
+		Client:      client,
+		Namespace:   namespace,
+		Strategy:    reloader.strategy,
+		Timeout:     5 * time.Second,
+		QuietPeriod: 500 * time.Millisecond,
+	}
+	require.NoError(t, checker.EnsureNamespace(context.Background()))
+	return checker
+}
+
+func TestSecretHash(t *testing.T) {
+	t.Parallel()
+
+	// sha1 of "a=1;b=2"
+	assert.Equal(t, "f83e99e324ba68ccc373a58ef1eb42f8ab88646a", SecretHash(map[string][]byte{"b": []byte("2"), "a": []byte("1")}))
+}
+
+func TestEnvVarName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "STAKATER_EXAMPLE_SECRET_SECRET", EnvVarName("example-secret"))
+	assert.Equal(t, "STAKATER_MY_APP_V2_SECRET", EnvVarName("my.app--v2"))
+}
+
+func TestLoggedSecretValue(t *testing.T) {
+	t.Parallel()
+
+	value, found := LoggedSecretValue("secret value: initial\nsecret value: updated\n")
+	assert.True(t, found)
+	assert.Equal(t, "updated", value)
+
+	// the optional secret not created yet is logged as an empty value
+	value, found = LoggedSecretValue("secret value: \n")
+	assert.True(t, found)
+	assert.Empty(t, value)
+
+	_, found = LoggedSecretValue("starting\n")
+	assert.False(t, found)
+}
+
+func TestVerifyReload(t *testing.T) {
+	t.Parallel()
+
+	for _, strategy := range []Strategy{StrategyEnvVars, StrategyAnnotations} {
+		for _, kind := range Kinds {
+			t.Run(fmt.Sprintf("%s-%s", strategy, kind), func(t *testing.T) {
+				t.Parallel()
+
+				checker := newChecker(t, &fakeReloader{strategy: strategy}, "reloader-test-ns")
+				name := strings.ToLower(string(kind))
+				reload, err := checker.VerifyReload(context.Background(), kind, name)
+				require.NoError(t, err)
+				assert.Equal(t, kind, reload.Kind)
+				assert.NotEmpty(t, reload.Evidence.forStrategy(strategy))
+				assert.Equal(t, Evidence{}, reload.Evidence.without(strategy), "only the expected strategy is applied")
+				assert.Equal(t, SecretHash(map[string][]byte{"value": []byte("updated")}), reload.Evidence.Hash(strategy))
+
+				// a second update is a second reload
+				previous := reload.Evidence
+				require.NoError(t, checker.UpdateSecret(context.Background(), name, "updated-again"))
+				evidence, err := checker.WaitForReload(context.Background(), kind, name, name, previous)
+				require.NoError(t, err)
+				assert.NotEqual(t, previous, evidence)
+			})
+		}
+	}
+}
+
+// without clears the evidence of a strategy
+func (e Evidence) without(strategy Strategy) Evidence {
+	if strategy == StrategyAnnotations {
+		e.Annotation = ""
+	} else {
+		e.EnvVar = ""
+	}
+	return e
+}
+
+func TestVerifyReloadWithOtherStrategy(t *testing.T) {
+	t.Parallel()
+
+	checker := newChecker(t, &fakeReloader{strategy: StrategyAnnotations}, "reloader-test-ns")
+	checker.Strategy = StrategyEnvVars
+	_, err := checker.VerifyReload(context.Background(), KindDeployment, "deployment")
+	assert.ErrorContains(t, err, "reloaded for secret deployment with a strategy other than env-vars")
+}
+
+func TestVerifyNoReload(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ignore-secrets", func(t *testing.T) {
+		t.Parallel()
+
+		checker := newChecker(t, &fakeReloader{strategy: StrategyEnvVars, ignoreSecrets: true}, "reloader-test-ns")
+		for _, kind := range Kinds {
+			assert.NoError(t, checker.VerifyNoReload(context.Background(), kind, strings.ToLower(string(kind))))
+		}
+		_, err := checker.VerifyReload(context.Background(), KindDeployment, "not-reloaded")
+		assert.ErrorContains(t, err, "Deployment reloader-test-ns/not-reloaded not reloaded with strategy env-vars for secret not-reloaded")
+	})
+
+	t.Run("namespaces-to-ignore", func(t *testing.T) {
+		t.Parallel()
+
+		reloader := &fakeReloader{strategy: StrategyAnnotations, namespacesToIgnore: []string{"ignored-ns"}}
+		checker := newChecker(t, reloader, "ignored-ns")
+		for _, kind := range Kinds {
+			assert.NoError(t, checker.VerifyNoReload(context.Background(), kind, strings.ToLower(string(kind))))
+		}
+
+		// the workloads of the other namespaces are still reloaded
+		other := *checker
+		other.Namespace = "watched-ns"
+		require.NoError(t, other.EnsureNamespace(context.Background()))
+		_, err := other.VerifyReload(context.Background(), KindDeployment, "deployment")
+		assert.NoError(t, err)
+	})
+
+	t.Run("reloaded", func(t *testing.T) {
+		t.Parallel()
+
+		checker := newChecker(t, &fakeReloader{strategy: StrategyAnnotations}, "reloader-test-ns")
+		err := checker.VerifyNoReload(context.Background(), KindDaemonSet, "daemonset")
+		assert.ErrorContains(t, err, "DaemonSet reloader-test-ns/daemonset unexpectedly reloaded for secret daemonset")
+	})
+}
+
+func TestVerifyReloadOnCreate(t *testing.T) {
+	t.Parallel()
+
+	for _, kind := range Kinds {
+		t.Run(string(kind), func(t *testing.T) {
+			t.Parallel()
+
+			checker := newChecker(t, &fakeReloader{strategy: StrategyEnvVars, reloadOnCreate: true}, "reloader-test-ns")
+			reload, err := checker.VerifyReloadOnCreate(context.Background(), kind, strings.ToLower(string(kind)))
+			require.NoError(t, err)
+			assert.NotEmpty(t, reload.Evidence.EnvVar)
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		checker := newChecker(t, &fakeReloader{strategy: StrategyEnvVars}, "reloader-test-ns")
+		checker.Timeout = checker.QuietPeriod
+		_, err := checker.VerifyReloadOnCreate(context.Background(), KindStatefulSet, "statefulset")
+		assert.ErrorContains(t, err, "not reloaded with strategy env-vars")
+	})
+}
+
+func TestWaitForRollout(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewClientset()
+	checker := &Checker{Client: client, Namespace: "reloader-test-ns", Strategy: StrategyEnvVars, Timeout: 5 * time.Second}
+	ctx := context.Background()
+	require.NoError(t, checker.CreateWorkload(ctx, KindDeployment, "deployment", "secret", nil))
+
+	// the deployment controller of the local API server
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		deployment, err := client.AppsV1().Deployments(checker.Namespace).Get(ctx, "deployment", metav1.GetOptions{})
+		if err != nil {
+			return
+		}
+		deployment.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+		_, _ = client.AppsV1().Deployments(checker.Namespace).UpdateStatus(ctx, deployment, metav1.UpdateOptions{})
+	}()
+	assert.NoError(t, checker.WaitForRollout(ctx, KindDeployment, "deployment"))
+
+	require.NoError(t, checker.CreateWorkload(ctx, KindDaemonSet, "daemonset", "secret", nil))
+	checker.Timeout = 200 * time.Millisecond
+	assert.ErrorContains(t, checker.WaitForRollout(ctx, KindDaemonSet, "daemonset"), "rollout of DaemonSet reloader-test-ns/daemonset not complete")
+}
+
+func TestRolloutComplete(t *testing.T) {
+	t.Parallel()
+
+	generation := metav1.ObjectMeta{Generation: 2}
+	testCases := []struct {
+		name     string
+		workload runtime.Object
+		complete bool
+	}{
+		{
+			name: "deployment-available",
+			workload: &appsv1.Deployment{ObjectMeta: generation, Spec: appsv1.DeploymentSpec{Replicas: replicas(2)},
+				Status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}},
+			complete: true,
+		},
+		{
+			name: "deployment-old-pod",
+			workload: &appsv1.Deployment{ObjectMeta: generation, Spec: appsv1.DeploymentSpec{Replicas: replicas(2)},
+				Status: appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2}},
+		},
+		{
+			name: "deployment-not-observed",
+			workload: &appsv1.Deployment{ObjectMeta: generation, Spec: appsv1.DeploymentSpec{Replicas: replicas(1)},
+				Status: appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}},
+		},
+		{
+			name: "statefulset-updated",
+			workload: &appsv1.StatefulSet{ObjectMeta: generation, Spec: appsv1.StatefulSetSpec{Replicas: replicas(1)},
+				Status: appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdatedReplicas: 1, ReadyReplicas: 1, CurrentRevision: "r2", UpdateRevision: "r2"}},
+			complete: true,
+		},
+		{
+			name: "statefulset-updating",
+			workload: &appsv1.StatefulSet{ObjectMeta: generation, Spec: appsv1.StatefulSetSpec{Replicas: replicas(1)},
+				Status: appsv1.StatefulSetStatus{ObservedGeneration: 2, UpdatedReplicas: 1, ReadyReplicas: 1, CurrentRevision: "r1", UpdateRevision: "r2"}},
+		},
+		{
+			name: "daemonset-available",
+			workload: &appsv1.DaemonSet{ObjectMeta: generation,
+				Status: appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3}},
+			complete: true,
+		},
+		{
+			name: "daemonset-no-node",
+			workload: &appsv1.DaemonSet{ObjectMeta: generation,
+				Status: appsv1.DaemonSetStatus{ObservedGeneration: 2}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.complete, RolloutComplete(tc.workload))
+		})
+	}
+}
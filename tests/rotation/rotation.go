@@ -0,0 +1,240 @@
+// Package rotation runs the end to end rotation of a secret consumed by a workload: the rotation of the value in
+// Secrets Manager, the refresh by ESO of the Kubernetes secret generated by eso-external-secret and the reload and
+// rollout by the Reloader of the deployment annotated to be reloaded, reporting the duration of each stage.
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/reloadercheck"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// ExternalSecretResource is the resource of the ExternalSecrets created by eso-external-secret
+var ExternalSecretResource = schema.GroupVersionResource{Group: "external-secrets.io", Version: "v1", Resource: "externalsecrets"}
+
+const (
+	// ForceSyncAnnotation is the annotation of an ExternalSecret whose update forces its refresh by ESO
+	ForceSyncAnnotation = "force-sync"
+
+	// the stages of the rotation
+	StageRotate  = "rotate"
+	StageRefresh = "eso-refresh"
+	StageReload  = "reload"
+	StageRollout = "rollout"
+
+	defaultTimeout = 2 * time.Minute
+)
+
+// Rotator rotates the value of a Secrets Manager secret, implemented by SecretsManager and the Secrets Manager stand-in
+type Rotator interface {
+	Rotate(ctx context.Context, id string, value string) error
+}
+
+// Scenario is the rotation of the Secrets Manager secret synced by an ExternalSecret, consumed by a deployment
+type Scenario struct {
+	Dynamic dynamic.Interface
+	Source  Rotator
+	// SecretID is the ID of the Secrets Manager secret
+	SecretID string
+	// ExternalSecret is the name of the ExternalSecret and of the secret it generates
+	ExternalSecret string
+	// Checker creates and watches the deployment in the namespace of the ExternalSecret, its SecretKey being the data
+	// key of the generated secret (es_kubernetes_secret_data_key)
+	Checker *reloadercheck.Checker
+	// Deployment is the name of the deployment created by the scenario
+	Deployment string
+	// WorkloadAnnotations are the annotations of the deployment, the reloader_workload_annotations output of
+	// eso-external-secret, the auto annotation if empty
+	WorkloadAnnotations map[string]string
+	// Timeout is the maximum time to wait for the refresh of the secret, 2 minutes if not set
+	Timeout time.Duration
+}
+
+// Stage is a completed stage of the rotation
+type Stage struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Report is the duration of the completed stages of the rotation
+type Report struct {
+	Stages []Stage
+}
+
+// Total returns the duration of all the completed stages
+func (r Report) Total() time.Duration {
+	var total time.Duration
+	for _, stage := range r.Stages {
+		total += stage.Duration
+	}
+	return total
+}
+
+func (r Report) String() string {
+	stages := make([]string, 0, len(r.Stages))
+	for _, stage := range r.Stages {
+		stages = append(stages, fmt.Sprintf("%s %s", stage.Name, stage.Duration))
+	}
+	return fmt.Sprintf("%s (total %s)", strings.Join(stages, ", "), r.Total())
+}
+
+func (s *Scenario) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return defaultTimeout
+}
+
+// Run creates the deployment consuming the secret generated by the ExternalSecret, rotates the value of the Secrets
+// Manager secret, forces the refresh of the ExternalSecret and waits for the reload of the deployment with the hash of
+// the rotated secret, and for its rollout if enabled in the checker. The report contains the stages completed before
+// an error.
+func (s *Scenario) Run(ctx context.Context, value string) (Report, error) {
+	var report Report
+	checker := s.Checker
+	if checker.SecretKey == "" {
+		return report, fmt.Errorf("the data key of secret %s/%s is required as SecretKey of the checker", checker.Namespace, s.ExternalSecret)
+	}
+
+	if _, err := s.waitForSecret(ctx, func(*corev1.Secret) bool { return true }); err != nil {
+		return report, fmt.Errorf("initial sync of secret %s/%s: %w", checker.Namespace, s.ExternalSecret, err)
+	}
+	annotations := s.WorkloadAnnotations
+	if len(annotations) == 0 {
+		annotations = map[string]string{reloadercheck.AutoAnnotation: "true"}
+	}
+	if err := checker.CreateWorkload(ctx, reloadercheck.KindDeployment, s.Deployment, s.ExternalSecret, annotations); err != nil {
+		return report, err
+	}
+	if checker.CheckRollout {
+		if err := checker.WaitForRollout(ctx, reloadercheck.KindDeployment, s.Deployment); err != nil {
+			return report, err
+		}
+	}
+	previous, err := checker.GetEvidence(ctx, reloadercheck.KindDeployment, s.Deployment, s.ExternalSecret)
+	if err != nil {
+		return report, err
+	}
+
+	stage := func(name string, run func() error) error {
+		start := time.Now()
+		if err := run(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		report.Stages = append(report.Stages, Stage{Name: name, Duration: time.Since(start)})
+		return nil
+	}
+
+	if err := stage(StageRotate, func() error {
+		return s.Source.Rotate(ctx, s.SecretID, value)
+	}); err != nil {
+		return report, err
+	}
+
+	var secret *corev1.Secret
+	if err := stage(StageRefresh, func() error {
+		if err := s.forceSync(ctx); err != nil {
+			return err
+		}
+		secret, err = s.waitForSecret(ctx, func(secret *corev1.Secret) bool {
+			return string(secret.Data[checker.SecretKey]) == value
+		})
+		if err != nil {
+			return fmt.Errorf("secret %s/%s not refreshed with the rotated value: %w", checker.Namespace, s.ExternalSecret, err)
+		}
+		// set by eso-external-secret with reloader_watching
+		if secret.Annotations[reloadercheck.AutoAnnotation] != "true" {
+			return fmt.Errorf("secret %s/%s not annotated with %s", checker.Namespace, s.ExternalSecret, reloadercheck.AutoAnnotation)
+		}
+		return nil
+	}); err != nil {
+		return report, err
+	}
+
+	if err := stage(StageReload, func() error {
+		evidence, err := checker.WaitForReload(ctx, reloadercheck.KindDeployment, s.Deployment, s.ExternalSecret, previous)
+		if err != nil {
+			return err
+		}
+		if hash, expected := evidence.Hash(checker.Strategy), reloadercheck.SecretHash(secret.Data); hash != expected {
+			return fmt.Errorf("deployment %s/%s reloaded with the hash %s instead of the hash %s of the rotated secret", checker.Namespace, s.Deployment, hash, expected)
+		}
+		return nil
+	}); err != nil {
+		return report, err
+	}
+
+	if checker.CheckRollout {
+		if err := stage(StageRollout, func() error {
+			return checker.WaitForRollout(ctx, reloadercheck.KindDeployment, s.Deployment)
+		}); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// forceSync updates the force-sync annotation of the ExternalSecret
+func (s *Scenario) forceSync(ctx context.Context) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{ForceSyncAnnotation: strconv.FormatInt(time.Now().UnixNano(), 10)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.Dynamic.Resource(ExternalSecretResource).Namespace(s.Checker.Namespace).Patch(ctx, s.ExternalSecret, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("forcing the refresh of ExternalSecret %s/%s: %w", s.Checker.Namespace, s.ExternalSecret, err)
+	}
+	return nil
+}
+
+// waitForSecret watches the secret generated by the ExternalSecret until the condition on it is met
+func (s *Scenario) waitForSecret(ctx context.Context, condition func(secret *corev1.Secret) bool) (*corev1.Secret, error) {
+	secrets := s.Checker.Client.CoreV1().Secrets(s.Checker.Namespace)
+	selector := fields.OneTermEqualSelector("metadata.name", s.ExternalSecret).String()
+	lw := &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return secrets.List(ctx, options)
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return secrets.Watch(ctx, options)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+	var found *corev1.Secret
+	_, err := watchtools.UntilWithSync(ctx, cache.ToListWatcherWithWatchListSemantics(lw, s.Checker.Client), &corev1.Secret{}, nil, func(event watch.Event) (bool, error) {
+		secret, ok := event.Object.(*corev1.Secret)
+		if !ok || secret.Name != s.ExternalSecret || (event.Type != watch.Added && event.Type != watch.Modified) {
+			return false, nil
+		}
+		found = secret
+		return condition(secret), nil
+	})
+	if wait.Interrupted(err) {
+		return found, fmt.Errorf("timed out after %s", s.timeout())
+	}
+	return found, err
+}
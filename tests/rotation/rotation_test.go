@@ -0,0 +1,417 @@
+// Tests in this file are run in the PR pipeline
+package rotation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/reloadercheck"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/smstandin"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	namespace = "rotation-ns"
+	secretID  = "arbitrary-secret-id"
+	dataKey   = "apikey"
+)
+
+// renderedExternalSecret is an ExternalSecret rendered by eso-external-secret with the annotations of the workloads
+// consuming its secret
+type renderedExternalSecret struct {
+	object              *unstructured.Unstructured
+	workloadAnnotations map[string]string
+}
+
+var (
+	renderOnce      sync.Once
+	rendered        map[string]renderedExternalSecret
+	renderErr       error
+	errNoTerraform  = errors.New("terraform not found in PATH")
+	externalSecrets = []string{"watched", "unwatched"}
+)
+
+// renderExternalSecrets plans the external-secret fixture, rendering with eso-external-secret the ExternalSecrets of
+// an arbitrary secret synced to an opaque secret, with and without reloader_watching, and returns them by key. The
+// test is skipped if terraform is not installed.
+func renderExternalSecrets(t *testing.T) map[string]renderedExternalSecret {
+	renderOnce.Do(func() {
+		if _, err := exec.LookPath("terraform"); err != nil {
+			renderErr = errNoTerraform
+			return
+		}
+		rendered, renderErr = planExternalSecrets(t)
+	})
+	if errors.Is(renderErr, errNoTerraform) {
+		t.Skip("terraform is required to render the ExternalSecrets")
+	}
+	require.NoError(t, renderErr)
+	return rendered
+}
+
+func planExternalSecrets(t *testing.T) (map[string]renderedExternalSecret, error) {
+	// the fixture references the module through a relative path so the whole repo is copied
+	options := &terraform.Options{
+		TerraformDir: test_structure.CopyTerraformFolderToTemp(t, "../..", "tests/rotation/testdata/external-secret"),
+		Vars: map[string]interface{}{
+			"namespace":    namespace,
+			"sm_secret_id": secretID,
+			"data_key":     dataKey,
+		},
+		NoColor: true,
+	}
+	plan, err := terraform.InitAndPlanAndShowWithStructE(t, options)
+	if err != nil {
+		return nil, err
+	}
+	outputs := map[string]map[string]interface{}{}
+	for _, name := range []string{"manifests", "workload_annotations"} {
+		output, found := plan.RawPlan.OutputChanges[name]
+		if !found {
+			return nil, fmt.Errorf("output %s not found in the plan", name)
+		}
+		values, ok := output.After.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("output %s is not a map: %v", name, output.After)
+		}
+		outputs[name] = values
+	}
+
+	result := map[string]renderedExternalSecret{}
+	for _, key := range externalSecrets {
+		manifests, _ := outputs["manifests"][key].(string)
+		object, err := decodeExternalSecret(manifests)
+		if err != nil {
+			return nil, fmt.Errorf("manifests of the %s ExternalSecret: %w", key, err)
+		}
+		annotations := map[string]string{}
+		values, _ := outputs["workload_annotations"][key].(map[string]interface{})
+		for name, value := range values {
+			annotations[name] = fmt.Sprint(value)
+		}
+		result[key] = renderedExternalSecret{object: object, workloadAnnotations: annotations}
+	}
+	return result, nil
+}
+
+// decodeExternalSecret returns the ExternalSecret of the YAML documents
+func decodeExternalSecret(manifests string) (*unstructured.Unstructured, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(manifests), 4096)
+	for {
+		object := &unstructured.Unstructured{}
+		if err := decoder.Decode(&object.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("no ExternalSecret in the manifests")
+			}
+			return nil, err
+		}
+		if object.GetKind() == "ExternalSecret" {
+			return object, nil
+		}
+	}
+}
+
+// fakeESO syncs on a local API server the ExternalSecrets from the Secrets Manager stand-in on their creation and on
+// the update of their force-sync annotation, the refresh interval being ignored
+type fakeESO struct {
+	client  kubernetes.Interface
+	dynamic dynamic.Interface
+	source  *smstandin.Client
+}
+
+func (e *fakeESO) start(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	watcher, err := e.dynamic.Resource(ExternalSecretResource).Watch(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	go func() {
+		defer watcher.Stop()
+		synced := map[string]string{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+				object, isUnstructured := event.Object.(*unstructured.Unstructured)
+				if !isUnstructured || (event.Type != watch.Added && event.Type != watch.Modified) {
+					continue
+				}
+				key := object.GetNamespace() + "/" + object.GetName()
+				forceSync := object.GetAnnotations()[ForceSyncAnnotation]
+				if previous, found := synced[key]; found && previous == forceSync {
+					continue
+				}
+				synced[key] = forceSync
+				if err := e.sync(ctx, object); err != nil && ctx.Err() == nil {
+					t.Errorf("fake ESO: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (e *fakeESO) sync(ctx context.Context, object *unstructured.Unstructured) error {
+	values := map[string]string{}
+	data, _, _ := unstructured.NestedSlice(object.Object, "spec", "data")
+	for _, item := range data {
+		secretKey, _, _ := unstructured.NestedString(item.(map[string]interface{}), "secretKey")
+		remoteKey, _, _ := unstructured.NestedString(item.(map[string]interface{}), "remoteRef", "key")
+		secret, err := e.source.GetSecret(ctx, remoteKey)
+		if err != nil {
+			return err
+		}
+		values[secretKey] = secret.Payload
+	}
+
+	target := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: object.GetNamespace()}}
+	target.Name, _, _ = unstructured.NestedString(object.Object, "spec", "target", "name")
+	target.Annotations, _, _ = unstructured.NestedStringMap(object.Object, "spec", "target", "template", "metadata", "annotations")
+	templateType, _, _ := unstructured.NestedString(object.Object, "spec", "target", "template", "type")
+	target.Type = corev1.SecretType(templateType)
+	templateData, _, _ := unstructured.NestedStringMap(object.Object, "spec", "target", "template", "data")
+	target.Data = map[string][]byte{}
+	for key, text := range templateData {
+		parsed, err := template.New(key).Parse(text)
+		if err != nil {
+			return err
+		}
+		var rendered bytes.Buffer
+		if err := parsed.Execute(&rendered, values); err != nil {
+			return err
+		}
+		target.Data[key] = rendered.Bytes()
+	}
+
+	secrets := e.client.CoreV1().Secrets(target.Namespace)
+	_, err := secrets.Update(ctx, target, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, target, metav1.CreateOptions{})
+	}
+	return err
+}
+
+// fakeReloader reloads on a local API server, with the strategy of the Reloader, the deployments listing an updated
+// secret in their secret.reloader.stakater.com/reload annotation, or consuming it with the reloader.stakater.com/auto
+// annotation
+type fakeReloader struct {
+	client   kubernetes.Interface
+	strategy reloadercheck.Strategy
+}
+
+func (r *fakeReloader) start(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	watcher, err := r.client.CoreV1().Secrets("").Watch(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	go func() {
+		defer watcher.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+				secret, isSecret := event.Object.(*corev1.Secret)
+				if !isSecret || event.Type != watch.Modified {
+					continue
+				}
+				if err := r.reload(ctx, secret); err != nil && ctx.Err() == nil {
+					t.Errorf("fake reloader: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (r *fakeReloader) reload(ctx context.Context, secret *corev1.Secret) error {
+	deployments, err := r.client.AppsV1().Deployments(secret.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	hash := reloadercheck.SecretHash(secret.Data)
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		listed := slices.Contains(strings.Split(deployment.Annotations[reloadercheck.SecretReloadAnnotation], ","), secret.Name)
+		auto := deployment.Annotations[reloadercheck.AutoAnnotation] == "true" && consumesSecret(deployment.Spec.Template.Spec, secret.Name)
+		if !listed && !auto {
+			continue
+		}
+		template := &deployment.Spec.Template
+		if r.strategy == reloadercheck.StrategyAnnotations {
+			source, _ := json.Marshal(map[string]string{"type": "SECRET", "name": secret.Name, "namespace": secret.Namespace, "hash": hash})
+			if template.Annotations == nil {
+				template.Annotations = map[string]string{}
+			}
+			template.Annotations[reloadercheck.LastReloadedFromAnnotation] = string(source)
+		} else {
+			container := &template.Spec.Containers[0]
+			container.Env = append(slices.DeleteFunc(container.Env, func(env corev1.EnvVar) bool {
+				return env.Name == reloadercheck.EnvVarName(secret.Name)
+			}), corev1.EnvVar{Name: reloadercheck.EnvVarName(secret.Name), Value: hash})
+		}
+		if _, err := r.client.AppsV1().Deployments(secret.Namespace).Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumesSecret returns true if an environment variable of the containers of the pod reads the secret
+func consumesSecret(pod corev1.PodSpec, secretName string) bool {
+	for _, container := range pod.Containers {
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.Name == secretName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// startDeploymentController completes on a local API server the rollout of the deployments on each update
+func startDeploymentController(t *testing.T, client kubernetes.Interface) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	watcher, err := client.AppsV1().Deployments("").Watch(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	go func() {
+		defer watcher.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+				deployment, isDeployment := event.Object.(*appsv1.Deployment)
+				if !isDeployment || event.Type == watch.Deleted || reloadercheck.RolloutComplete(deployment) {
+					continue
+				}
+				time.Sleep(50 * time.Millisecond)
+				deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: deployment.Generation, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+				_, _ = client.AppsV1().Deployments(deployment.Namespace).UpdateStatus(ctx, deployment, metav1.UpdateOptions{})
+			}
+		}
+	}()
+}
+
+// newScenario returns the rotation scenario of the ExternalSecret on a local API server, with a fake ESO and Reloader
+func newScenario(t *testing.T, strategy reloadercheck.Strategy, externalSecret renderedExternalSecret) *Scenario {
+	server := smstandin.NewServer(t)
+	server.SetSecret(smstandin.Secret{ID: secretID, SecretType: "arbitrary", Payload: "initial-value"})
+
+	client := fake.NewClientset()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		ExternalSecretResource: "ExternalSecretList",
+	})
+	(&fakeESO{client: client, dynamic: dynamicClient, source: server.Client()}).start(t)
+	(&fakeReloader{client: client, strategy: strategy}).start(t)
+	startDeploymentController(t, client)
+
+	_, err := dynamicClient.Resource(ExternalSecretResource).Namespace(namespace).Create(context.Background(), externalSecret.object.DeepCopy(), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	return &Scenario{
+		Dynamic:        dynamicClient,
+		Source:         server,
+		SecretID:       secretID,
+		ExternalSecret: externalSecret.object.GetName(),
+		Checker: &reloadercheck.Checker{
+			Client:       client,
+			Namespace:    namespace,
+			Strategy:     strategy,
+			SecretKey:    dataKey,
+			Timeout:      5 * time.Second,
+			CheckRollout: true,
+		},
+		Deployment:          "rotation-app",
+		WorkloadAnnotations: externalSecret.workloadAnnotations,
+		Timeout:             5 * time.Second,
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	externalSecret := renderExternalSecrets(t)["watched"]
+	for _, strategy := range []reloadercheck.Strategy{reloadercheck.StrategyEnvVars, reloadercheck.StrategyAnnotations} {
+		t.Run(string(strategy), func(t *testing.T) {
+			t.Parallel()
+
+			scenario := newScenario(t, strategy, externalSecret)
+			report, err := scenario.Run(context.Background(), "rotated-value")
+			require.NoError(t, err)
+			t.Logf("rotation with strategy %s: %s", strategy, report)
+
+			stages := make([]string, 0, len(report.Stages))
+			for _, stage := range report.Stages {
+				stages = append(stages, stage.Name)
+			}
+			assert.Equal(t, []string{StageRotate, StageRefresh, StageReload, StageRollout}, stages)
+
+			secret, err := scenario.Checker.Client.CoreV1().Secrets(namespace).Get(context.Background(), scenario.ExternalSecret, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "rotated-value", string(secret.Data[dataKey]))
+		})
+	}
+}
+
+func TestRunWithoutReloaderWatching(t *testing.T) {
+	t.Parallel()
+
+	scenario := newScenario(t, reloadercheck.StrategyEnvVars, renderExternalSecrets(t)["unwatched"])
+	report, err := scenario.Run(context.Background(), "rotated-value")
+	assert.ErrorContains(t, err, "eso-refresh: secret rotation-ns/rotated-secret-unwatched not annotated with reloader.stakater.com/auto")
+	require.Len(t, report.Stages, 1)
+	assert.Equal(t, StageRotate, report.Stages[0].Name)
+}
+
+func TestRunWithoutRotation(t *testing.T) {
+	t.Parallel()
+
+	scenario := newScenario(t, reloadercheck.StrategyAnnotations, renderExternalSecrets(t)["watched"])
+	scenario.SecretID = "unknown-secret-id"
+	_, err := scenario.Run(context.Background(), "rotated-value")
+	assert.ErrorContains(t, err, "rotate: secret unknown-secret-id: secret not found")
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	report := Report{Stages: []Stage{{Name: StageRotate, Duration: time.Millisecond}, {Name: StageRefresh, Duration: 2 * time.Second}}}
+	assert.Equal(t, 2*time.Second+time.Millisecond, report.Total())
+	assert.Equal(t, "rotate 1ms, eso-refresh 2s (total 2.001s)", report.String())
+}
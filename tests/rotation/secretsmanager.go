@@ -0,0 +1,103 @@
+package rotation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultIAMURL is the IAM endpoint the API key is exchanged for a token at when SecretsManager.IAMURL is not set
+const DefaultIAMURL = "https://iam.cloud.ibm.com"
+
+// SecretsManager rotates the arbitrary secrets of a Secrets Manager instance by creating a new version through the
+// Secrets Manager v2 API
+type SecretsManager struct {
+	// URL is the endpoint of the instance, see SecretsManagerURL
+	URL string
+	// APIKey is the IBM Cloud API key of an identity with the Writer role on the secrets
+	APIKey string
+	// IAMURL is the IAM endpoint, DefaultIAMURL if empty
+	IAMURL     string
+	HTTPClient *http.Client
+}
+
+// SecretsManagerURL returns the public endpoint of the Secrets Manager instance
+func SecretsManagerURL(guid string, region string) string {
+	return fmt.Sprintf("https://%s.%s.secrets-manager.appdomain.cloud", guid, region)
+}
+
+// Rotate creates a new version of the arbitrary secret with the value
+func (s *SecretsManager) Rotate(ctx context.Context, id string, value string) error {
+	token, err := s.token(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]string{"payload": value})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/api/v2/secrets/%s/versions", s.URL, url.PathEscape(id)), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	if err := s.do(request, http.StatusCreated, nil); err != nil {
+		return fmt.Errorf("rotating secret %s: %w", id, err)
+	}
+	return nil
+}
+
+// token exchanges the API key for an IAM access token
+func (s *SecretsManager) token(ctx context.Context) (string, error) {
+	iamURL := s.IAMURL
+	if iamURL == "" {
+		iamURL = DefaultIAMURL
+	}
+	form := url.Values{"grant_type": {"urn:ibm:params:oauth:grant-type:apikey"}, "apikey": {s.APIKey}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, iamURL+"/identity/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := s.do(request, http.StatusOK, &token); err != nil {
+		return "", fmt.Errorf("getting an IAM token: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+// do sends the request and decodes the response in result if not nil, the response must have the expected status
+func (s *SecretsManager) do(request *http.Request, expected int, result interface{}) error {
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	// the body is read to the end to reuse the connection
+	defer func() {
+		_, _ = io.Copy(io.Discard, response.Body)
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != expected {
+		content, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("status %d: %s", response.StatusCode, strings.TrimSpace(string(content)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
@@ -0,0 +1,68 @@
+// Tests in this file are run in the PR pipeline
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSecretsManagerAPI returns a local IAM and Secrets Manager API accepting the API key and recording the payloads
+// of the created versions by secret ID
+func newSecretsManagerAPI(t *testing.T, apiKey string) (*httptest.Server, map[string][]string) {
+	versions := map[string][]string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /identity/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") != "urn:ibm:params:oauth:grant-type:apikey" || r.PostFormValue("apikey") != apiKey {
+			http.Error(w, `{"errorMessage":"Provided API key could not be found."}`, http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "token"})
+	})
+	mux.HandleFunc("POST /api/v2/secrets/{id}/versions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, `{"errors":[{"message":"Unauthorized"}]}`, http.StatusUnauthorized)
+			return
+		}
+		if r.PathValue("id") != "arbitrary-secret-id" {
+			http.Error(w, `{"errors":[{"message":"Not found"}]}`, http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Payload string `json:"payload"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		versions[r.PathValue("id")] = append(versions[r.PathValue("id")], body.Payload)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": "version-id"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, versions
+}
+
+func TestSecretsManagerRotate(t *testing.T) {
+	t.Parallel()
+
+	server, versions := newSecretsManagerAPI(t, "apikey")
+	secretsManager := &SecretsManager{URL: server.URL, APIKey: "apikey", IAMURL: server.URL}
+	require.NoError(t, secretsManager.Rotate(context.Background(), "arbitrary-secret-id", "rotated-value"))
+	assert.Equal(t, []string{"rotated-value"}, versions["arbitrary-secret-id"])
+
+	err := secretsManager.Rotate(context.Background(), "unknown-secret-id", "rotated-value")
+	assert.ErrorContains(t, err, "rotating secret unknown-secret-id: status 404")
+
+	secretsManager.APIKey = "invalid"
+	err = secretsManager.Rotate(context.Background(), "arbitrary-secret-id", "rotated-value")
+	assert.ErrorContains(t, err, "getting an IAM token: status 400: {\"errorMessage\":\"Provided API key could not be found.\"}")
+	assert.Len(t, versions["arbitrary-secret-id"], 1)
+}
+
+func TestSecretsManagerURL(t *testing.T) {
+	assert.Equal(t, "https://guid.us-south.secrets-manager.appdomain.cloud", SecretsManagerURL("guid", "us-south"))
+}
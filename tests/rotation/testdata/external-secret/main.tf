@@ -0,0 +1,20 @@
+##################################################################
+# The ExternalSecrets of the rotation tests, rendered by
+# eso-external-secret for an arbitrary secret synced to an opaque
+# secret, with and without reloader_watching
+##################################################################
+
+module "external_secret" {
+  for_each                      = { watched = true, unwatched = false }
+  source                        = "../../../../modules/eso-external-secret"
+  eso_store_name                = "cluster-store"
+  es_kubernetes_namespace       = var.namespace
+  es_kubernetes_secret_name     = "rotated-secret-${each.key}"
+  es_kubernetes_secret_type     = "opaque"
+  es_kubernetes_secret_data_key = var.data_key
+  sm_secret_type                = "arbitrary"
+  sm_secret_id                  = var.sm_secret_id
+  es_helm_rls_name              = "rotated-secret-${each.key}"
+  reloader_watching             = each.value
+  render_only                   = true
+}
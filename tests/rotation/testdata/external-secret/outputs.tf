@@ -0,0 +1,9 @@
+output "manifests" {
+  description = "The ExternalSecret manifests rendered by eso-external-secret, by reloader watching"
+  value       = { for key, external_secret in module.external_secret : key => external_secret.manifests }
+}
+
+output "workload_annotations" {
+  description = "The annotations of the workloads consuming the secrets, by reloader watching"
+  value       = { for key, external_secret in module.external_secret : key => external_secret.reloader_workload_annotations }
+}
@@ -0,0 +1,12 @@
+# the ExternalSecrets are only rendered: the providers don't need to reach a cluster
+provider "kubernetes" {
+  host     = "https://127.0.0.1:6443"
+  insecure = true
+}
+
+provider "helm" {
+  kubernetes = {
+    host     = "https://127.0.0.1:6443"
+    insecure = true
+  }
+}
@@ -0,0 +1,14 @@
+variable "namespace" {
+  type        = string
+  description = "Namespace of the ExternalSecrets."
+}
+
+variable "sm_secret_id" {
+  type        = string
+  description = "ID of the Secrets Manager arbitrary secret synced by the ExternalSecrets."
+}
+
+variable "data_key" {
+  type        = string
+  description = "Key of the value of the arbitrary secret in the generated Kubernetes secrets."
+}
@@ -0,0 +1,281 @@
+// Package scenario loads the YAML scenario files declaring, for each test, the terraform input variables and the
+// secrets and stores expected in the cluster after the apply, so that adding a test case doesn't require editing Go.
+//
+// String values may reference placeholders with the ${name} syntax, replaced by the values provided by the test
+// (for example the permanent resources IDs or the randomised prefix), a missing value being an error.
+package scenario
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/syncverify"
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is the content of a scenario file
+type Scenario struct {
+	Name string `yaml:"name"`
+	// TerraformDir is the terraform directory to run, relative to the repository root
+	TerraformDir  string                 `yaml:"terraform_dir"`
+	TerraformVars map[string]interface{} `yaml:"terraform_vars"`
+	Secrets       []Secret               `yaml:"expected_secrets"`
+	Stores        []Store                `yaml:"expected_stores"`
+}
+
+// Secret is a Kubernetes secret expected in the cluster
+type Secret struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	// Type is the shape of the secret as rendered by the eso-external-secret module, one of the syncverify shapes
+	Type string `yaml:"type"`
+	// Keys are the data key of an opaque secret, of a service credentials secret without mappings or the keys of the whole data of a kv secret
+	Keys []string `yaml:"keys"`
+	// KVKey is the key pulled from a kv secret
+	KVKey                      string            `yaml:"kv_key"`
+	Registries                 []Registry        `yaml:"registries"`
+	CertificateHasIntermediate bool              `yaml:"certificate_has_intermediate"`
+	Mappings                   map[string]string `yaml:"mappings"`
+}
+
+// Registry is an auths entry expected in a dockerconfigjson secret
+type Registry struct {
+	Server   string `yaml:"server"`
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+}
+
+// Store is a SecretStore or ClusterSecretStore expected in the cluster
+type Store struct {
+	Name string `yaml:"name"`
+	// Namespace is only set for SecretStore
+	Namespace string `yaml:"namespace"`
+	Kind      string `yaml:"kind"`
+}
+
+const (
+	KindSecretStore        = "SecretStore"
+	KindClusterSecretStore = "ClusterSecretStore"
+)
+
+var placeholderRegex = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)\}`)
+
+// Load reads and validates a scenario file, placeholders are not replaced
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var scenario Scenario
+	if err := decoder.Decode(&scenario); err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	if err := scenario.validate(); err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	return &scenario, nil
+}
+
+func (s *Scenario) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.TerraformDir == "" {
+		return fmt.Errorf("terraform_dir is required")
+	}
+	for index, secret := range s.Secrets {
+		if secret.Name == "" || secret.Namespace == "" {
+			return fmt.Errorf("expected_secrets[%d]: name and namespace are required", index)
+		}
+		switch syncverify.Shape(secret.Type) {
+		case syncverify.ShapeDockerConfigJSON:
+			if len(secret.Registries) == 0 {
+				return fmt.Errorf("expected_secrets[%d]: registries are required for type %s", index, secret.Type)
+			}
+		case syncverify.ShapeOpaque:
+			if len(secret.Keys) != 1 {
+				return fmt.Errorf("expected_secrets[%d]: exactly one key is required for type %s", index, secret.Type)
+			}
+		case syncverify.ShapeServiceCredentials:
+			if len(secret.Mappings) == 0 && len(secret.Keys) != 1 {
+				return fmt.Errorf("expected_secrets[%d]: mappings or exactly one key are required for type %s", index, secret.Type)
+			}
+		case syncverify.ShapeKV:
+			if secret.KVKey != "" && len(secret.Keys) > 0 {
+				return fmt.Errorf("expected_secrets[%d]: kv_key and keys are mutually exclusive", index)
+			}
+		case syncverify.ShapeTLS, syncverify.ShapeUsernamePassword:
+		default:
+			return fmt.Errorf("expected_secrets[%d]: unknown type %q", index, secret.Type)
+		}
+	}
+	for index, store := range s.Stores {
+		switch {
+		case store.Name == "":
+			return fmt.Errorf("expected_stores[%d]: name is required", index)
+		case store.Kind == KindSecretStore && store.Namespace == "":
+			return fmt.Errorf("expected_stores[%d]: namespace is required for kind %s", index, store.Kind)
+		case store.Kind == KindClusterSecretStore && store.Namespace != "":
+			return fmt.Errorf("expected_stores[%d]: namespace must not be set for kind %s", index, store.Kind)
+		case store.Kind != KindSecretStore && store.Kind != KindClusterSecretStore:
+			return fmt.Errorf("expected_stores[%d]: unknown kind %q", index, store.Kind)
+		}
+	}
+	return nil
+}
+
+// Placeholders returns the sorted names of the placeholders referenced by the scenario
+func (s *Scenario) Placeholders() []string {
+	fields := []interface{}{s.TerraformVars}
+	for _, secret := range s.Secrets {
+		fields = append(fields, secret.Name, secret.Namespace)
+	}
+	for _, store := range s.Stores {
+		fields = append(fields, store.Name, store.Namespace)
+	}
+	found := map[string]bool{}
+	walk(fields, func(value string) {
+		for _, match := range placeholderRegex.FindAllStringSubmatch(value, -1) {
+			found[match[1]] = true
+		}
+	})
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Vars returns the terraform input variables with the placeholders replaced
+func (s *Scenario) Vars(values map[string]string) (map[string]interface{}, error) {
+	expander := &expander{values: values}
+	vars := expander.expandValue(s.TerraformVars).(map[string]interface{})
+	if err := expander.err(); err != nil {
+		return nil, fmt.Errorf("scenario %s terraform_vars: %w", s.Name, err)
+	}
+	return vars, nil
+}
+
+// ExpectedSecrets returns the verifications of the expected secrets with the placeholders replaced
+func (s *Scenario) ExpectedSecrets(values map[string]string) ([]syncverify.Expectation, error) {
+	expander := &expander{values: values}
+	expectations := make([]syncverify.Expectation, 0, len(s.Secrets))
+	for _, secret := range s.Secrets {
+		expectation := syncverify.Expectation{
+			Name:                       expander.expand(secret.Name),
+			Namespace:                  expander.expand(secret.Namespace),
+			Shape:                      syncverify.Shape(secret.Type),
+			CertificateHasIntermediate: secret.CertificateHasIntermediate,
+			KVKey:                      secret.KVKey,
+			ServiceCredentialsMappings: secret.Mappings,
+		}
+		switch expectation.Shape {
+		case syncverify.ShapeKV:
+			expectation.KVKeys = secret.Keys
+		case syncverify.ShapeOpaque, syncverify.ShapeServiceCredentials:
+			if len(secret.Keys) > 0 {
+				expectation.DataKey = secret.Keys[0]
+			}
+		}
+		for _, registry := range secret.Registries {
+			expectation.Registries = append(expectation.Registries, syncverify.Registry{
+				Server:   registry.Server,
+				Username: registry.Username,
+				Email:    registry.Email,
+			})
+		}
+		expectations = append(expectations, expectation)
+	}
+	if err := expander.err(); err != nil {
+		return nil, fmt.Errorf("scenario %s expected_secrets: %w", s.Name, err)
+	}
+	return expectations, nil
+}
+
+// ExpectedStores returns the expected stores with the placeholders replaced
+func (s *Scenario) ExpectedStores(values map[string]string) ([]Store, error) {
+	expander := &expander{values: values}
+	stores := make([]Store, 0, len(s.Stores))
+	for _, store := range s.Stores {
+		stores = append(stores, Store{Name: expander.expand(store.Name), Namespace: expander.expand(store.Namespace), Kind: store.Kind})
+	}
+	if err := expander.err(); err != nil {
+		return nil, fmt.Errorf("scenario %s expected_stores: %w", s.Name, err)
+	}
+	return stores, nil
+}
+
+// expander replaces the placeholders, collecting the ones without value
+type expander struct {
+	values  map[string]string
+	missing map[string]bool
+}
+
+func (e *expander) expand(value string) string {
+	return placeholderRegex.ReplaceAllStringFunc(value, func(placeholder string) string {
+		name := placeholderRegex.FindStringSubmatch(placeholder)[1]
+		replacement, found := e.values[name]
+		if !found {
+			if e.missing == nil {
+				e.missing = map[string]bool{}
+			}
+			e.missing[name] = true
+		}
+		return replacement
+	})
+}
+
+// expandValue returns a copy of a decoded YAML value with the placeholders replaced in all the strings
+func (e *expander) expandValue(value interface{}) interface{} {
+	switch node := value.(type) {
+	case string:
+		return e.expand(node)
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(node))
+		for key, element := range node {
+			expanded[key] = e.expandValue(element)
+		}
+		return expanded
+	case []interface{}:
+		expanded := make([]interface{}, 0, len(node))
+		for _, element := range node {
+			expanded = append(expanded, e.expandValue(element))
+		}
+		return expanded
+	}
+	return value
+}
+
+func (e *expander) err() error {
+	if len(e.missing) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(e.missing))
+	for name := range e.missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("no value for placeholders %v", names)
+}
+
+// walk calls fn for each string in a decoded YAML value
+func walk(value interface{}, fn func(string)) {
+	switch node := value.(type) {
+	case string:
+		fn(node)
+	case map[string]interface{}:
+		for _, element := range node {
+			walk(element, fn)
+		}
+	case []interface{}:
+		for _, element := range node {
+			walk(element, fn)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Tests in this file are run in the PR pipeline
+package scenario
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/syncverify"
+)
+
+const scenariosDir = "../scenarios"
+
+func writeScenario(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+// TestLoadScenarios checks that all the scenario files of the tests are valid
+func TestLoadScenarios(t *testing.T) {
+	t.Parallel()
+
+	files, err := filepath.Glob(filepath.Join(scenariosDir, "*.yaml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files, "No scenario found in %s", scenariosDir)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			scenario, err := Load(file)
+			require.NoError(t, err)
+
+			assert.DirExists(t, filepath.Join("..", "..", scenario.TerraformDir), "terraform_dir should be relative to the repository root")
+
+			values := map[string]string{}
+			for _, placeholder := range scenario.Placeholders() {
+				values[placeholder] = "value-of-" + placeholder
+			}
+			_, err = scenario.Vars(values)
+			assert.NoError(t, err)
+			_, err = scenario.ExpectedSecrets(values)
+			assert.NoError(t, err)
+			_, err = scenario.ExpectedStores(values)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestScenario(t *testing.T) {
+	t.Parallel()
+
+	path := writeScenario(t, `
+name: test
+terraform_dir: examples/basic
+terraform_vars:
+  region: ${region}
+  dollar: $notaplaceholder
+  enabled: true
+  nested:
+    list: ["${prefix}-a", 1]
+expected_secrets:
+  - name: ${prefix}-secret
+    namespace: ns
+    type: opaque
+    keys: [apikey]
+  - name: kv
+    namespace: ns
+    type: kv
+    keys: [key1, key2]
+  - name: registry
+    namespace: ns
+    type: dockerconfigjson
+    registries:
+      - server: test.icr.com
+        email: terraform@ibm.com
+expected_stores:
+  - name: ${prefix}-store
+    namespace: ns
+    kind: SecretStore
+  - name: cluster-store
+    kind: ClusterSecretStore
+`)
+	scenario, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prefix", "region"}, scenario.Placeholders())
+
+	values := map[string]string{"prefix": "eso-abc", "region": "us-south"}
+	vars, err := scenario.Vars(values)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"region":  "us-south",
+		"dollar":  "$notaplaceholder",
+		"enabled": true,
+		"nested":  map[string]interface{}{"list": []interface{}{"eso-abc-a", 1}},
+	}, vars)
+	// the scenario itself is not modified
+	assert.Equal(t, "${region}", scenario.TerraformVars["region"])
+
+	expectations, err := scenario.ExpectedSecrets(values)
+	require.NoError(t, err)
+	assert.Equal(t, []syncverify.Expectation{
+		{Name: "eso-abc-secret", Namespace: "ns", Shape: syncverify.ShapeOpaque, DataKey: "apikey"},
+		{Name: "kv", Namespace: "ns", Shape: syncverify.ShapeKV, KVKeys: []string{"key1", "key2"}},
+		{Name: "registry", Namespace: "ns", Shape: syncverify.ShapeDockerConfigJSON, Registries: []syncverify.Registry{{Server: "test.icr.com", Email: "terraform@ibm.com"}}},
+	}, expectations)
+
+	stores, err := scenario.ExpectedStores(values)
+	require.NoError(t, err)
+	assert.Equal(t, []Store{
+		{Name: "eso-abc-store", Namespace: "ns", Kind: KindSecretStore},
+		{Name: "cluster-store", Kind: KindClusterSecretStore},
+	}, stores)
+
+	_, err = scenario.Vars(map[string]string{"prefix": "eso-abc"})
+	assert.ErrorContains(t, err, "no value for placeholders [region]")
+	_, err = scenario.ExpectedSecrets(map[string]string{})
+	assert.ErrorContains(t, err, "no value for placeholders [prefix]")
+}
+
+func TestLoadInvalidScenario(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{
+			name:          "unknown-field",
+			content:       "name: test\nterraform_dir: examples/basic\nexpected_secret: []\n",
+			expectedError: "field expected_secret not found",
+		},
+		{
+			name:          "missing-terraform-dir",
+			content:       "name: test\n",
+			expectedError: "terraform_dir is required",
+		},
+		{
+			name:          "unknown-secret-type",
+			content:       "name: test\nterraform_dir: examples/basic\nexpected_secrets:\n  - {name: s, namespace: ns, type: docker}\n",
+			expectedError: "expected_secrets[0]: unknown type \"docker\"",
+		},
+		{
+			name:          "opaque-without-key",
+			content:       "name: test\nterraform_dir: examples/basic\nexpected_secrets:\n  - {name: s, namespace: ns, type: opaque}\n",
+			expectedError: "expected_secrets[0]: exactly one key is required",
+		},
+		{
+			name:          "dockerconfigjson-without-registries",
+			content:       "name: test\nterraform_dir: examples/basic\nexpected_secrets:\n  - {name: s, namespace: ns, type: dockerconfigjson}\n",
+			expectedError: "expected_secrets[0]: registries are required",
+		},
+		{
+			name:          "secret-store-without-namespace",
+			content:       "name: test\nterraform_dir: examples/basic\nexpected_stores:\n  - {name: s, kind: SecretStore}\n",
+			expectedError: "expected_stores[0]: namespace is required",
+		},
+		{
+			name:          "cluster-secret-store-with-namespace",
+			content:       "name: test\nterraform_dir: examples/basic\nexpected_stores:\n  - {name: s, namespace: ns, kind: ClusterSecretStore}\n",
+			expectedError: "expected_stores[0]: namespace must not be set",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(writeScenario(t, tc.content))
+			assert.ErrorContains(t, err, tc.expectedError)
+		})
+	}
+}
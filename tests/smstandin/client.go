@@ -0,0 +1,59 @@
+package smstandin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Client reads secrets through the Secrets Manager v2 API
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// GetSecret returns the secret with the given ID
+func (c *Client) GetSecret(ctx context.Context, id string) (Secret, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/v2/secrets/%s", c.BaseURL, url.PathEscape(id)), nil)
+	if err != nil {
+		return Secret{}, err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return Secret{}, err
+	}
+	// the body is read to the end to reuse the connection
+	defer func() {
+		_, _ = io.Copy(io.Discard, response.Body)
+		_ = response.Body.Close()
+	}()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		var secret Secret
+		if err := json.NewDecoder(response.Body).Decode(&secret); err != nil {
+			return Secret{}, fmt.Errorf("decoding secret %s: %w", id, err)
+		}
+		return secret, nil
+	case http.StatusNotFound:
+		return Secret{}, fmt.Errorf("secret %s: %w", id, ErrNotFound)
+	case http.StatusTooManyRequests:
+		return Secret{}, fmt.Errorf("getting secret %s: %w", id, ErrRateLimited)
+	default:
+		var body apiError
+		_ = json.NewDecoder(response.Body).Decode(&body)
+		if len(body.Errors) > 0 {
+			return Secret{}, fmt.Errorf("getting secret %s: status %d: %s", id, response.StatusCode, body.Errors[0].Message)
+		}
+		return Secret{}, fmt.Errorf("getting secret %s: status %d", id, response.StatusCode)
+	}
+}
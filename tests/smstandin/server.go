@@ -0,0 +1,201 @@
+// Package smstandin provides an in-memory stand-in of the IBM Cloud Secrets Manager v2 API, serving the secrets read by ESO
+// so that the content of the Kubernetes secrets synced from them can be cross-checked without a Secrets Manager instance
+package smstandin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrNotFound is returned when the requested secret doesn't exist in the stand-in
+var ErrNotFound = errors.New("secret not found")
+
+// ErrRateLimited is returned when the request is rejected by the rate limit of the stand-in with 429 Too Many Requests
+var ErrRateLimited = errors.New("too many requests")
+
+// Secret is a Secrets Manager secret as returned by the GET /api/v2/secrets/{id} API, only the fields related to the secret type are set
+type Secret struct {
+	ID         string `json:"id"`
+	SecretType string `json:"secret_type"`
+	Name       string `json:"name,omitempty"`
+
+	// arbitrary
+	Payload string `json:"payload,omitempty"`
+	// username_password
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// iam_credentials
+	APIKey string `json:"api_key,omitempty"`
+	// kv
+	Data map[string]interface{} `json:"data,omitempty"`
+	// imported_cert, public_cert and private_cert
+	Certificate  string `json:"certificate,omitempty"`
+	Intermediate string `json:"intermediate,omitempty"`
+	PrivateKey   string `json:"private_key,omitempty"`
+	// service_credentials
+	Credentials map[string]interface{} `json:"credentials,omitempty"`
+}
+
+// Limits are the latency and the rate limit applied by the stand-in to the API requests, to reproduce the behaviour
+// of a Secrets Manager instance under load
+type Limits struct {
+	// Latency is the time taken to serve each request, including the rejected ones
+	Latency time.Duration
+	// RateLimit is the number of requests per second served, the requests over the limit being rejected with
+	// 429 Too Many Requests. Unlimited if 0
+	RateLimit float64
+	// Burst is the number of requests served at once above RateLimit, 1 if not set
+	Burst int
+}
+
+// Server is a Secrets Manager stand-in serving the secrets set through SetSecret
+type Server struct {
+	*httptest.Server
+	mu        sync.Mutex
+	secrets   map[string]Secret
+	requests  int
+	throttled int
+	latency   time.Duration
+	limiter   *rate.Limiter
+}
+
+// NewServer starts a Secrets Manager stand-in, closed at the end of the test
+func NewServer(t testing.TB) *Server {
+	server := &Server{secrets: map[string]Secret{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2/secrets/{id}", server.handleGetSecret)
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// SetSecret creates or replaces a secret
+func (s *Server) SetSecret(secret Secret) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[secret.ID] = secret
+}
+
+// Rotate replaces the value of an arbitrary, iam_credentials or username_password secret: its payload, API key or password
+func (s *Server) Rotate(_ context.Context, id string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, found := s.secrets[id]
+	if !found {
+		return fmt.Errorf("secret %s: %w", id, ErrNotFound)
+	}
+	switch secret.SecretType {
+	case "arbitrary":
+		secret.Payload = value
+	case "iam_credentials":
+		secret.APIKey = value
+	case "username_password":
+		secret.Password = value
+	default:
+		return fmt.Errorf("secret %s: rotation of %s secrets not supported", id, secret.SecretType)
+	}
+	s.secrets[id] = secret
+	return nil
+}
+
+// GetSecret returns a secret without going through the API
+func (s *Server) GetSecret(_ context.Context, id string) (Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, found := s.secrets[id]
+	if !found {
+		return Secret{}, fmt.Errorf("secret %s: %w", id, ErrNotFound)
+	}
+	return secret, nil
+}
+
+// SetLimits sets the latency and the rate limit of the API, the previous ones being discarded
+func (s *Server) SetLimits(limits Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = limits.Latency
+	s.limiter = nil
+	if limits.RateLimit > 0 {
+		s.limiter = rate.NewLimiter(rate.Limit(limits.RateLimit), max(limits.Burst, 1))
+	}
+}
+
+// Requests returns the number of API requests received, including the ones rejected by the rate limit
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Throttled returns the number of API requests rejected by the rate limit
+func (s *Server) Throttled() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.throttled
+}
+
+// Client returns a client of the stand-in API
+func (s *Server) Client() *Client {
+	return &Client{BaseURL: s.URL, HTTPClient: s.Server.Client()}
+}
+
+func (s *Server) handleGetSecret(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	latency, limiter := s.latency, s.limiter
+	allowed := limiter == nil || limiter.Allow()
+	if !allowed {
+		s.throttled++
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if !allowed {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "too_many_requests", "rate limit exceeded")
+		return
+	}
+
+	secret, err := s.GetSecret(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, secret)
+}
+
+// apiError is the error body returned by the Secrets Manager API
+type apiError struct {
+	StatusCode int            `json:"status_code"`
+	Errors     []apiErrorItem `json:"errors"`
+}
+
+type apiErrorItem struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, apiError{StatusCode: status, Errors: []apiErrorItem{{Code: code, Message: message}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
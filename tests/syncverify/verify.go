@@ -0,0 +1,504 @@
+// Package syncverify checks the content of the Kubernetes secrets synced by ESO against the shape rendered by the
+// eso-external-secret module and, when a source is provided, against the values of the Secrets Manager secrets
+package syncverify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/smstandin"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Shape is the structure of the Kubernetes secret rendered by the eso-external-secret module
+type Shape string
+
+const (
+	// ShapeDockerConfigJSON is a kubernetes.io/dockerconfigjson secret with an auths entry for each registry
+	ShapeDockerConfigJSON Shape = "dockerconfigjson"
+	// ShapeTLS is a kubernetes.io/tls secret with tls.crt and tls.key, from a certificate secret
+	ShapeTLS Shape = "tls"
+	// ShapeKV is an opaque secret with the secret key, from a kv secret
+	ShapeKV Shape = "kv"
+	// ShapeUsernamePassword is an opaque secret with the username and password keys, from a username_password secret
+	ShapeUsernamePassword Shape = "username_password"
+	// ShapeOpaque is an opaque secret with a single data key, from an arbitrary or iam_credentials secret
+	ShapeOpaque Shape = "opaque"
+	// ShapeServiceCredentials is an opaque secret with the whole credentials or a key for each mapping, from a service_credentials secret
+	ShapeServiceCredentials Shape = "service_credentials"
+)
+
+// kvSecretKey is the key of the opaque secret rendered for kv secrets
+const kvSecretKey = "secret"
+
+// iamAPIKeyUsername is the registry username set by the module for arbitrary and iam_credentials secrets
+const iamAPIKeyUsername = "iamapikey"
+
+// Registry is the expected auths entry of a dockerconfigjson secret
+type Registry struct {
+	// Server is the registry key of the auths entry
+	Server string
+	// Username is the expected username, any non empty value is accepted if not set
+	Username string
+	// Email is the expected email, the entry must not have an email if not set
+	Email string
+	// SecretID is the Secrets Manager secret holding the registry password, defaults to Expectation.SecretID
+	SecretID string
+}
+
+// Expectation describes a Kubernetes secret synced by ESO
+type Expectation struct {
+	Name      string
+	Namespace string
+	Shape     Shape
+	// SecretID is the Secrets Manager secret the Kubernetes secret is synced from
+	SecretID string
+	// DataKey is the key holding the value for ShapeOpaque and for ShapeServiceCredentials without mappings
+	DataKey string
+	// Registries are the expected auths entries for ShapeDockerConfigJSON
+	Registries []Registry
+	// CertificateHasIntermediate is set when tls.crt is the certificate followed by the intermediate
+	CertificateHasIntermediate bool
+	// KVKey is the key (or dot separated path) pulled from a kv secret, the whole data is expected if not set
+	KVKey string
+	// KVKeys are the keys expected in the whole data of a kv secret
+	KVKeys []string
+	// ServiceCredentialsMappings maps the secret keys to the dot separated path of their value in the service credentials
+	ServiceCredentialsMappings map[string]string
+}
+
+// String returns the namespace/name of the secret
+func (e Expectation) String() string {
+	return e.Namespace + "/" + e.Name
+}
+
+// Source returns the Secrets Manager secrets the Kubernetes secrets are synced from
+type Source interface {
+	GetSecret(ctx context.Context, id string) (smstandin.Secret, error)
+}
+
+// Verify checks the Kubernetes secret against the expectation, returning all the mismatches found.
+// The values are cross-checked with the Secrets Manager secrets only if source is not nil.
+func Verify(ctx context.Context, secret *corev1.Secret, expectation Expectation, source Source) error {
+	if secret == nil {
+		return fmt.Errorf("secret %s: not found", expectation)
+	}
+	v := &verifier{ctx: ctx, secret: secret, expectation: expectation, source: source}
+	switch expectation.Shape {
+	case ShapeDockerConfigJSON:
+		v.verifyDockerConfigJSON()
+	case ShapeTLS:
+		v.verifyTLS()
+	case ShapeKV:
+		v.verifyKV()
+	case ShapeUsernamePassword:
+		v.verifyUsernamePassword()
+	case ShapeOpaque:
+		v.verifyOpaque()
+	case ShapeServiceCredentials:
+		v.verifyServiceCredentials()
+	default:
+		v.errorf("unsupported shape %q", expectation.Shape)
+	}
+	return errors.Join(v.errs...)
+}
+
+type verifier struct {
+	ctx         context.Context
+	secret      *corev1.Secret
+	expectation Expectation
+	source      Source
+	errs        []error
+}
+
+func (v *verifier) errorf(format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf("secret %s: %s", v.expectation, fmt.Sprintf(format, args...)))
+}
+
+// checkType checks the type of the Kubernetes secret, an empty type being the same as Opaque
+func (v *verifier) checkType(expected corev1.SecretType) {
+	actual := v.secret.Type
+	if actual == "" {
+		actual = corev1.SecretTypeOpaque
+	}
+	if actual != expected {
+		v.errorf("type is %q, expected %q", actual, expected)
+	}
+}
+
+// value returns the non empty value of a key of the Kubernetes secret
+func (v *verifier) value(key string) (string, bool) {
+	value, found := v.secret.Data[key]
+	if !found {
+		v.errorf("key %q not found, keys are %v", key, v.keys())
+		return "", false
+	}
+	if len(bytes.TrimSpace(value)) == 0 {
+		v.errorf("key %q is empty", key)
+		return "", false
+	}
+	return string(value), true
+}
+
+func (v *verifier) keys() []string {
+	keys := make([]string, 0, len(v.secret.Data))
+	for key := range v.secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sourceSecret returns the Secrets Manager secret, false if there is no source or the secret can't be read.
+// The secret goes through a JSON round trip so that its data and credentials have the types decoded from the API.
+func (v *verifier) sourceSecret(id string) (smstandin.Secret, bool) {
+	if v.source == nil {
+		return smstandin.Secret{}, false
+	}
+	secret, err := v.source.GetSecret(v.ctx, id)
+	if err != nil {
+		v.errorf("reading source secret: %v", err)
+		return smstandin.Secret{}, false
+	}
+	encoded, err := json.Marshal(secret)
+	if err == nil {
+		var decoded smstandin.Secret
+		if err = json.Unmarshal(encoded, &decoded); err == nil {
+			return decoded, true
+		}
+	}
+	v.errorf("decoding source secret %s: %v", id, err)
+	return smstandin.Secret{}, false
+}
+
+// sourceValue returns the value pulled by ESO from an arbitrary or iam_credentials secret
+func (v *verifier) sourceValue(secret smstandin.Secret) (string, bool) {
+	switch secret.SecretType {
+	case "arbitrary":
+		return secret.Payload, true
+	case "iam_credentials":
+		return secret.APIKey, true
+	default:
+		v.errorf("source secret %s has type %q, expected arbitrary or iam_credentials", secret.ID, secret.SecretType)
+		return "", false
+	}
+}
+
+func (v *verifier) compare(what string, actual string, expected string) {
+	if actual != expected {
+		v.errorf("%s doesn't match the source secret", what)
+	}
+}
+
+// dockerConfigJSON is the content of the .dockerconfigjson key
+type dockerConfigJSON struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+type dockerAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+	Auth     string `json:"auth"`
+}
+
+func (v *verifier) verifyDockerConfigJSON() {
+	v.checkType(corev1.SecretTypeDockerConfigJson)
+	content, ok := v.value(corev1.DockerConfigJsonKey)
+	if !ok {
+		return
+	}
+	var config dockerConfigJSON
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		v.errorf("%s is not valid JSON: %v", corev1.DockerConfigJsonKey, err)
+		return
+	}
+	if len(config.Auths) != len(v.expectation.Registries) {
+		v.errorf("%s has %d auths entries, expected %d", corev1.DockerConfigJsonKey, len(config.Auths), len(v.expectation.Registries))
+	}
+
+	for _, registry := range v.expectation.Registries {
+		auth, found := config.Auths[registry.Server]
+		if !found {
+			v.errorf("%s has no auths entry for registry %s", corev1.DockerConfigJsonKey, registry.Server)
+			continue
+		}
+		if auth.Username == "" {
+			v.errorf("username of registry %s is empty", registry.Server)
+		} else if registry.Username != "" && auth.Username != registry.Username {
+			v.errorf("username of registry %s is %q, expected %q", registry.Server, auth.Username, registry.Username)
+		}
+		if auth.Password == "" {
+			v.errorf("password of registry %s is empty", registry.Server)
+		}
+		if auth.Email != registry.Email {
+			v.errorf("email of registry %s is %q, expected %q", registry.Server, auth.Email, registry.Email)
+		}
+
+		secretID := registry.SecretID
+		if secretID == "" {
+			secretID = v.expectation.SecretID
+		}
+		source, ok := v.sourceSecret(secretID)
+		if !ok {
+			continue
+		}
+		if source.SecretType == "username_password" {
+			v.compare("username of registry "+registry.Server, auth.Username, source.Username)
+			v.compare("password of registry "+registry.Server, auth.Password, source.Password)
+			continue
+		}
+		if registry.Username == "" && auth.Username != iamAPIKeyUsername {
+			v.errorf("username of registry %s is %q, expected %q", registry.Server, auth.Username, iamAPIKeyUsername)
+		}
+		if value, ok := v.sourceValue(source); ok {
+			v.compare("password of registry "+registry.Server, auth.Password, value)
+		}
+	}
+}
+
+func (v *verifier) verifyTLS() {
+	v.checkType(corev1.SecretTypeTLS)
+	certificate, certificateOK := v.value(corev1.TLSCertKey)
+	privateKey, privateKeyOK := v.value(corev1.TLSPrivateKeyKey)
+	if certificateOK {
+		v.checkCertificates(certificate)
+	}
+	if privateKeyOK {
+		v.checkPrivateKey(privateKey)
+	}
+	if certificateOK && privateKeyOK {
+		if _, err := tls.X509KeyPair([]byte(certificate), []byte(privateKey)); err != nil {
+			v.errorf("%s and %s are not a valid key pair: %v", corev1.TLSCertKey, corev1.TLSPrivateKeyKey, err)
+		}
+	}
+
+	source, ok := v.sourceSecret(v.expectation.SecretID)
+	if !ok {
+		return
+	}
+	expectedCertificate := source.Certificate
+	if v.expectation.CertificateHasIntermediate {
+		expectedCertificate += "\n" + source.Intermediate
+	}
+	v.compare(corev1.TLSCertKey, certificate, expectedCertificate)
+	v.compare(corev1.TLSPrivateKeyKey, privateKey, source.PrivateKey)
+}
+
+// checkCertificates checks that tls.crt only contains valid PEM certificates, the expected number of them
+func (v *verifier) checkCertificates(content string) {
+	expected := 1
+	if v.expectation.CertificateHasIntermediate {
+		expected = 2
+	}
+	count := 0
+	rest := []byte(content)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		count++
+		if block.Type != "CERTIFICATE" {
+			v.errorf("%s PEM block %d is a %q, expected a CERTIFICATE", corev1.TLSCertKey, count, block.Type)
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			v.errorf("%s PEM block %d is not a valid certificate: %v", corev1.TLSCertKey, count, err)
+		}
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		v.errorf("%s has content which is not PEM encoded", corev1.TLSCertKey)
+	}
+	if count < expected {
+		v.errorf("%s has %d certificates, expected at least %d", corev1.TLSCertKey, count, expected)
+	}
+}
+
+// checkPrivateKey checks that tls.key is a single valid PEM private key
+func (v *verifier) checkPrivateKey(content string) {
+	block, rest := pem.Decode([]byte(content))
+	if block == nil {
+		v.errorf("%s is not PEM encoded", corev1.TLSPrivateKeyKey)
+		return
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		v.errorf("%s has content after the private key", corev1.TLSPrivateKeyKey)
+	}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		_, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		v.errorf("%s is not a valid private key: %v", corev1.TLSPrivateKeyKey, err)
+	}
+}
+
+func (v *verifier) verifyKV() {
+	v.checkType(corev1.SecretTypeOpaque)
+	value, ok := v.value(kvSecretKey)
+	if !ok {
+		return
+	}
+
+	if v.expectation.KVKey != "" {
+		source, ok := v.sourceSecret(v.expectation.SecretID)
+		if !ok {
+			return
+		}
+		expected, found := lookupPath(source.Data, v.expectation.KVKey)
+		if !found {
+			v.errorf("key %q not found in the source secret data", v.expectation.KVKey)
+			return
+		}
+		v.compare(fmt.Sprintf("%s (kv key %s)", kvSecretKey, v.expectation.KVKey), value, stringify(expected))
+		return
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		v.errorf("%s is not a JSON object: %v", kvSecretKey, err)
+		return
+	}
+	for _, key := range v.expectation.KVKeys {
+		if element, found := data[key]; !found || stringify(element) == "" {
+			v.errorf("kv key %q is missing or empty", key)
+		}
+	}
+	if source, ok := v.sourceSecret(v.expectation.SecretID); ok {
+		v.compareJSON(kvSecretKey, data, source.Data)
+	}
+}
+
+func (v *verifier) verifyUsernamePassword() {
+	v.checkType(corev1.SecretTypeOpaque)
+	username, usernameOK := v.value("username")
+	password, passwordOK := v.value("password")
+	source, ok := v.sourceSecret(v.expectation.SecretID)
+	if !ok {
+		return
+	}
+	if usernameOK {
+		v.compare("username", username, source.Username)
+	}
+	if passwordOK {
+		v.compare("password", password, source.Password)
+	}
+}
+
+func (v *verifier) verifyOpaque() {
+	v.checkType(corev1.SecretTypeOpaque)
+	value, ok := v.value(v.expectation.DataKey)
+	if !ok {
+		return
+	}
+	if source, ok := v.sourceSecret(v.expectation.SecretID); ok {
+		if expected, ok := v.sourceValue(source); ok {
+			v.compare(v.expectation.DataKey, value, expected)
+		}
+	}
+}
+
+func (v *verifier) verifyServiceCredentials() {
+	v.checkType(corev1.SecretTypeOpaque)
+
+	if len(v.expectation.ServiceCredentialsMappings) == 0 {
+		value, ok := v.value(v.expectation.DataKey)
+		if !ok {
+			return
+		}
+		var credentials map[string]interface{}
+		if err := json.Unmarshal([]byte(value), &credentials); err != nil {
+			v.errorf("%s is not a JSON object: %v", v.expectation.DataKey, err)
+			return
+		}
+		if source, ok := v.sourceSecret(v.expectation.SecretID); ok {
+			v.compareJSON(v.expectation.DataKey, credentials, source.Credentials)
+		}
+		return
+	}
+
+	values := map[string]string{}
+	for key := range v.expectation.ServiceCredentialsMappings {
+		if value, ok := v.value(key); ok {
+			values[key] = value
+		}
+	}
+	source, ok := v.sourceSecret(v.expectation.SecretID)
+	if !ok {
+		return
+	}
+	for key, value := range values {
+		path := v.expectation.ServiceCredentialsMappings[key]
+		expected, found := lookupPath(source.Credentials, path)
+		if !found {
+			v.errorf("path %q of key %q not found in the source credentials", path, key)
+			continue
+		}
+		v.compare(fmt.Sprintf("%s (credentials path %s)", key, path), value, stringify(expected))
+	}
+}
+
+// compareJSON compares a decoded JSON object with the source one
+func (v *verifier) compareJSON(what string, actual map[string]interface{}, expected map[string]interface{}) {
+	if !reflect.DeepEqual(actual, expected) {
+		v.errorf("%s doesn't match the source secret", what)
+	}
+}
+
+// lookupPath returns the element at the dot separated path, numeric segments indexing arrays
+func lookupPath(data interface{}, path string) (interface{}, bool) {
+	current := data
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, found := node[segment]
+			if !found {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// stringify returns the value as rendered by the ESO templates: strings as they are, anything else JSON encoded
+func stringify(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,297 @@
+// Tests in this file are run in the PR pipeline
+package syncverify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator/smstandin"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// testCertificate returns a PEM certificate and its PEM private key, signed by the parent if set or self-signed otherwise
+func testCertificate(t *testing.T, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (string, string, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})),
+		certificate, key
+}
+
+func mustJSON(t *testing.T, value interface{}) string {
+	encoded, err := json.Marshal(value)
+	require.NoError(t, err)
+	return string(encoded)
+}
+
+func kubeSecret(secretType corev1.SecretType, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{Type: secretType, Data: map[string][]byte{}}
+	for key, value := range data {
+		secret.Data[key] = []byte(value)
+	}
+	return secret
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	intermediatePEM, _, intermediate, intermediateKey := testCertificate(t, "intermediate", nil, nil)
+	certificatePEM, privateKeyPEM, _, _ := testCertificate(t, "example.com", intermediate, intermediateKey)
+	_, otherPrivateKeyPEM, _, _ := testCertificate(t, "other.com", nil, nil)
+
+	credentials := map[string]interface{}{
+		"connection": map[string]interface{}{
+			"mysql": map[string]interface{}{
+				"authentication": map[string]interface{}{"username": "admin"},
+				"hosts":          []interface{}{map[string]interface{}{"hostname": "mysql.example.com", "port": 30000}},
+			},
+		},
+	}
+
+	server := smstandin.NewServer(t)
+	for _, secret := range []smstandin.Secret{
+		{ID: "arb", SecretType: "arbitrary", Payload: "arbitrary-value"},
+		{ID: "iam", SecretType: "iam_credentials", APIKey: "iam-apikey"},
+		{ID: "iam-2", SecretType: "iam_credentials", APIKey: "iam-apikey-2"},
+		{ID: "up", SecretType: "username_password", Username: "user", Password: "pass"},
+		{ID: "kv", SecretType: "kv", Data: map[string]interface{}{"key1": "value1", "key2": "value2", "nested": map[string]interface{}{"key": "value"}}},
+		{ID: "cert", SecretType: "imported_cert", Certificate: certificatePEM, Intermediate: intermediatePEM, PrivateKey: privateKeyPEM},
+		{ID: "sc", SecretType: "service_credentials", Credentials: credentials},
+	} {
+		server.SetSecret(secret)
+	}
+
+	testCases := []struct {
+		name        string
+		secret      *corev1.Secret
+		expectation Expectation
+		// errors expected with and without the source, no error if empty
+		expectedErrors              []string
+		expectedErrorsWithoutSource []string
+	}{
+		{
+			name: "dockerconfigjson-arbitrary",
+			secret: kubeSecret(corev1.SecretTypeDockerConfigJson, map[string]string{
+				".dockerconfigjson": mustJSON(t, map[string]interface{}{"auths": map[string]interface{}{
+					"test.icr.com": map[string]string{"username": "iamapikey", "password": "arbitrary-value", "email": "terraform@ibm.com"},
+				}}),
+			}),
+			expectation: Expectation{Shape: ShapeDockerConfigJSON, SecretID: "arb", Registries: []Registry{{Server: "test.icr.com", Email: "terraform@ibm.com"}}},
+		},
+		{
+			name: "dockerconfigjson-username-password",
+			secret: kubeSecret(corev1.SecretTypeDockerConfigJson, map[string]string{
+				".dockerconfigjson": mustJSON(t, map[string]interface{}{"auths": map[string]interface{}{
+					"registry.example.com": map[string]string{"username": "user", "password": "pass"},
+				}}),
+			}),
+			expectation: Expectation{Shape: ShapeDockerConfigJSON, SecretID: "up", Registries: []Registry{{Server: "registry.example.com"}}},
+		},
+		{
+			name: "dockerconfigjson-chain",
+			secret: kubeSecret(corev1.SecretTypeDockerConfigJson, map[string]string{
+				".dockerconfigjson": mustJSON(t, map[string]interface{}{"auths": map[string]interface{}{
+					"test1.icr.com": map[string]string{"username": "iamapikey", "password": "iam-apikey", "email": "terraform1@ibm.com"},
+					"test2.icr.com": map[string]string{"username": "iamapikey", "password": "iam-apikey-2"},
+				}}),
+			}),
+			expectation: Expectation{Shape: ShapeDockerConfigJSON, Registries: []Registry{
+				{Server: "test1.icr.com", Email: "terraform1@ibm.com", SecretID: "iam"},
+				{Server: "test2.icr.com", SecretID: "iam-2"},
+			}},
+		},
+		{
+			name: "dockerconfigjson-missing-registry-and-stale-password",
+			secret: kubeSecret(corev1.SecretTypeDockerConfigJson, map[string]string{
+				".dockerconfigjson": mustJSON(t, map[string]interface{}{"auths": map[string]interface{}{
+					"test1.icr.com": map[string]string{"username": "iamapikey", "password": "old-apikey", "email": "terraform1@ibm.com"},
+				}}),
+			}),
+			expectation: Expectation{Shape: ShapeDockerConfigJSON, Registries: []Registry{
+				{Server: "test1.icr.com", Email: "terraform1@ibm.com", SecretID: "iam"},
+				{Server: "test2.icr.com", SecretID: "iam-2"},
+			}},
+			expectedErrors:              []string{"has 1 auths entries, expected 2", "no auths entry for registry test2.icr.com", "password of registry test1.icr.com doesn't match"},
+			expectedErrorsWithoutSource: []string{"has 1 auths entries, expected 2", "no auths entry for registry test2.icr.com"},
+		},
+		{
+			name: "dockerconfigjson-empty-password",
+			secret: kubeSecret(corev1.SecretTypeDockerConfigJson, map[string]string{
+				".dockerconfigjson": `{"auths":{"test.icr.com":{"username":"iamapikey","password":""}}}`,
+			}),
+			expectation:                 Expectation{Shape: ShapeDockerConfigJSON, SecretID: "arb", Registries: []Registry{{Server: "test.icr.com"}}},
+			expectedErrors:              []string{"password of registry test.icr.com is empty", "password of registry test.icr.com doesn't match"},
+			expectedErrorsWithoutSource: []string{"password of registry test.icr.com is empty"},
+		},
+		{
+			name:                        "dockerconfigjson-wrong-type",
+			secret:                      kubeSecret(corev1.SecretTypeOpaque, map[string]string{".dockerconfigjson": "not json"}),
+			expectation:                 Expectation{Shape: ShapeDockerConfigJSON, SecretID: "arb", Registries: []Registry{{Server: "test.icr.com"}}},
+			expectedErrors:              []string{"type is \"Opaque\"", "is not valid JSON"},
+			expectedErrorsWithoutSource: []string{"type is \"Opaque\"", "is not valid JSON"},
+		},
+		{
+			name: "tls-with-intermediate",
+			secret: kubeSecret(corev1.SecretTypeTLS, map[string]string{
+				"tls.crt": certificatePEM + "\n" + intermediatePEM,
+				"tls.key": privateKeyPEM,
+			}),
+			expectation: Expectation{Shape: ShapeTLS, SecretID: "cert", CertificateHasIntermediate: true},
+		},
+		{
+			name: "tls-missing-intermediate",
+			secret: kubeSecret(corev1.SecretTypeTLS, map[string]string{
+				"tls.crt": certificatePEM,
+				"tls.key": privateKeyPEM,
+			}),
+			expectation:                 Expectation{Shape: ShapeTLS, SecretID: "cert", CertificateHasIntermediate: true},
+			expectedErrors:              []string{"tls.crt has 1 certificates, expected at least 2", "tls.crt doesn't match"},
+			expectedErrorsWithoutSource: []string{"tls.crt has 1 certificates, expected at least 2"},
+		},
+		{
+			name: "tls-invalid-pem-and-key-pair",
+			secret: kubeSecret(corev1.SecretTypeTLS, map[string]string{
+				"tls.crt": certificatePEM,
+				"tls.key": otherPrivateKeyPEM + "garbage",
+			}),
+			expectation:                 Expectation{Shape: ShapeTLS, SecretID: "cert"},
+			expectedErrors:              []string{"tls.key has content after the private key", "not a valid key pair", "tls.key doesn't match"},
+			expectedErrorsWithoutSource: []string{"tls.key has content after the private key", "not a valid key pair"},
+		},
+		{
+			name:        "kv-single-key",
+			secret:      kubeSecret(corev1.SecretTypeOpaque, map[string]string{"secret": "value1"}),
+			expectation: Expectation{Shape: ShapeKV, SecretID: "kv", KVKey: "key1"},
+		},
+		{
+			name:        "kv-key-path",
+			secret:      kubeSecret(corev1.SecretTypeOpaque, map[string]string{"secret": "value"}),
+			expectation: Expectation{Shape: ShapeKV, SecretID: "kv", KVKey: "nested.key"},
+		},
+		{
+			name:        "kv-all-keys",
+			secret:      kubeSecret(corev1.SecretTypeOpaque, map[string]string{"secret": `{"key1":"value1","key2":"value2","nested":{"key":"value"}}`}),
+			expectation: Expectation{Shape: ShapeKV, SecretID: "kv", KVKeys: []string{"key1", "key2"}},
+		},
+		{
+			name:                        "kv-all-keys-missing-key",
+			secret:                      kubeSecret(corev1.SecretTypeOpaque, map[string]string{"secret": `{"key1":"value1","key2":""}`}),
+			expectation:                 Expectation{Shape: ShapeKV, SecretID: "kv", KVKeys: []string{"key1", "key2", "key3"}},
+			expectedErrors:              []string{"kv key \"key2\" is missing or empty", "kv key \"key3\" is missing or empty", "secret doesn't match"},
+			expectedErrorsWithoutSource: []string{"kv key \"key2\" is missing or empty", "kv key \"key3\" is missing or empty"},
+		},
+		{
+			name:        "username-password",
+			secret:      kubeSecret(corev1.SecretTypeOpaque, map[string]string{"username": "user", "password": "pass"}),
+			expectation: Expectation{Shape: ShapeUsernamePassword, SecretID: "up"},
+		},
+		{
+			name:                        "username-password-empty-password",
+			secret:                      kubeSecret(corev1.SecretTypeOpaque, map[string]string{"username": "user", "password": " "}),
+			expectation:                 Expectation{Shape: ShapeUsernamePassword, SecretID: "up"},
+			expectedErrors:              []string{"key \"password\" is empty"},
+			expectedErrorsWithoutSource: []string{"key \"password\" is empty"},
+		},
+		{
+			name:        "opaque-iam-credentials",
+			secret:      kubeSecret("", map[string]string{"apikey": "iam-apikey"}),
+			expectation: Expectation{Shape: ShapeOpaque, SecretID: "iam", DataKey: "apikey"},
+		},
+		{
+			name:                        "opaque-missing-key",
+			secret:                      kubeSecret(corev1.SecretTypeOpaque, map[string]string{"secret": "arbitrary-value"}),
+			expectation:                 Expectation{Shape: ShapeOpaque, SecretID: "arb", DataKey: "apikey"},
+			expectedErrors:              []string{"key \"apikey\" not found, keys are [secret]"},
+			expectedErrorsWithoutSource: []string{"key \"apikey\" not found, keys are [secret]"},
+		},
+		{
+			name:        "service-credentials",
+			secret:      kubeSecret(corev1.SecretTypeOpaque, map[string]string{"credentials": mustJSON(t, credentials)}),
+			expectation: Expectation{Shape: ShapeServiceCredentials, SecretID: "sc", DataKey: "credentials"},
+		},
+		{
+			name:   "service-credentials-mappings",
+			secret: kubeSecret(corev1.SecretTypeOpaque, map[string]string{"username": "admin", "host": "mysql.example.com", "port": "30000"}),
+			expectation: Expectation{Shape: ShapeServiceCredentials, SecretID: "sc", ServiceCredentialsMappings: map[string]string{
+				"username": "connection.mysql.authentication.username",
+				"host":     "connection.mysql.hosts.0.hostname",
+				"port":     "connection.mysql.hosts.0.port",
+			}},
+		},
+		{
+			name:   "service-credentials-mappings-wrong-value",
+			secret: kubeSecret(corev1.SecretTypeOpaque, map[string]string{"username": "root", "host": ""}),
+			expectation: Expectation{Shape: ShapeServiceCredentials, SecretID: "sc", ServiceCredentialsMappings: map[string]string{
+				"username": "connection.mysql.authentication.username",
+				"host":     "connection.mysql.hosts.0.hostname",
+			}},
+			expectedErrors:              []string{"key \"host\" is empty", "username (credentials path connection.mysql.authentication.username) doesn't match"},
+			expectedErrorsWithoutSource: []string{"key \"host\" is empty"},
+		},
+		{
+			name:                        "missing-source-secret",
+			secret:                      kubeSecret(corev1.SecretTypeOpaque, map[string]string{"apikey": "value"}),
+			expectation:                 Expectation{Shape: ShapeOpaque, SecretID: "missing", DataKey: "apikey"},
+			expectedErrors:              []string{"reading source secret: secret missing: secret not found"},
+			expectedErrorsWithoutSource: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.expectation.Name = tc.name
+			tc.expectation.Namespace = "test"
+
+			for _, source := range []struct {
+				name           string
+				source         Source
+				expectedErrors []string
+			}{
+				{name: "with-source", source: server.Client(), expectedErrors: tc.expectedErrors},
+				{name: "without-source", source: nil, expectedErrors: tc.expectedErrorsWithoutSource},
+			} {
+				err := Verify(context.Background(), tc.secret, tc.expectation, source.source)
+				if len(source.expectedErrors) == 0 {
+					assert.NoError(t, err, source.name)
+					continue
+				}
+				if assert.Error(t, err, source.name) {
+					assert.Contains(t, err.Error(), "secret test/"+tc.name+": ", source.name)
+					for _, expected := range source.expectedErrors {
+						assert.Contains(t, err.Error(), expected, source.name)
+					}
+				}
+			}
+		})
+	}
+
+	assert.Greater(t, server.Requests(), 0, "The values should be read through the stand-in API")
+}
@@ -0,0 +1,18 @@
+##################################################################
+# Trusted profile with the policies shape to verify at plan time
+##################################################################
+
+module "trusted_profile" {
+  source                          = "../../modules/eso-trusted-profile"
+  trusted_profile_name            = "${var.prefix}-tp"
+  secrets_manager_guid            = var.secrets_manager_guid
+  secret_groups_id                = var.secret_groups_id
+  secret_ids                      = var.secret_ids
+  instance_reader_policy          = var.instance_reader_policy
+  policy_access_tags              = var.policy_access_tags
+  policy_time_conditions          = var.policy_time_conditions
+  tp_cluster_crn                  = var.cluster_crn
+  tp_namespace                    = "es-operator"
+  tp_clusters                     = var.tp_clusters
+  trusted_profile_claim_rule_type = var.trusted_profile_claim_rule_type
+}
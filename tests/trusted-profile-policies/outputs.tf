@@ -0,0 +1,8 @@
+##############################################################################
+# Outputs
+##############################################################################
+
+output "trusted_profile_name" {
+  description = "Name of the trusted profile"
+  value       = module.trusted_profile.trusted_profile_name
+}
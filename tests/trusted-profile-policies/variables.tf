@@ -0,0 +1,94 @@
+#######################################################################
+# Generic
+#######################################################################
+
+variable "prefix" {
+  description = "Prefix for name of all resource created by this fixture"
+  type        = string
+  default     = "eso-tp-policies"
+}
+
+variable "region" {
+  type        = string
+  description = "Region where resources will be created."
+  default     = "us-south"
+}
+
+variable "ibmcloud_api_key" {
+  type        = string
+  description = "APIkey that's associated with the account to use, set via environment variable TF_VAR_ibmcloud_api_key or .tfvars file."
+  sensitive   = true
+}
+
+#######################################################################
+# Trusted profile policies
+#######################################################################
+
+variable "secrets_manager_guid" {
+  type        = string
+  description = "Secrets manager instance GUID the trusted profile policies grant access to."
+}
+
+variable "cluster_crn" {
+  type        = string
+  description = "Cluster CRN to configure in the trusted profile claim rule."
+}
+
+variable "tp_clusters" {
+  type = list(object({
+    cluster_crn          = string
+    namespace            = string
+    service_account_name = optional(string, "external-secrets")
+    cr_type              = optional(string, null)
+  }))
+  description = "Clusters to configure in the trusted profile claim rules in addition to cluster_crn."
+  default     = []
+}
+
+variable "trusted_profile_claim_rule_type" {
+  type        = string
+  description = "Claim rule type of the claim rules not setting their own cr_type."
+  default     = "ROKS_SA"
+}
+
+variable "secret_groups_id" {
+  type        = list(string)
+  description = "The list of secret groups to limit access to for the trusted profile."
+  default     = []
+}
+
+variable "secret_ids" {
+  type        = list(string)
+  description = "The list of secrets IDs to limit access to for the trusted profile."
+  default     = []
+}
+
+variable "instance_reader_policy" {
+  type        = bool
+  description = "Set to true to grant the trusted profile the Reader role on the whole secrets manager instance."
+  default     = false
+}
+
+variable "policy_access_tags" {
+  type = list(object({
+    name     = string
+    value    = string
+    operator = optional(string, "stringEquals")
+  }))
+  description = "The list of access tags to set as condition on the trusted profile policies."
+  default     = []
+}
+
+variable "policy_time_conditions" {
+  type = object({
+    pattern  = string
+    operator = optional(string, "and")
+    conditions = list(object({
+      key      = string
+      operator = string
+      value    = list(string)
+    }))
+  })
+  description = "Time-based conditions to set on the trusted profile policies."
+  default     = null
+}
@@ -0,0 +1,247 @@
+// Tests in this file are run in the PR pipeline
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const trustedProfilePoliciesTerraformDir = "tests/trusted-profile-policies"
+
+// static values used by the trusted profile plan tests: nothing is created so they don't need to exist
+const planTestSecretsManagerGuid = "00000000-0000-0000-0000-000000000000"
+const planTestClusterCRN = "crn:v1:bluemix:public:containers-kubernetes:us-south:a/00000000000000000000000000000000:abcdefghij0123456789::"
+
+// address of the trusted profile policies in the plan of the fixture
+const tpPolicyAddress = "module.trusted_profile.ibm_iam_trusted_profile_policy.policies"
+
+// address of the trusted profile claim rules in the plan of the fixture
+const tpClaimRuleAddress = "module.trusted_profile.ibm_iam_trusted_profile_claim_rule.claim_rule"
+
+// planTrustedProfilePolicies runs terraform plan on the trusted profile policies fixture with the given input variables
+func planTrustedProfilePolicies(t *testing.T, terraformDir string, terraformVars map[string]interface{}) *terraform.PlanStruct {
+	vars := map[string]interface{}{
+		"secrets_manager_guid": planTestSecretsManagerGuid,
+		"cluster_crn":          planTestClusterCRN,
+	}
+	for key, value := range terraformVars {
+		vars[key] = value
+	}
+
+	options := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: terraformDir,
+		Vars:         vars,
+		NoColor:      true,
+	})
+
+	plan, err := terraform.InitAndPlanAndShowWithStructContextE(t, context.Background(), options)
+	require.NoError(t, err, "Plan of the trusted profile policies should not have errored")
+	return plan
+}
+
+// plannedPolicy returns the planned values of the trusted profile policy with the given key, failing the test if it is not in the plan
+func plannedPolicy(t *testing.T, plan *terraform.PlanStruct, key string) map[string]interface{} {
+	resource, found := plan.ResourcePlannedValuesMap[fmt.Sprintf("%s[%q]", tpPolicyAddress, key)]
+	require.True(t, found, "Policy %s not found in plan", key)
+	return resource.AttributeValues
+}
+
+// plannedClaimRule returns the planned values of the claim rule with the given key, failing the test if it is not in the plan
+func plannedClaimRule(t *testing.T, plan *terraform.PlanStruct, key string) map[string]interface{} {
+	resource, found := plan.ResourcePlannedValuesMap[fmt.Sprintf("%s[%q]", tpClaimRuleAddress, key)]
+	require.True(t, found, "Claim rule %s not found in plan", key)
+	return resource.AttributeValues
+}
+
+// plannedClaimRuleConditions returns the claim and value of the conditions of the planned claim rule with the given key
+func plannedClaimRuleConditions(t *testing.T, plan *terraform.PlanStruct, key string) map[string]interface{} {
+	conditions := map[string]interface{}{}
+	blocks, _ := plannedClaimRule(t, plan, key)["conditions"].([]interface{})
+	for _, block := range blocks {
+		condition := block.(map[string]interface{})
+		conditions[condition["claim"].(string)] = condition["value"]
+	}
+	return conditions
+}
+
+// countPlannedPolicies returns the number of trusted profile policies in the plan
+func countPlannedPolicies(plan *terraform.PlanStruct) int {
+	count := 0
+	for address := range plan.ResourcePlannedValuesMap {
+		if strings.HasPrefix(address, tpPolicyAddress) {
+			count++
+		}
+	}
+	return count
+}
+
+// firstBlock returns the first element of a nested block of planned values
+func firstBlock(t *testing.T, values map[string]interface{}, block string) map[string]interface{} {
+	blocks, ok := values[block].([]interface{})
+	require.True(t, ok && len(blocks) > 0, "Block %s not found in planned values", block)
+	return blocks[0].(map[string]interface{})
+}
+
+func TestTrustedProfilePoliciesPlan(t *testing.T) {
+	t.Parallel()
+
+	validateEnvVariable(t, "TF_VAR_ibmcloud_api_key")
+
+	// the fixture references the module through a relative path so the whole repo is copied
+	terraformDir := test_structure.CopyTerraformFolderToTemp(t, "..", trustedProfilePoliciesTerraformDir)
+
+	t.Run("instance", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{})
+
+		assert.Equal(t, 1, countPlannedPolicies(plan))
+		policy := plannedPolicy(t, plan, "default")
+		assert.Equal(t, []interface{}{"SecretsReader"}, policy["roles"])
+		resources := firstBlock(t, policy, "resources")
+		assert.Equal(t, planTestSecretsManagerGuid, resources["resource_instance_id"])
+		assert.Empty(t, resources["resource_type"])
+	})
+
+	t.Run("single-secrets-group", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{
+			"secret_groups_id": []string{"sg-1"},
+		})
+
+		assert.Equal(t, 1, countPlannedPolicies(plan))
+		resources := firstBlock(t, plannedPolicy(t, plan, "default"), "resources")
+		assert.Equal(t, "secret-group", resources["resource_type"])
+		assert.Equal(t, "sg-1", resources["resource"])
+	})
+
+	t.Run("multiple-secrets-groups", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{
+			"secret_groups_id": []string{"sg-1", "sg-2"},
+		})
+
+		assert.Equal(t, 2, countPlannedPolicies(plan))
+		for index, secretsGroup := range []string{"sg-1", "sg-2"} {
+			resources := firstBlock(t, plannedPolicy(t, plan, fmt.Sprintf("secret-group/%d", index)), "resources")
+			assert.Equal(t, "secret-group", resources["resource_type"])
+			assert.Equal(t, secretsGroup, resources["resource"])
+		}
+	})
+
+	t.Run("secrets", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{
+			"secret_ids": []string{"secret-1", "secret-2"},
+		})
+
+		// access restricted to the single secrets, no policy on the whole instance
+		assert.Equal(t, 2, countPlannedPolicies(plan))
+		for _, secret := range []string{"secret-1", "secret-2"} {
+			policy := plannedPolicy(t, plan, "secret/"+secret)
+			assert.Equal(t, []interface{}{"SecretsReader"}, policy["roles"])
+			resources := firstBlock(t, policy, "resources")
+			assert.Equal(t, "secret", resources["resource_type"])
+			assert.Equal(t, secret, resources["resource"])
+		}
+	})
+
+	t.Run("secrets-group-and-secrets", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{
+			"secret_groups_id": []string{"sg-1"},
+			"secret_ids":       []string{"secret-1"},
+		})
+
+		assert.Equal(t, 2, countPlannedPolicies(plan))
+		assert.Equal(t, "sg-1", firstBlock(t, plannedPolicy(t, plan, "default"), "resources")["resource"])
+		assert.Equal(t, "secret-1", firstBlock(t, plannedPolicy(t, plan, "secret/secret-1"), "resources")["resource"])
+	})
+
+	t.Run("instance-reader", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{
+			"secret_groups_id":       []string{"sg-1"},
+			"instance_reader_policy": true,
+		})
+
+		assert.Equal(t, 2, countPlannedPolicies(plan))
+		assert.Equal(t, []interface{}{"SecretsReader"}, plannedPolicy(t, plan, "default")["roles"])
+		reader := plannedPolicy(t, plan, "instance-reader")
+		assert.Equal(t, []interface{}{"Reader"}, reader["roles"])
+		resources := firstBlock(t, reader, "resources")
+		assert.Equal(t, planTestSecretsManagerGuid, resources["resource_instance_id"])
+		assert.Empty(t, resources["resource_type"])
+	})
+
+	t.Run("access-tags", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{
+			"secret_groups_id": []string{"sg-1", "sg-2"},
+			"policy_access_tags": []map[string]interface{}{
+				{"name": "env", "value": "prod"},
+			},
+		})
+
+		for _, key := range []string{"secret-group/0", "secret-group/1"} {
+			tag := firstBlock(t, plannedPolicy(t, plan, key), "resource_tags")
+			assert.Equal(t, "env", tag["name"])
+			assert.Equal(t, "prod", tag["value"])
+			assert.Equal(t, "stringEquals", tag["operator"])
+		}
+	})
+
+	t.Run("time-conditions", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{
+			"secret_ids": []string{"secret-1"},
+			"policy_time_conditions": map[string]interface{}{
+				"pattern": "time-based-conditions:once",
+				"conditions": []map[string]interface{}{
+					{"key": "{{environment.attributes.current_date_time}}", "operator": "dateTimeGreaterThanOrEquals", "value": []string{"2026-01-01T00:00:00+00:00"}},
+					{"key": "{{environment.attributes.current_date_time}}", "operator": "dateTimeLessThanOrEquals", "value": []string{"2026-12-31T23:59:59+00:00"}},
+				},
+			},
+		})
+
+		policy := plannedPolicy(t, plan, "secret/secret-1")
+		assert.Equal(t, "time-based-conditions:once", policy["pattern"])
+		assert.Equal(t, "and", policy["rule_operator"])
+		conditions, ok := policy["rule_conditions"].([]interface{})
+		if assert.True(t, ok, "rule_conditions not found in planned values") {
+			assert.Len(t, conditions, 2)
+		}
+	})
+
+	// claim rule bound to the service account of an ESO installation scoped to the tenant namespace (eso_scoped_installations of the root module)
+	t.Run("scoped-installation-service-account", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{
+			"tp_clusters": []map[string]interface{}{
+				{"cluster_crn": planTestClusterCRN, "namespace": "tenant-a", "service_account_name": "external-secrets-tenant-a"},
+			},
+		})
+
+		conditions := plannedClaimRuleConditions(t, plan, planTestClusterCRN+"/tenant-a/external-secrets-tenant-a")
+		assert.Equal(t, "\"external-secrets-tenant-a\"", conditions["name"])
+		assert.Equal(t, "\"tenant-a\"", conditions["namespace"])
+		assert.Equal(t, "\""+planTestClusterCRN+"\"", conditions["crn"])
+		// the claim rule of the main ESO installation is kept unchanged
+		assert.Equal(t, "\"external-secrets\"", plannedClaimRuleConditions(t, plan, "default")["name"])
+	})
+
+	t.Run("claim-rules-of-the-same-namespace", func(t *testing.T) {
+		plan := planTrustedProfilePolicies(t, terraformDir, map[string]interface{}{
+			"tp_clusters": []map[string]interface{}{
+				{"cluster_crn": planTestClusterCRN, "namespace": "es-operator", "service_account_name": "external-secrets"},
+				{"cluster_crn": planTestClusterCRN, "namespace": "es-operator", "service_account_name": "external-secrets-tenant-a", "cr_type": "ROKS"},
+			},
+			"trusted_profile_claim_rule_type": "IKS_SA",
+		})
+
+		// the claim rules of the same cluster and namespace are named after their service account
+		main := plannedClaimRule(t, plan, planTestClusterCRN+"/es-operator/external-secrets")
+		assert.Equal(t, "eso-tp-policies-tp-rule-abcdefghij0123456789-es-operator-external-secrets", main["name"])
+		assert.Equal(t, "IKS_SA", main["cr_type"])
+		tenant := plannedClaimRule(t, plan, planTestClusterCRN+"/es-operator/external-secrets-tenant-a")
+		assert.Equal(t, "eso-tp-policies-tp-rule-abcdefghij0123456789-es-operator-external-secrets-tenant-a", tenant["name"])
+		assert.Equal(t, "ROKS", tenant["cr_type"])
+	})
+}
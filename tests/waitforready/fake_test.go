@@ -0,0 +1,149 @@
+package waitforready
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const esoGroupVersion = "external-secrets.io/v1"
+
+// fakeESOAPIServer is a minimal Kubernetes API server serving the ESO resources discovery and a single ESO resource,
+// whose Ready condition flips to True after a number of reads
+type fakeESOAPIServer struct {
+	*httptest.Server
+	mu         sync.Mutex
+	reads      int
+	readyAfter int // number of reads returning Ready=False before returning Ready=True, negative to never be ready
+	kind       string
+	path       string
+	reason     string
+	message    string
+}
+
+// newFakeESOAPIServer starts a fake API server serving the ESO resource of the given kind, plural resource name, namespace (empty for cluster scope) and name
+func newFakeESOAPIServer(t *testing.T, kind string, resource string, namespace string, name string, readyAfter int, reason string, message string) *fakeESOAPIServer {
+	path := fmt.Sprintf("/apis/%s/%s/%s", esoGroupVersion, resource, name)
+	if namespace != "" {
+		path = fmt.Sprintf("/apis/%s/namespaces/%s/%s/%s", esoGroupVersion, namespace, resource, name)
+	}
+	server := &fakeESOAPIServer{
+		readyAfter: readyAfter,
+		kind:       kind,
+		path:       path,
+		reason:     reason,
+		message:    message,
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *fakeESOAPIServer) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api":
+		writeJSON(w, http.StatusOK, metav1.APIVersions{
+			TypeMeta: metav1.TypeMeta{Kind: "APIVersions"},
+			Versions: []string{"v1"},
+		})
+	case "/api/v1":
+		writeJSON(w, http.StatusOK, metav1.APIResourceList{
+			TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+			GroupVersion: "v1",
+		})
+	case "/apis":
+		version := metav1.GroupVersionForDiscovery{GroupVersion: esoGroupVersion, Version: "v1"}
+		writeJSON(w, http.StatusOK, metav1.APIGroupList{
+			TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"},
+			Groups: []metav1.APIGroup{{
+				Name:             "external-secrets.io",
+				Versions:         []metav1.GroupVersionForDiscovery{version},
+				PreferredVersion: version,
+			}},
+		})
+	case "/apis/" + esoGroupVersion:
+		verbs := metav1.Verbs{"get", "list", "watch"}
+		writeJSON(w, http.StatusOK, metav1.APIResourceList{
+			TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+			GroupVersion: esoGroupVersion,
+			APIResources: []metav1.APIResource{
+				{Name: "secretstores", SingularName: "secretstore", Namespaced: true, Kind: "SecretStore", Verbs: verbs},
+				{Name: "clustersecretstores", SingularName: "clustersecretstore", Namespaced: false, Kind: "ClusterSecretStore", Verbs: verbs},
+				{Name: "externalsecrets", SingularName: "externalsecret", Namespaced: true, Kind: "ExternalSecret", Verbs: verbs},
+			},
+		})
+	case s.path:
+		writeJSON(w, http.StatusOK, s.nextObject())
+	default:
+		writeJSON(w, http.StatusNotFound, metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusFailure,
+			Reason:   metav1.StatusReasonNotFound,
+			Message:  fmt.Sprintf("the server could not find the requested resource %s", r.URL.Path),
+			Code:     http.StatusNotFound,
+		})
+	}
+}
+
+// nextObject returns the ESO resource with the Ready condition for the current read
+func (s *fakeESOAPIServer) nextObject() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reads++
+
+	condition := map[string]interface{}{"type": "Ready", "status": "False", "reason": s.reason, "message": s.message}
+	if s.readyAfter >= 0 && s.reads > s.readyAfter {
+		condition = map[string]interface{}{"type": "Ready", "status": "True", "reason": "Valid", "message": "store validated"}
+	}
+	return map[string]interface{}{
+		"apiVersion": esoGroupVersion,
+		"kind":       s.kind,
+		"metadata":   map[string]interface{}{"name": "test"},
+		"status":     map[string]interface{}{"conditions": []interface{}{condition}},
+	}
+}
+
+// objectReads returns the number of reads of the ESO resource
+func (s *fakeESOAPIServer) objectReads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeKubeconfig writes a kubeconfig pointing to the given API server and returns its path
+func writeKubeconfig(t *testing.T, serverURL string) string {
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: fake
+  cluster:
+    server: %s
+contexts:
+- name: fake
+  context:
+    cluster: fake
+    user: fake
+current-context: fake
+users:
+- name: fake
+  user:
+    token: fake-token
+`, serverURL)
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(path, []byte(kubeconfig), 0600))
+	return path
+}
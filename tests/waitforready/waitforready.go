@@ -0,0 +1,37 @@
+// Package waitforready runs the wait-for-eso-ready.sh script, executed by the terraform_data.wait_for_*_ready resources
+// of the submodules, with the same environment as their local-exec provisioner. The script needs kubectl, which the
+// tests of the package run against a local API server serving the ESO resources.
+package waitforready
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Script is the path of the readiness gating script, relative to the package directory
+const Script = "../../scripts/wait-for-eso-ready.sh"
+
+// Resource is the ESO resource waited by the script
+type Resource struct {
+	Type      string // plural name of the resource type, for example secretstores
+	Name      string
+	Namespace string // empty for the cluster scoped resources
+}
+
+// Command returns the command running the script for the resource on the cluster of the kubeconfig, with the timeout
+// and the poll interval in seconds, in a home directory isolating the kubectl discovery cache
+func Command(ctx context.Context, kubeconfig string, home string, resource Resource, timeout int, pollInterval int) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "bash", Script)
+	cmd.Env = append(os.Environ(),
+		"KUBECONFIG="+kubeconfig,
+		"HOME="+home,
+		"RESOURCE_TYPE="+resource.Type,
+		"RESOURCE_NAME="+resource.Name,
+		"RESOURCE_NAMESPACE="+resource.Namespace,
+		"TIMEOUT="+strconv.Itoa(timeout),
+		"POLL_INTERVAL="+strconv.Itoa(pollInterval),
+	)
+	return cmd
+}
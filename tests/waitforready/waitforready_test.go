@@ -0,0 +1,88 @@
+// Tests in this file are run in the PR pipeline
+package waitforready
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForESOReady(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		t.Skip("kubectl is required to run the readiness gating script")
+	}
+
+	testCases := []struct {
+		name        string
+		kind        string
+		resource    string
+		namespace   string
+		readyAfter  int
+		reason      string
+		message     string
+		expectReady bool
+	}{
+		{
+			name:        "secretstore-becomes-ready",
+			kind:        "SecretStore",
+			resource:    "secretstores",
+			namespace:   "apikey-namespace",
+			readyAfter:  2,
+			reason:      "InvalidProviderConfig",
+			message:     "unable to validate store",
+			expectReady: true,
+		},
+		{
+			name:        "clustersecretstore-ready",
+			kind:        "ClusterSecretStore",
+			resource:    "clustersecretstores",
+			readyAfter:  0,
+			expectReady: true,
+		},
+		{
+			name:        "clustersecretstore-auth-failure",
+			kind:        "ClusterSecretStore",
+			resource:    "clustersecretstores",
+			readyAfter:  -1,
+			reason:      "InvalidProviderConfig",
+			message:     "unable to validate store: Provided API key could not be found",
+			expectReady: false,
+		},
+		{
+			name:        "externalsecret-sync-failure",
+			kind:        "ExternalSecret",
+			resource:    "externalsecrets",
+			namespace:   "es-namespace",
+			readyAfter:  -1,
+			reason:      "SecretSyncedError",
+			message:     "could not get secret data from provider",
+			expectReady: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newFakeESOAPIServer(t, tc.kind, tc.resource, tc.namespace, "test", tc.readyAfter, tc.reason, tc.message)
+
+			resource := Resource{Type: tc.resource, Name: "test", Namespace: tc.namespace}
+			cmd := Command(context.Background(), writeKubeconfig(t, server.URL), t.TempDir(), resource, 15, 1)
+			output, err := cmd.CombinedOutput()
+
+			if tc.expectReady {
+				assert.NoError(t, err, "The script should succeed once the resource is ready. Output: %s", output)
+				assert.Greater(t, server.objectReads(), tc.readyAfter, "The script should poll the resource until it is ready")
+			} else {
+				assert.Error(t, err, "The script should fail when the resource is not ready within the timeout")
+				assert.True(t, strings.Contains(string(output), tc.message), "The script output should contain the ESO condition message. Output: %s", output)
+				assert.True(t, strings.Contains(string(output), tc.reason), "The script output should contain the ESO condition reason. Output: %s", output)
+			}
+		})
+	}
+}
@@ -65,6 +65,82 @@ variable "eso_enroll_in_servicemesh" {
   default     = false
 }
 
+variable "eso_is_openshift" {
+  description = "Set to true when deploying on Red Hat OpenShift to have the user ID of the ESO controller, webhook and cert controller pods assigned by the restricted-v2 SCC from the namespace UID range, instead of the runAsUser 1000 which requires additional SCCs"
+  type        = bool
+  default     = false
+  nullable    = false
+}
+
+variable "eso_scoped_installations" {
+  description = "Additional ESO installations, each one with its own controller processing only the SecretStores and ClusterSecretStores with a matching `controller` field (`controller_class`, to set as controller class of the stores created with the eso-secretstore and eso-clusterstore modules). Each installation is deployed by the helm release `external-secrets-<key>`, running with the service account of the same name, in `namespace` (the ESO namespace if null, otherwise the namespace must exist). `scoped_namespace` (required, a different namespace for each installation) restricts the installation to the resources of that namespace and, with `scoped_rbac` (true by default), its RBAC to a Role in that namespace, in which case it processes no ClusterSecretStore, ClusterExternalSecret and ClusterPushSecret. The stores of `scoped_namespace` must set the controller class of the installation, as the stores without controller class are processed by the main installation too. The installations reuse the CRDs and the webhook of the main ESO installation, and get the eso_custom_values of the main installation. A ClusterSecretStore setting the controller class of an installation with `scoped_rbac` is never reconciled: that installation processes no ClusterSecretStore, and the other installations ignore the stores of another controller class."
+  type = map(object({
+    controller_class = string
+    namespace        = optional(string)
+    scoped_namespace = string
+    scoped_rbac      = optional(bool, true)
+  }))
+  default  = {}
+  nullable = false
+
+  validation {
+    condition     = alltrue([for key in keys(var.eso_scoped_installations) : can(regex("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$", key)) && length("external-secrets-${key}") <= 53])
+    error_message = "The keys of eso_scoped_installations must be lowercase alphanumeric characters or '-', at most 36 characters long, to be used in the name of their helm release."
+  }
+
+  validation {
+    condition     = alltrue([for installation in values(var.eso_scoped_installations) : trimspace(installation.controller_class) != ""]) && length(distinct([for installation in values(var.eso_scoped_installations) : installation.controller_class])) == length(var.eso_scoped_installations)
+    error_message = "The controller_class of each installation of eso_scoped_installations must be set and unique."
+  }
+
+  # the main installation watches all the namespaces, an unscoped installation would process the stores without controller class of the whole cluster again
+  validation {
+    condition     = alltrue([for installation in values(var.eso_scoped_installations) : trimspace(coalesce(installation.scoped_namespace, " ")) != ""]) && length(distinct([for installation in values(var.eso_scoped_installations) : installation.scoped_namespace])) == length(var.eso_scoped_installations)
+    error_message = "The scoped_namespace of each installation of eso_scoped_installations must be set and unique."
+  }
+}
+
+variable "eso_features" {
+  description = "The ESO resource kinds to support. Setting a kind to false disables its controller in the ESO installations (the processClusterStore, processClusterExternalSecret, processPushSecret and processClusterPushSecret chart values) and the creation of its CRD (crds.createClusterSecretStore, crds.createClusterExternalSecret, crds.createPushSecret, crds.createClusterPushSecret and crds.createClusterGenerator chart values). Pass the eso_features output to the eso_features input of the eso-clusterstore and eso-external-secret modules to fail the plan when they create or reference a disabled kind."
+  type = object({
+    cluster_secret_store    = optional(bool, true)
+    cluster_external_secret = optional(bool, true)
+    push_secret             = optional(bool, true)
+    cluster_push_secret     = optional(bool, true)
+    cluster_generator       = optional(bool, true)
+  })
+  default  = {}
+  nullable = false
+
+  validation {
+    condition     = var.eso_features.push_secret || !var.eso_features.cluster_push_secret
+    error_message = "The cluster_push_secret feature of eso_features requires push_secret, as a ClusterPushSecret generates PushSecrets."
+  }
+}
+
+# images registry and digests, for the clusters without access to the public registries
+
+variable "image_registry_mirror" {
+  type        = string
+  description = "The registry, optionally followed by a path, mirroring the ESO and Reloader images, for example `private.us.icr.io/mirror`. When set, the registry of eso_image and reloader_image is replaced by the mirror, keeping the rest of the image path (`ghcr.io/external-secrets/external-secrets` is pulled from `private.us.icr.io/mirror/external-secrets/external-secrets`). If null the images are pulled from eso_image and reloader_image."
+  default     = null
+  validation {
+    condition     = var.image_registry_mirror == null ? true : can(regex("^[a-z0-9]([-a-z0-9.]*[a-z0-9])?(:[0-9]+)?(/[a-z0-9]([-a-z0-9._]*[a-z0-9])?)*$", var.image_registry_mirror))
+    error_message = "The image_registry_mirror must be a registry host, with optional port and path, without scheme nor trailing slash, for example `private.us.icr.io/mirror`."
+  }
+}
+
+variable "image_digest_required" {
+  type        = bool
+  description = "Set to true to require the sha256 digest of the images in eso_image_version and, if the Reloader is deployed, in reloader_image_version, so that the images pulled can't change for the same tag."
+  default     = false
+  nullable    = false
+  validation {
+    condition     = !var.image_digest_required || (strcontains(var.eso_image_version, "@sha256:") && (!var.reloader_deployed || strcontains(var.reloader_image_version, "@sha256:")))
+    error_message = "With image_digest_required set to true, eso_image_version and reloader_image_version (if reloader_deployed is true) must be in the `<tag>@sha256:<digest>` format."
+  }
+}
+
 # external secrets image and helm charts references
 
 variable "eso_image" {
@@ -80,16 +156,20 @@ variable "eso_image_version" {
   default     = "v2.7.0-ubi@sha256:22735b14bb4fd82c39ad784c22f88657676bd4af22fc1b75c5a11dacc737a740" # datasource: ghcr.io/external-secrets/external-secrets
   nullable    = false
   validation {
-    condition     = can(regex("(^v\\d+\\.\\d+.\\d+(\\-\\w+)?(\\@sha256\\:\\w+){0,1})$", var.eso_image_version))
-    error_message = "The value of the external secrets image version must match classic version or the tag and sha256 image digest format"
+    condition     = can(regex("^v\\d+\\.\\d+\\.\\d+(\\-\\w+)?(\\@sha256\\:[a-f0-9]{64})?$", var.eso_image_version))
+    error_message = "The value of the external secrets image version must match classic version or the tag and sha256 image digest format, the digest being made of 64 lowercase hexadecimal characters"
   }
 }
 
 variable "eso_chart_location" {
   type        = string
-  description = "The location of the External Secrets Operator Helm chart."
+  description = "The location of the External Secrets Operator Helm chart: the URL of a chart repository or, for a chart stored in an OCI registry, the `oci://` URL of the repository containing the chart (for example `oci://private.us.icr.io/mirror/charts`)."
   default     = "https://charts.external-secrets.io"
   nullable    = false
+  validation {
+    condition     = can(regex("^(https?|oci)://", var.eso_chart_location))
+    error_message = "The eso_chart_location must be an http(s):// chart repository URL or an oci:// registry URL."
+  }
 }
 
 variable "eso_chart_version" {
@@ -99,6 +179,16 @@ variable "eso_chart_version" {
   nullable    = false
 }
 
+variable "eso_chart_repository_credentials" {
+  type = object({
+    username = string
+    password = string
+  })
+  description = "The credentials to authenticate to the External Secrets Operator Helm chart repository or OCI registry of eso_chart_location, for example an IAM API key with the `iamapikey` username for IBM Cloud Container Registry. If null the chart is pulled anonymously."
+  default     = null
+  sensitive   = true
+}
+
 variable "concurrent_reconciles" {
   type        = number
   description = "The number of concurrent reconciles the External Secrets Operator controller can do. [Learn more](https://external-secrets.io/v2.5.0/api/controller-options)."
@@ -106,6 +196,40 @@ variable "concurrent_reconciles" {
   nullable    = false
 }
 
+variable "eso_log" {
+  type = object({
+    level         = optional(string, "info")
+    time_encoding = optional(string, "epoch")
+    webhook = optional(object({
+      level         = optional(string)
+      time_encoding = optional(string)
+    }), {})
+    cert_controller = optional(object({
+      level         = optional(string)
+      time_encoding = optional(string)
+    }), {})
+  })
+  description = "The logging configuration of the External Secrets Operator: the `level` (`debug`, `info`, `warn` or `error`) and the `time_encoding` of the timestamps (`epoch`, `millis`, `nano`, `iso8601`, `rfc3339` or `rfc3339nano`) of the controller logs, used also by the webhook and the cert controller unless overridden in `webhook` and `cert_controller`. ESO always writes JSON structured logs."
+  default     = {}
+  nullable    = false
+
+  validation {
+    condition = alltrue([
+      for level in [var.eso_log.level, var.eso_log.webhook.level, var.eso_log.cert_controller.level] :
+      level == null ? true : contains(["debug", "info", "warn", "error"], level)
+    ])
+    error_message = "The eso_log levels must be one of `debug`, `info`, `warn` or `error`"
+  }
+
+  validation {
+    condition = alltrue([
+      for time_encoding in [var.eso_log.time_encoding, var.eso_log.webhook.time_encoding, var.eso_log.cert_controller.time_encoding] :
+      time_encoding == null ? true : contains(["epoch", "millis", "nano", "iso8601", "rfc3339", "rfc3339nano"], time_encoding)
+    ])
+    error_message = "The eso_log time encodings must be one of `epoch`, `millis`, `nano`, `iso8601`, `rfc3339` or `rfc3339nano`"
+  }
+}
+
 variable "eso_image_pull_secrets" {
   type        = list(string)
   description = "The list of global imagePullSecrets that will be added to every ESO deployments. The referenced secrets must already exist in the target Kubernetes namespace before deployment. This module does not create or manage imagePullSecret resources; it only configures existing secrets for use by the deployments."
@@ -113,6 +237,59 @@ variable "eso_image_pull_secrets" {
   nullable    = false
 }
 
+variable "eso_custom_values" {
+  type        = string
+  description = "String containing custom values to be used for the External Secrets Operator helm chart, merged after the values set by the module, in the ESO helm release and in the helm releases of eso_scoped_installations. See https://github.com/external-secrets/external-secrets/blob/main/deploy/charts/external-secrets/values.yaml. The keys owned by the module (`installCRDs` and the `extraVolumes` and `extraVolumeMounts` of the controller and of the webhook, mounting the `sa-token` used by the Trusted Profile authentication) can't be set, and the keys set by the module through the other ESO input variables, which take precedence over the ones of this string, are reported with a warning"
+  default     = null
+  validation {
+    condition     = var.eso_custom_values == null ? true : trimspace(var.eso_custom_values) == "" || can(keys(yamldecode(var.eso_custom_values)))
+    error_message = "The eso_custom_values must be a YAML map of the External Secrets Operator helm chart values"
+  }
+  validation {
+    condition = var.eso_custom_values == null ? true : alltrue([
+      for value in [
+        try(yamldecode(var.eso_custom_values).installCRDs, null),
+        try(yamldecode(var.eso_custom_values).extraVolumes, null),
+        try(yamldecode(var.eso_custom_values).extraVolumeMounts, null),
+        try(yamldecode(var.eso_custom_values).webhook.extraVolumes, null),
+        try(yamldecode(var.eso_custom_values).webhook.extraVolumeMounts, null),
+      ] : value == null
+    ])
+    error_message = "The eso_custom_values can't set the keys owned by the module: `installCRDs`, `extraVolumes`, `extraVolumeMounts`, `webhook.extraVolumes` and `webhook.extraVolumeMounts`"
+  }
+}
+
+variable "eso_crds_separate_release" {
+  type        = bool
+  description = "Whether to manage the External Secrets Operator CRDs in a dedicated helm release (`external-secrets-crds`) instead of the ESO helm release, so that the CRDs are not upgraded, rolled back or deleted with the ESO deployment. To switch an existing installation, apply first with eso_crds_keep_on_destroy set to true, then switch with eso_crds_pre_upgrade_check enabled to move the existing CRDs to the new release."
+  default     = false
+  nullable    = false
+}
+
+variable "eso_crds_keep_on_destroy" {
+  type        = bool
+  description = "Whether to keep the External Secrets Operator CRDs, and therefore all the ESO resources of the cluster, when the helm release installing them is destroyed, through the `helm.sh/resource-policy: keep` annotation. It applies to the release installing the CRDs, the ESO helm release unless eso_crds_separate_release is true. False by default, as in the previous versions of the module, so that the upgrade doesn't change the CRDs of the existing installations: set it to true before switching to eso_crds_separate_release."
+  default     = false
+  nullable    = false
+}
+
+variable "eso_crds_pre_upgrade_check" {
+  type        = bool
+  description = "Set to true to check, before the install or the upgrade of the External Secrets Operator CRDs, that the versions stored in the cluster (for example v1beta1 before the v1 storage) are still served by the new CRDs, and to move the CRDs to the helm release managing them when eso_crds_separate_release is changed. It requires kubectl to be available where terraform runs and kubeconfig_path to be set."
+  default     = false
+  nullable    = false
+}
+
+variable "kubeconfig_path" {
+  type        = string
+  description = "Path of the kubeconfig file used by kubectl to check the External Secrets Operator CRDs before their upgrade. Mandatory if eso_crds_pre_upgrade_check is true."
+  default     = null
+  validation {
+    condition     = var.eso_crds_pre_upgrade_check ? var.kubeconfig_path != null : true
+    error_message = "The CRDs pre-upgrade check is enabled, therefore kubeconfig_path must be provided."
+  }
+}
+
 ############################################################################################################
 # RELOADER CONFIGURATIONS
 ############################################################################################################
@@ -199,10 +376,99 @@ variable "reloader_log_format" {
     error_message = "The specified reloader_log_format is not a valid selection! Valid values are `json` or `text`"
   }
 }
+
+variable "reloader_auto_reload_all" {
+  description = "Whether reloader reloads the workloads on the update of any secret or configmap they consume, without the workloads being annotated"
+  type        = bool
+  default     = false
+}
+
+variable "reloader_custom_annotations" {
+  description = "Custom annotation keys used by reloader in place of the default ones: `auto` (`reloader.stakater.com/auto`), `search` (`reloader.stakater.com/search`), `match` (`reloader.stakater.com/match`), `secret` (`secret.reloader.stakater.com/reload`) and `configmap` (`configmap.reloader.stakater.com/reload`). When using the eso-external-secret submodule, set the same keys in its `reloader_annotations` input"
+  type = object({
+    auto      = optional(string)
+    search    = optional(string)
+    match     = optional(string)
+    secret    = optional(string)
+    configmap = optional(string)
+  })
+  default  = {}
+  nullable = false
+  validation {
+    condition     = alltrue([for key in values(var.reloader_custom_annotations) : key == null ? true : can(regex("^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*/)?[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$", key))])
+    error_message = "The reloader custom annotations must be valid Kubernetes annotation keys, in the format `[prefix/]name`"
+  }
+}
+
 variable "reloader_custom_values" {
-  description = "String containing custom values to be used for reloader helm chart. See https://github.com/stakater/Reloader/blob/master/deployments/kubernetes/chart/reloader/values.yaml"
+  description = "String containing custom values to be used for reloader helm chart. See https://github.com/stakater/Reloader/blob/master/deployments/kubernetes/chart/reloader/values.yaml. The keys set by the module, through the other reloader input variables, take precedence over the ones of this string and are reported with a warning. Prefer `reloader_values` for the settings it supports"
   type        = string
   default     = null
+  validation {
+    condition     = var.reloader_custom_values == null ? true : trimspace(var.reloader_custom_values) == "" || can(keys(yamldecode(var.reloader_custom_values)))
+    error_message = "The reloader_custom_values must be a YAML map of the reloader helm chart values"
+  }
+}
+
+variable "reloader_values" {
+  description = "Values of the reloader helm chart, overriding the ones of `reloader_custom_values`: `replicas` and `resources` of the reloader deployment, `high_availability` to enable the leader election between the replicas (at least 2 replicas are required), `service_monitor` to create a Prometheus ServiceMonitor and `rbac` to disable the RBAC resources of the chart or to restrict their `scope` to the reloader namespace (`namespace`, reloader only watching its namespace) instead of the cluster (`cluster`). Ignore the keys if not required"
+  type = object({
+    replicas = optional(number)
+    resources = optional(object({
+      requests = optional(object({
+        cpu    = optional(string)
+        memory = optional(string)
+      }))
+      limits = optional(object({
+        cpu    = optional(string)
+        memory = optional(string)
+      }))
+    }))
+    high_availability = optional(bool)
+    service_monitor = optional(object({
+      enabled  = optional(bool, true)
+      interval = optional(string)
+      timeout  = optional(string)
+      labels   = optional(map(string), {})
+    }))
+    rbac = optional(object({
+      enabled = optional(bool, true)
+      scope   = optional(string, "cluster")
+    }))
+  })
+  default  = {}
+  nullable = false
+
+  validation {
+    condition     = var.reloader_values.replicas == null ? true : var.reloader_values.replicas >= 1 && floor(var.reloader_values.replicas) == var.reloader_values.replicas
+    error_message = "The reloader_values replicas must be a whole number greater than or equal to 1"
+  }
+
+  validation {
+    condition     = var.reloader_values.high_availability != true || try(var.reloader_values.replicas >= 2, false)
+    error_message = "The reloader_values high_availability requires at least 2 replicas"
+  }
+
+  validation {
+    condition = alltrue([
+      for quantity in flatten([for resources in [try(var.reloader_values.resources.requests, null), try(var.reloader_values.resources.limits, null)] : resources == null ? [] : [resources.cpu, resources.memory]]) :
+      quantity == null ? true : can(regex("^[0-9]+(\\.[0-9]+)?(m|k|M|G|T|P|E|Ki|Mi|Gi|Ti|Pi|Ei)?$", quantity))
+    ])
+    error_message = "The reloader_values resources must be Kubernetes quantities, for example `100m` for cpu or `128Mi` for memory"
+  }
+
+  validation {
+    condition = alltrue([
+      for duration in [try(var.reloader_values.service_monitor.interval, null), try(var.reloader_values.service_monitor.timeout, null)] :
+      duration == null ? true : can(regex("^[0-9]+(ms|s|m|h)$", duration))
+    ])
+    error_message = "The reloader_values service_monitor interval and timeout must be durations, for example `30s` or `1m`"
+  }
+
+  validation {
+    condition     = contains(["cluster", "namespace"], try(var.reloader_values.rbac.scope, "cluster"))
+    error_message = "The specified reloader_values rbac scope is not a valid selection! Valid values are `cluster` or `namespace`"
+  }
 }
 
 # reloader image and helm charts references
@@ -221,16 +487,20 @@ variable "reloader_image_version" {
   default     = "v1.4.19-ubi@sha256:19b44d99e04ff043f6c1b0c0c7bbc2622af23f9650fca65632b0c76b1c0a4245" # datasource: ghcr.io/stakater/reloader
   nullable    = false
   validation {
-    condition     = can(regex("(^v\\d+\\.\\d+.\\d+(\\-\\w+)?(\\@sha256\\:\\w+){0,1})$", var.reloader_image_version))
-    error_message = "The value of the reloader image version must match classic version or the tag and sha256 image digest format"
+    condition     = can(regex("^v\\d+\\.\\d+\\.\\d+(\\-\\w+)?(\\@sha256\\:[a-f0-9]{64})?$", var.reloader_image_version))
+    error_message = "The value of the reloader image version must match classic version or the tag and sha256 image digest format, the digest being made of 64 lowercase hexadecimal characters"
   }
 }
 
 variable "reloader_chart_location" {
   type        = string
-  description = "The location of the Reloader Helm chart."
+  description = "The location of the Reloader Helm chart: the URL of a chart repository or, for a chart stored in an OCI registry, the `oci://` URL of the repository containing the chart (for example `oci://private.us.icr.io/mirror/charts`)."
   default     = "https://stakater.github.io/stakater-charts"
   nullable    = false
+  validation {
+    condition     = can(regex("^(https?|oci)://", var.reloader_chart_location))
+    error_message = "The reloader_chart_location must be an http(s):// chart repository URL or an oci:// registry URL."
+  }
 }
 
 variable "reloader_chart_version" {
@@ -240,12 +510,44 @@ variable "reloader_chart_version" {
   nullable    = false
 }
 
+variable "reloader_chart_repository_credentials" {
+  type = object({
+    username = string
+    password = string
+  })
+  description = "The credentials to authenticate to the Reloader Helm chart repository or OCI registry of reloader_chart_location, for example an IAM API key with the `iamapikey` username for IBM Cloud Container Registry. If null the chart is pulled anonymously."
+  default     = null
+  sensitive   = true
+}
+
 variable "rollback_on_failure" {
   description = "Flag to automatically rollback the helm chart on installation failure."
   type        = bool
   default     = false
 }
 
+variable "helm_release_settings" {
+  description = "The helm behaviour of the ESO, ESO CRDs, scoped installations and reloader helm releases: `timeout` in seconds, `atomic` (`rollback_on_failure` if null, never applied to the ESO CRDs release), `wait`, `wait_for_jobs`, `cleanup_on_fail` and `max_history` (0 for no limit). The `timeout` is 300 seconds if null, the helm default used by the releases of the previous versions of the module, while the submodules keep their timeout of 600 seconds. Pass the helm_release_settings output to the helm_release_settings input of the submodules to apply the same behaviour to their releases. Learn more [here](https://github.com/terraform-ibm-modules/terraform-ibm-external-secrets-operator#helm-release-settings)"
+  type = object({
+    timeout         = optional(number)
+    atomic          = optional(bool)
+    wait            = optional(bool, true)
+    wait_for_jobs   = optional(bool, false)
+    cleanup_on_fail = optional(bool, false)
+    max_history     = optional(number, 0)
+  })
+  default  = {}
+  nullable = false
+  validation {
+    condition     = var.helm_release_settings.timeout == null ? true : var.helm_release_settings.timeout > 0
+    error_message = "The helm_release_settings timeout must be greater than 0."
+  }
+  validation {
+    condition     = var.helm_release_settings.max_history >= 0
+    error_message = "The helm_release_settings max_history must be greater than or equal to 0."
+  }
+}
+
 variable "reloader_image_pull_secrets" {
   type        = list(string)
   description = "The list of global imagePullSecrets that will be added to every reloader deployments. The referenced secrets must already exist in the target Kubernetes namespace before deployment. This module does not create or manage imagePullSecret resources; it only configures existing secrets for use by the deployments."